@@ -32,6 +32,8 @@ import (
 	"github.com/spf13/viper"
 	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
 	kubeinformers "k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
@@ -41,6 +43,7 @@ import (
 	"github.com/karydia/karydia/pkg/controller"
 	"github.com/karydia/karydia/pkg/k8sutil"
 	"github.com/karydia/karydia/pkg/server"
+	"github.com/karydia/karydia/pkg/util/digest"
 	"github.com/karydia/karydia/pkg/util/tls"
 	"github.com/karydia/karydia/pkg/webhook"
 )
@@ -62,6 +65,12 @@ func init() {
 	runserverCmd.Flags().String("addr", "0.0.0.0:33333", "Address to listen on")
 
 	runserverCmd.Flags().Bool("enable-karydia-admission", false, "Enable the Karydia admission plugin")
+	runserverCmd.Flags().Bool("enable-override-authorization", false, "Require the 'override' permission on 'settings.karydia.gardener.cloud' for annotations weakening the Karydia config")
+	runserverCmd.Flags().Bool("enable-seccomp-profiles", false, "Reject 'localhost/karydia/' seccomp profiles which are not declared as KarydiaSeccompProfile (requires the KarydiaSeccompProfile CRD)")
+	runserverCmd.Flags().Bool("require-declared-seccomp-profiles", false, "Reject all 'localhost/' seccomp profiles which are not declared as KarydiaSeccompProfile, not only the ones in the karydia directory")
+	runserverCmd.Flags().String("image-digest-resolver", "none", "Resolver used to pin image tags to digests: registry | file | none")
+	runserverCmd.Flags().String("image-digest-file", "", "Path to the JSON file mapping images to digests (for --image-digest-resolver=file)")
+	runserverCmd.Flags().StringSlice("image-digest-registries", []string{}, "List of registries the digests are resolved from (for --image-digest-resolver=registry)")
 
 	runserverCmd.Flags().String("tls-cert", "cert.pem", "Path to TLS certificate file")
 	runserverCmd.Flags().String("tls-key", "key.pem", "Path to TLS private key file")
@@ -71,18 +80,26 @@ func init() {
 
 	runserverCmd.Flags().Bool("enable-default-network-policy", false, "Whether to install a default network policy in namespaces")
 	runserverCmd.Flags().StringSlice("default-network-policy-excludes", []string{"kube-system"}, "List of namespaces where the default network policy should not be installed")
+
+	runserverCmd.Flags().Bool("enable-serviceaccount-remediation", false, "Whether to apply the automountServiceAccountToken setting to existing service accounts")
+	runserverCmd.Flags().Bool("serviceaccount-remediation-dry-run", false, "Only report service accounts which would be changed by the remediation")
+	runserverCmd.Flags().StringSlice("serviceaccount-remediation-excludes", []string{"kube-system"}, "List of namespaces where service accounts should not be remediated")
+	runserverCmd.Flags().StringSlice("serviceaccount-remediation-exclude-labels", []string{}, "List of namespace label selectors ('key=value' or 'key') where service accounts should not be remediated")
 }
 
 func runserverFunc(cmd *cobra.Command, args []string) {
 	var (
 		enableController           bool
 		enableDefaultNetworkPolicy = viper.GetBool("enable-default-network-policy")
+		enableSAccRemediation      = viper.GetBool("enable-serviceaccount-remediation")
 		enableKarydiaAdmission     = viper.GetBool("enable-karydia-admission")
+		enableOverrideAuthz        = viper.GetBool("enable-override-authorization")
 		kubeInformerFactory        kubeinformers.SharedInformerFactory
+		rbacInformerFactory        kubeinformers.SharedInformerFactory
 		karydiaInformerFactory     karydiainformers.SharedInformerFactory
 		karydiaControllers         = []controller.ControllerInterface{}
 	)
-	if enableDefaultNetworkPolicy {
+	if enableDefaultNetworkPolicy || enableSAccRemediation {
 		enableController = true
 	}
 
@@ -124,15 +141,94 @@ func runserverFunc(cmd *cobra.Command, args []string) {
 	log.Infoln("KarydiaConfig Name:", karydiaConfig.Name)
 	log.Infoln("KarydiaConfig Enforcement:", karydiaConfig.Spec.Enforcement)
 	log.Infoln("KarydiaConfig AutomountServiceAccountToken:", karydiaConfig.Spec.AutomountServiceAccountToken)
+	log.Infoln("KarydiaConfig ServiceAccountTokenProjection:", karydiaConfig.Spec.ServiceAccountTokenProjection)
+	log.Infoln("KarydiaConfig ServiceAccountTokenAudience:", karydiaConfig.Spec.ServiceAccountTokenAudience)
+	log.Infoln("KarydiaConfig ServiceAccountTokenExpirationSeconds:", karydiaConfig.Spec.ServiceAccountTokenExpirationSeconds)
+	log.Infoln("KarydiaConfig ServiceAccountTokenSecrets:", karydiaConfig.Spec.ServiceAccountTokenSecrets)
+	log.Infoln("KarydiaConfig ServiceAccountTokenSecretCreators:", karydiaConfig.Spec.ServiceAccountTokenSecretCreators)
 	log.Infoln("KarydiaConfig SeccompProfile:", karydiaConfig.Spec.SeccompProfile)
+	log.Infoln("KarydiaConfig AllowedSeccompProfiles:", karydiaConfig.Spec.AllowedSeccompProfiles)
+	log.Infoln("KarydiaConfig AppArmorProfile:", karydiaConfig.Spec.AppArmorProfile)
+	log.Infoln("KarydiaConfig AllowedAppArmorProfiles:", karydiaConfig.Spec.AllowedAppArmorProfiles)
 	log.Infoln("KarydiaConfig NetworkPolicies:", karydiaConfig.Spec.NetworkPolicies)
 	log.Infoln("KarydiaConfig PodSecurityContext:", karydiaConfig.Spec.PodSecurityContext)
+	for _, profile := range karydiaConfig.Spec.PodSecurityContextProfiles {
+		log.Infoln("KarydiaConfig PodSecurityContextProfile:", profile.Name)
+	}
+	log.Infoln("KarydiaConfig ImageRegistries:", karydiaConfig.Spec.ImageRegistries)
+	log.Infoln("KarydiaConfig ImageTagPolicy:", karydiaConfig.Spec.ImageTagPolicy)
+	log.Infoln("KarydiaConfig PodSecurityStandard:", karydiaConfig.Spec.PodSecurityStandard)
+	log.Infoln("KarydiaConfig ContainerSecurityContext:", karydiaConfig.Spec.ContainerSecurityContext)
+	log.Infoln("KarydiaConfig Capabilities:", karydiaConfig.Spec.Capabilities)
+	log.Infoln("KarydiaConfig HostIsolation:", karydiaConfig.Spec.HostIsolation)
+	log.Infoln("KarydiaConfig HostPathVolumes:", karydiaConfig.Spec.HostPathVolumes)
+	log.Infoln("KarydiaConfig Sysctls:", karydiaConfig.Spec.Sysctls)
+	log.Infoln("KarydiaConfig RuntimeClass:", karydiaConfig.Spec.RuntimeClass)
+	log.Infoln("KarydiaConfig Resources:", karydiaConfig.Spec.Resources)
+	for _, profile := range karydiaConfig.Spec.ResourceProfiles {
+		log.Infoln("KarydiaConfig ResourceProfile:", profile.Name)
+	}
+	log.Infoln("KarydiaConfig NodePlacement:", karydiaConfig.Spec.NodePlacement)
+	for _, profile := range karydiaConfig.Spec.NodePlacementProfiles {
+		log.Infoln("KarydiaConfig NodePlacementProfile:", profile.Name)
+	}
+	log.Infoln("KarydiaConfig ServiceTypes:", karydiaConfig.Spec.ServiceTypes)
+	log.Infoln("KarydiaConfig ServiceExternalIPs:", karydiaConfig.Spec.ServiceExternalIPs)
+	log.Infoln("KarydiaConfig InternalLoadBalancer:", karydiaConfig.Spec.InternalLoadBalancer)
+
+	karydiaInformerFactory = karydiainformers.NewSharedInformerFactory(karydiaClientset, resyncInterval)
 
 	if enableKarydiaAdmission {
-		karydiaAdmission, err := karydiaadmission.New(&karydiaadmission.Config{
-			KubeClientset: kubeClientset,
-			KarydiaConfig: karydiaConfig,
-		})
+		var rbacAuthorizer authorizer.Authorizer
+		if enableOverrideAuthz {
+			rbacInformerFactory = kubeinformers.NewSharedInformerFactory(kubeClientset, resyncInterval)
+			rbacAuthorizer, err = k8sutil.NewRBACAuthorizer(rbacInformerFactory)
+			if err != nil {
+				log.Fatalln("Failed to create RBAC authorizer:", err)
+			}
+		}
+
+		var digestResolver digest.Resolver
+		switch viper.GetString("image-digest-resolver") {
+		case "registry":
+			registries := viper.GetStringSlice("image-digest-registries")
+			if len(registries) == 0 {
+				log.Fatalln("Image digest resolver 'registry' requires --image-digest-registries")
+			}
+			digestResolver = digest.NewRegistryResolver(5*time.Second, 10*time.Minute, registries)
+		case "file":
+			digestResolver, err = digest.NewFileResolver(viper.GetString("image-digest-file"))
+			if err != nil {
+				log.Fatalln("Failed to create image digest resolver:", err)
+			}
+		case "none":
+		default:
+			log.Fatalln("Unknown image digest resolver:", viper.GetString("image-digest-resolver"))
+		}
+
+		seccompProfileField, err := k8sutil.ServerVersionAtLeast(kubeClientset.Discovery(), 1, 19)
+		if err != nil {
+			log.Fatalln("Failed to determine server version:", err)
+		}
+
+		admissionConfig := &karydiaadmission.Config{
+			KubeClientset:       kubeClientset,
+			KarydiaConfig:       karydiaConfig,
+			Authorizer:          rbacAuthorizer,
+			DigestResolver:      digestResolver,
+			SeccompProfileField: seccompProfileField,
+
+			RequireDeclaredSeccompProfiles: viper.GetBool("require-declared-seccomp-profiles"),
+		}
+		if viper.GetBool("enable-seccomp-profiles") || viper.GetBool("require-declared-seccomp-profiles") {
+			// startup must not wait for the cache, as the CRD is not
+			// installed on helm upgrades; profiles are allowed until synced
+			seccompProfileInformer := karydiaInformerFactory.Karydia().V1alpha1().KarydiaSeccompProfiles()
+			admissionConfig.SeccompProfileLister = seccompProfileInformer.Lister()
+			admissionConfig.SeccompProfilesSynced = seccompProfileInformer.Informer().HasSynced
+		}
+
+		karydiaAdmission, err := karydiaadmission.New(admissionConfig)
 		if err != nil {
 			log.Fatalln("Failed to load karydia admission:", err)
 		}
@@ -157,7 +253,10 @@ func runserverFunc(cmd *cobra.Command, args []string) {
 		}
 	}
 
-	var reconciler *controller.NetworkpolicyReconciler
+	var (
+		reconciler     *controller.NetworkpolicyReconciler
+		sAccReconciler *controller.ServiceAccountReconciler
+	)
 	if enableController {
 		cfg, err := clientcmd.BuildConfigFromFlags(kubeServer, kubeConfig)
 		if err != nil {
@@ -169,9 +268,24 @@ func runserverFunc(cmd *cobra.Command, args []string) {
 		}
 		kubeInformerFactory = kubeinformers.NewSharedInformerFactory(kubeClientset, resyncInterval)
 		namespaceInformer := kubeInformerFactory.Core().V1().Namespaces()
-		networkPolicyInformer := kubeInformerFactory.Networking().V1().NetworkPolicies()
-		reconciler = controller.NewNetworkpolicyReconciler(kubeClientset, karydiaClientset, networkPolicyInformer, namespaceInformer, defaultNetworkPolicies, karydiaConfig.Spec.Enforcement, karydiaConfig.Spec.NetworkPolicies, viper.GetStringSlice("default-network-policy-excludes"))
-		karydiaControllers = append(karydiaControllers, reconciler)
+		if enableDefaultNetworkPolicy {
+			networkPolicyInformer := kubeInformerFactory.Networking().V1().NetworkPolicies()
+			reconciler = controller.NewNetworkpolicyReconciler(kubeClientset, karydiaClientset, networkPolicyInformer, namespaceInformer, defaultNetworkPolicies, karydiaConfig.Spec.Enforcement, karydiaConfig.Spec.NetworkPolicies, viper.GetStringSlice("default-network-policy-excludes"))
+			karydiaControllers = append(karydiaControllers, reconciler)
+		}
+		if enableSAccRemediation {
+			var excludeSelectors []labels.Selector
+			for _, excludeLabel := range viper.GetStringSlice("serviceaccount-remediation-exclude-labels") {
+				selector, err := labels.Parse(excludeLabel)
+				if err != nil {
+					log.Fatalln("Failed to parse service account remediation exclude label:", err)
+				}
+				excludeSelectors = append(excludeSelectors, selector)
+			}
+			serviceAccountInformer := kubeInformerFactory.Core().V1().ServiceAccounts()
+			sAccReconciler = controller.NewServiceAccountReconciler(kubeClientset, serviceAccountInformer, namespaceInformer, *karydiaConfig, viper.GetStringSlice("serviceaccount-remediation-excludes"), excludeSelectors, viper.GetBool("serviceaccount-remediation-dry-run"))
+			karydiaControllers = append(karydiaControllers, sAccReconciler)
+		}
 	}
 
 	serverConfig := &server.Config{
@@ -184,9 +298,13 @@ func runserverFunc(cmd *cobra.Command, args []string) {
 		log.Fatalln("Failed to load server:", err)
 	}
 
-	karydiaInformerFactory = karydiainformers.NewSharedInformerFactory(karydiaClientset, resyncInterval)
 	karydiaConfigReconciler := controller.NewConfigReconciler(*karydiaConfig, karydiaControllers, karydiaClientset, karydiaInformerFactory.Karydia().V1alpha1().KarydiaConfigs())
 
+	if rbacInformerFactory != nil {
+		rbacInformerFactory.Start(ctx.Done())
+		rbacInformerFactory.WaitForCacheSync(ctx.Done())
+	}
+
 	var wg sync.WaitGroup
 
 	wg.Add(1)
@@ -221,16 +339,29 @@ func runserverFunc(cmd *cobra.Command, args []string) {
 	}()
 
 	if enableController {
+		kubeInformerFactory.Start(ctx.Done())
+	}
+
+	if enableDefaultNetworkPolicy {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			kubeInformerFactory.Start(ctx.Done())
 			if err := reconciler.Run(2, ctx.Done()); err != nil {
 				log.Errorln("Error running controller:", err)
 			}
 		}()
 	}
 
+	if enableSAccRemediation {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := sAccReconciler.Run(2, ctx.Done()); err != nil {
+				log.Errorln("Error running service account reconciler:", err)
+			}
+		}()
+	}
+
 	go func() {
 		sigChan := make(chan os.Signal, 1)
 		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -0,0 +1,89 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/karydia/karydia/pkg/util/seccomp"
+)
+
+var seccompCmd = &cobra.Command{
+	Use:   "seccomp",
+	Short: "Seccomp profile tools",
+}
+
+var seccompLintCmd = &cobra.Command{
+	Use:   "lint <file or directory>...",
+	Short: "Check seccomp profiles for errors and dangerous syscalls",
+	Long: `Check seccomp profiles for errors and dangerous syscalls.
+
+Directories are searched for *.json files, e.g.
+  karydia seccomp lint install/charts/custom-seccomp-profiles/
+
+Exits with status 1 if a profile has errors (or warnings with --strict).`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  seccompLintFunc,
+}
+
+func init() {
+	rootCmd.AddCommand(seccompCmd)
+	seccompCmd.AddCommand(seccompLintCmd)
+
+	seccompLintCmd.Flags().Bool("strict", false, "Treat warnings as errors")
+}
+
+func seccompLintFunc(cmd *cobra.Command, args []string) {
+	strict, _ := cmd.Flags().GetBool("strict")
+
+	var files []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(arg, "*.json"))
+		if err != nil {
+			log.Fatalln(err)
+		}
+		files = append(files, matches...)
+	}
+
+	failed := false
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		for _, finding := range seccomp.Lint(data) {
+			fmt.Printf("%s: %s\n", file, finding)
+			failed = failed || finding.Severity == seccomp.SeverityError || strict
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
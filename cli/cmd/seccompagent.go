@@ -0,0 +1,87 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"k8s.io/client-go/tools/clientcmd"
+
+	clientset "github.com/karydia/karydia/pkg/client/clientset/versioned"
+	karydiainformers "github.com/karydia/karydia/pkg/client/informers/externalversions"
+	"github.com/karydia/karydia/pkg/controller"
+	"github.com/karydia/karydia/pkg/util/seccomp"
+)
+
+var seccompAgentCmd = &cobra.Command{
+	Use:   "seccomp-agent",
+	Short: "Run the karydia node agent distributing KarydiaSeccompProfiles",
+	Run:   seccompAgentFunc,
+}
+
+func init() {
+	rootCmd.AddCommand(seccompAgentCmd)
+
+	seccompAgentCmd.Flags().String("node-name", "", "Name of the node the agent is running on")
+	seccompAgentCmd.Flags().String("seccomp-root", seccomp.DefaultRootDir, "Directory the kubelet loads 'localhost/' seccomp profiles from")
+
+	seccompAgentCmd.Flags().String("kubeconfig", "", "Path to the kubeconfig file")
+	seccompAgentCmd.Flags().String("server", "", "The address and port of the Kubernetes API server")
+}
+
+func seccompAgentFunc(cmd *cobra.Command, args []string) {
+	nodeName := viper.GetString("node-name")
+	if nodeName == "" {
+		log.Fatalln("--node-name must be set")
+	}
+
+	cfg, err := clientcmd.BuildConfigFromFlags(viper.GetString("server"), viper.GetString("kubeconfig"))
+	if err != nil {
+		log.Fatalln("Failed to build kubeconfig:", err)
+	}
+	karydiaClientset, err := clientset.NewForConfig(cfg)
+	if err != nil {
+		log.Fatalln("Failed to build karydia clientset:", err)
+	}
+
+	ctx, cancelCtx := context.WithCancel(context.Background())
+	defer cancelCtx()
+
+	karydiaInformerFactory := karydiainformers.NewSharedInformerFactory(karydiaClientset, resyncInterval)
+	reconciler := controller.NewSeccompProfileReconciler(nodeName, viper.GetString("seccomp-root"), karydiaClientset, karydiaInformerFactory.Karydia().V1alpha1().KarydiaSeccompProfiles())
+
+	go func() {
+		sigChan := make(chan os.Signal, 1)
+		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+		<-sigChan
+
+		log.Infoln("Received signal, shutting down gracefully ...")
+
+		cancelCtx()
+	}()
+
+	karydiaInformerFactory.Start(ctx.Done())
+	if err := reconciler.Run(2, ctx.Done()); err != nil {
+		log.Fatalln("Error running seccomp profile reconciler:", err)
+	}
+}
@@ -52,7 +52,16 @@ webhooks:
         resources:
         - pods
         - pods/status
+        - pods/ephemeralcontainers
         - serviceaccounts
+        - services
+        - namespaces
+      - operations:
+        - CREATE
+        apiGroups: [""]
+        apiVersions: ["v1"]
+        resources:
+        - secrets
     {{- if .Values.exclusionNamespaceLabels }}
     namespaceSelector:
       matchExpressions:
@@ -114,7 +123,9 @@ webhooks:
         resources:
         - pods
         - pods/status
+        - pods/ephemeralcontainers
         - serviceaccounts
+        - services
     {{- if .Values.exclusionNamespaceLabels }}
     namespaceSelector:
       matchExpressions:
@@ -20,22 +20,40 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/karydia/karydia/pkg/apis/karydia/v1alpha1"
+	listers "github.com/karydia/karydia/pkg/client/listers/karydia/v1alpha1"
 	"github.com/karydia/karydia/pkg/logger"
+	"github.com/karydia/karydia/pkg/util/digest"
+	"strings"
 
 	"github.com/karydia/karydia/pkg/k8sutil"
 	"k8s.io/api/admission/v1beta1"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
 )
 
 var kindPod = metav1.GroupVersionKind{Group: "", Version: "v1", Kind: "Pod"}
 var kindServiceAccount = metav1.GroupVersionKind{Group: "", Version: "v1", Kind: "ServiceAccount"}
+var kindService = metav1.GroupVersionKind{Group: "", Version: "v1", Kind: "Service"}
+var kindSecret = metav1.GroupVersionKind{Group: "", Version: "v1", Kind: "Secret"}
+var kindNamespace = metav1.GroupVersionKind{Group: "", Version: "v1", Kind: "Namespace"}
+var kindEphemeralContainers = metav1.GroupVersionKind{Group: "", Version: "v1", Kind: "EphemeralContainers"}
+
+const settingDelimiter = ";"
 
 type KarydiaAdmission struct {
-	logger        *logger.Logger
-	kubeClientset kubernetes.Interface
-	karydiaConfig *v1alpha1.KarydiaConfig
+	logger                *logger.Logger
+	kubeClientset         kubernetes.Interface
+	karydiaConfig         *v1alpha1.KarydiaConfig
+	authorizer            authorizer.Authorizer
+	digestResolver        digest.Resolver
+	seccompProfileField   bool
+	seccompProfiles       listers.KarydiaSeccompProfileLister
+	seccompProfilesSynced cache.InformerSynced
+
+	requireDeclaredSeccompProfiles bool
 }
 
 func (k *KarydiaAdmission) UpdateConfig(karydiaConfig v1alpha1.KarydiaConfig) error {
@@ -46,6 +64,27 @@ func (k *KarydiaAdmission) UpdateConfig(karydiaConfig v1alpha1.KarydiaConfig) er
 type Config struct {
 	KubeClientset kubernetes.Interface
 	KarydiaConfig *v1alpha1.KarydiaConfig
+	// Authorizer is used to check if a user is allowed to weaken the
+	// karydia config with annotations. The check is skipped if nil.
+	Authorizer authorizer.Authorizer
+	// DigestResolver is used to pin image tags to digests
+	DigestResolver digest.Resolver
+
+	// SeccompProfileField selects the 'securityContext.seccompProfile'
+	// field instead of the seccomp annotations (Kubernetes >= 1.19)
+	SeccompProfileField bool
+	// SeccompProfileLister is used to check that 'localhost/' seccomp
+	// profiles are declared as KarydiaSeccompProfile. The check is skipped
+	// if nil.
+	SeccompProfileLister listers.KarydiaSeccompProfileLister
+	// SeccompProfilesSynced reports whether the cache of the lister is
+	// synced. Until then, e.g. as long as the CRD is not installed, the
+	// check is skipped.
+	SeccompProfilesSynced cache.InformerSynced
+	// RequireDeclaredSeccompProfiles rejects all 'localhost/' seccomp
+	// profiles which are not declared as KarydiaSeccompProfile, including
+	// profiles outside of the karydia directory
+	RequireDeclaredSeccompProfiles bool
 }
 
 type Setting struct {
@@ -62,15 +101,26 @@ type patchOperation struct {
 type Patches struct {
 	operations []patchOperation
 	annotated  bool
+	// securityContexts holds the paths of the pod spec or containers whose
+	// security context has been added by a patch and the paths of the
+	// security context fields added by a patch
+	securityContexts map[string]bool
 }
 
 func New(config *Config) (*KarydiaAdmission, error) {
 	logger := logger.NewComponentLogger(logger.GetCallersFilename())
 
 	return &KarydiaAdmission{
-		logger:        logger,
-		kubeClientset: config.KubeClientset,
-		karydiaConfig: config.KarydiaConfig,
+		logger:                logger,
+		kubeClientset:         config.KubeClientset,
+		karydiaConfig:         config.KarydiaConfig,
+		authorizer:            config.Authorizer,
+		digestResolver:        config.DigestResolver,
+		seccompProfileField:   config.SeccompProfileField,
+		seccompProfiles:       config.SeccompProfileLister,
+		seccompProfilesSynced: config.SeccompProfilesSynced,
+
+		requireDeclaredSeccompProfiles: config.RequireDeclaredSeccompProfiles,
 	}, nil
 }
 
@@ -80,6 +130,15 @@ func (k *KarydiaAdmission) Admit(ar v1beta1.AdmissionReview, mutationAllowed boo
 		return k8sutil.AllowAdmissionResponse()
 	}
 
+	if req.SubResource == ephemeralContainersSubResource {
+		namespace, err := k.getNamespaceFromAdmissionRequest(*req)
+		if err != nil {
+			k.logger.Errorln(err)
+			return k8sutil.ErrToAdmissionResponse(err)
+		}
+		return k.admitEphemeralContainers(*req, namespace, mutationAllowed)
+	}
+
 	switch req.Kind {
 	case kindPod:
 		pod, err := decodePod(req.Object.Raw)
@@ -92,6 +151,12 @@ func (k *KarydiaAdmission) Admit(ar v1beta1.AdmissionReview, mutationAllowed boo
 			return k8sutil.AllowAdmissionResponse()
 		}
 
+		seccompProfiles, err := decodeSeccompProfiles(req.Object.Raw)
+		if err != nil {
+			k.logger.Errorln("failed to decode object:", err)
+			return k8sutil.ErrToAdmissionResponse(err)
+		}
+
 		namespace, err := k.getNamespaceFromAdmissionRequest(*req)
 		if err != nil {
 			k.logger.Errorln(err)
@@ -99,9 +164,17 @@ func (k *KarydiaAdmission) Admit(ar v1beta1.AdmissionReview, mutationAllowed boo
 		}
 
 		if mutationAllowed {
-			return k.mutatePod(pod, namespace)
+			return k.mutatePod(pod, seccompProfiles, namespace, req.Operation)
+		}
+		if response := k.validateOverrides(*req, pod.ObjectMeta, namespace); !response.Allowed {
+			return response
+		}
+		ephemeralContainers, err := decodeEphemeralContainers(req.Object.Raw)
+		if err != nil {
+			k.logger.Errorln("failed to decode object:", err)
+			return k8sutil.ErrToAdmissionResponse(err)
 		}
-		return k.validatePod(pod, namespace)
+		return k.validatePod(pod, ephemeralContainers, seccompProfiles, namespace, req.Operation)
 	case kindServiceAccount:
 		sAcc, err := decodeServiceAccount(req.Object.Raw)
 		if err != nil {
@@ -118,7 +191,73 @@ func (k *KarydiaAdmission) Admit(ar v1beta1.AdmissionReview, mutationAllowed boo
 		if mutationAllowed {
 			return k.mutateServiceAccount(sAcc, namespace)
 		}
+		if response := k.validateOverrides(*req, sAcc.ObjectMeta, namespace); !response.Allowed {
+			return response
+		}
 		return k.validateServiceAccount(sAcc, namespace)
+	case kindService:
+		svc, err := decodeService(req.Object.Raw)
+		if err != nil {
+			k.logger.Errorln("failed to decode object:", err)
+			return k8sutil.ErrToAdmissionResponse(err)
+		}
+
+		namespace, err := k.getNamespaceFromAdmissionRequest(*req)
+		if err != nil {
+			k.logger.Errorln(err)
+			return k8sutil.ErrToAdmissionResponse(err)
+		}
+
+		if mutationAllowed {
+			return k.mutateService(svc, namespace)
+		}
+		if response := k.validateOverrides(*req, svc.ObjectMeta, namespace); !response.Allowed {
+			return response
+		}
+		allocateNodePorts, err := decodeAllocateLoadBalancerNodePorts(req.Object.Raw)
+		if err != nil {
+			k.logger.Errorln("failed to decode object:", err)
+			return k8sutil.ErrToAdmissionResponse(err)
+		}
+		var oldExternalIPs []string
+		if len(req.OldObject.Raw) > 0 {
+			oldSvc, err := decodeService(req.OldObject.Raw)
+			if err != nil {
+				k.logger.Errorln("failed to decode old object:", err)
+				return k8sutil.ErrToAdmissionResponse(err)
+			}
+			oldExternalIPs = oldSvc.Spec.ExternalIPs
+		}
+		return k.validateService(svc, oldExternalIPs, allocateNodePorts, namespace)
+	case kindSecret:
+		if mutationAllowed {
+			return k8sutil.AllowAdmissionResponse()
+		}
+
+		secret, err := decodeSecret(req.Object.Raw)
+		if err != nil {
+			k.logger.Errorln("failed to decode object:", err)
+			return k8sutil.ErrToAdmissionResponse(err)
+		}
+
+		namespace, err := k.getNamespaceFromAdmissionRequest(*req)
+		if err != nil {
+			k.logger.Errorln(err)
+			return k8sutil.ErrToAdmissionResponse(err)
+		}
+
+		return k.validateSecret(*req, secret, namespace)
+	case kindNamespace:
+		namespace, err := decodeNamespace(req.Object.Raw)
+		if err != nil {
+			k.logger.Errorln("failed to decode object:", err)
+			return k8sutil.ErrToAdmissionResponse(err)
+		}
+
+		if mutationAllowed {
+			return k8sutil.AllowAdmissionResponse()
+		}
+		return k.validateNamespace(*req, namespace)
 	}
 
 	return k8sutil.AllowAdmissionResponse()
@@ -138,6 +277,118 @@ func (k *KarydiaAdmission) getNamespaceFromAdmissionRequest(ar v1beta1.Admission
 	return namespace, nil
 }
 
+// getConfigSpec returns the spec of the current karydia config or an empty
+// spec if no config is loaded
+func (k *KarydiaAdmission) getConfigSpec() v1alpha1.KarydiaConfigSpec {
+	if k.karydiaConfig == nil {
+		return v1alpha1.KarydiaConfigSpec{}
+	}
+	return k.karydiaConfig.Spec
+}
+
+// annotationsAllowed reports whether karydia annotations may override the
+// karydia config, i.e. if enforcement is disabled or the namespace is
+// kube-system
+func (k *KarydiaAdmission) annotationsAllowed(ns *v1.Namespace) bool {
+	return ns.Name == "kube-system" || !k.getConfigSpec().Enforcement
+}
+
+// getSetting resolves a setting with the following precedence: annotation of
+// the admitted object, annotation of its namespace, karydia config. The
+// source of the resolved value is recorded in the setting.
+func (k *KarydiaAdmission) getSetting(annotation string, obj metav1.ObjectMeta, objSrc string, ns *v1.Namespace, configValue string) Setting {
+	if k.annotationsAllowed(ns) {
+		if value, ok := obj.Annotations[annotation]; ok {
+			return Setting{value: value, src: objSrc}
+		}
+		if value, ok := ns.ObjectMeta.Annotations[annotation]; ok {
+			return Setting{value: value, src: "namespace"}
+		}
+	}
+	return Setting{value: configValue, src: "config"}
+}
+
+// splitSetting splits a setting value holding a list, e.g. 'a;b', into its
+// non-empty elements
+func splitSetting(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, settingDelimiter) {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+type namespaceEntry struct {
+	namespace string
+	value     string
+}
+
+// parseNamespaceEntries parses a setting mapping namespaces to values, i.e. a
+// ';'-separated list of '<namespace>=<value>' entries. Entries without
+// namespace apply to all namespaces.
+func parseNamespaceEntries(setting string) []namespaceEntry {
+	var entries []namespaceEntry
+	for _, entry := range splitSetting(setting) {
+		var e namespaceEntry
+		if i := strings.Index(entry, "="); i >= 0 {
+			e.namespace = strings.TrimSpace(entry[:i])
+			e.value = strings.TrimSpace(entry[i+1:])
+		} else {
+			e.value = entry
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// valueForNamespace returns the value the setting maps the namespace to. An
+// exact namespace match takes precedence over the longest matching namespace
+// prefix (entries ending with '*', e.g. 'tenant-*') and entries without
+// namespace.
+func valueForNamespace(setting string, namespace string) string {
+	value := ""
+	matched := -1
+	for _, entry := range parseNamespaceEntries(setting) {
+		switch {
+		case entry.namespace == namespace:
+			return entry.value
+		case entry.namespace == "" && matched < 0:
+			value = entry.value
+		case strings.HasSuffix(entry.namespace, "*") && strings.HasPrefix(namespace, strings.TrimSuffix(entry.namespace, "*")) && len(entry.namespace) > matched:
+			value = entry.value
+			matched = len(entry.namespace)
+		}
+	}
+	return value
+}
+
+// namespaceEntriesWeakens reports whether the value is none of the values the
+// setting maps namespaces to. The namespace is not known when overrides are
+// checked, so any of the mapped values is accepted.
+func namespaceEntriesWeakens(value string, setting string) bool {
+	entries := parseNamespaceEntries(setting)
+	for _, entry := range entries {
+		if entry.value == value && value != "none" {
+			return false
+		}
+	}
+	return len(entries) > 0
+}
+
+// profileAllowed reports whether the (seccomp or AppArmor) profile matches one
+// of the allowed profiles. An allowed profile ending with '*' matches all
+// profiles with the same prefix, e.g. 'localhost/*'.
+func profileAllowed(profile string, allowed []string) bool {
+	for _, a := range allowed {
+		if profile == a || strings.HasSuffix(a, "*") && strings.HasPrefix(profile, strings.TrimSuffix(a, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
 func (patches *Patches) toBytes() []byte {
 	patchBytes, err := json.Marshal(patches.operations)
 	if err != nil {
@@ -0,0 +1,63 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package karydia
+
+import (
+	"fmt"
+
+	"k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/karydia/karydia/pkg/k8sutil"
+	"github.com/karydia/karydia/pkg/k8sutil/scheme"
+)
+
+func (k *KarydiaAdmission) validateNamespace(req v1beta1.AdmissionRequest, ns *corev1.Namespace) *v1beta1.AdmissionResponse {
+	var validationErrors []string
+
+	if response := k.validateOverrides(req, ns.ObjectMeta, ns); !response.Allowed {
+		return response
+	}
+	validationErrors = validateNamespaceInternalLoadBalancer(*ns, validationErrors)
+
+	return k8sutil.ValidatingAdmissionResponse(validationErrors)
+}
+
+// validateNamespaceInternalLoadBalancer rejects namespaces annotated with a
+// cloud provider without internal load balancers, which would reject all load
+// balancer services of the namespace
+func validateNamespaceInternalLoadBalancer(ns corev1.Namespace, validationErrors []string) []string {
+	value, ok := ns.Annotations["karydia.gardener.cloud/internalLoadBalancer"]
+	if !ok || value == "none" {
+		return validationErrors
+	}
+	if _, ok := internalLoadBalancerAnnotations[value]; !ok {
+		validationErrorMsg := fmt.Sprintf("internal load balancers of cloud provider '%s' are not supported", value)
+		validationErrors = append(validationErrors, validationErrorMsg)
+	}
+	return validationErrors
+}
+
+/* Utility functions to decode raw resources into objects */
+func decodeNamespace(raw []byte) (*corev1.Namespace, error) {
+	namespace := &corev1.Namespace{}
+	deserializer := scheme.Codecs.UniversalDeserializer()
+	if _, _, err := deserializer.Decode(raw, nil, namespace); err != nil {
+		return nil, err
+	}
+	return namespace, nil
+}
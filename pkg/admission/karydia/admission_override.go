@@ -0,0 +1,416 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package karydia
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/karydia/karydia/pkg/apis/karydia/v1alpha1"
+	"github.com/karydia/karydia/pkg/k8sutil"
+
+	"k8s.io/api/admission/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+const (
+	overrideVerb     = "override"
+	overrideAPIGroup = "karydia.gardener.cloud"
+	overrideResource = "settings"
+)
+
+type weakeningAnnotation struct {
+	annotation string
+	// weakens reports whether the annotation value weakens the protection
+	// compared to the karydia config
+	weakens func(value string, spec v1alpha1.KarydiaConfigSpec) bool
+}
+
+// weakeningAnnotations lists the karydia annotations which require the
+// 'override' permission on 'settings' if they weaken the karydia config.
+var weakeningAnnotations = []weakeningAnnotation{
+	{
+		annotation: "karydia.gardener.cloud/automountServiceAccountToken",
+		weakens: func(value string, spec v1alpha1.KarydiaConfigSpec) bool {
+			return automountServiceAccountTokenLevel(value) < automountServiceAccountTokenLevel(spec.AutomountServiceAccountToken)
+		},
+	},
+	{
+		annotation: "karydia.gardener.cloud/serviceAccountTokenProjection",
+		weakens: func(value string, spec v1alpha1.KarydiaConfigSpec) bool {
+			return value != "projected" && spec.ServiceAccountTokenProjection == "projected"
+		},
+	},
+	{
+		annotation: "karydia.gardener.cloud/serviceAccountTokenSecrets",
+		weakens: func(value string, spec v1alpha1.KarydiaConfigSpec) bool {
+			return value != "restricted" && spec.ServiceAccountTokenSecrets == "restricted"
+		},
+	},
+	{
+		annotation: "karydia.gardener.cloud/podSecurityContext",
+		weakens:    podSecurityContextWeakens,
+	},
+	{
+		annotation: "karydia.gardener.cloud/seccompProfile",
+		weakens: func(value string, spec v1alpha1.KarydiaConfigSpec) bool {
+			return (value == "" || value == "unconfined") && spec.SeccompProfile != "" && spec.SeccompProfile != "unconfined"
+		},
+	},
+	{
+		annotation: "karydia.gardener.cloud/allowedSeccompProfiles",
+		weakens: func(value string, spec v1alpha1.KarydiaConfigSpec) bool {
+			return allowedProfilesWeakens(value, spec.AllowedSeccompProfiles)
+		},
+	},
+	{
+		annotation: "karydia.gardener.cloud/appArmorProfile",
+		weakens: func(value string, spec v1alpha1.KarydiaConfigSpec) bool {
+			return (value == "" || value == "unconfined") && spec.AppArmorProfile != "" && spec.AppArmorProfile != "unconfined"
+		},
+	},
+	{
+		annotation: "karydia.gardener.cloud/allowedAppArmorProfiles",
+		weakens: func(value string, spec v1alpha1.KarydiaConfigSpec) bool {
+			return allowedProfilesWeakens(value, spec.AllowedAppArmorProfiles)
+		},
+	},
+	{
+		annotation: "karydia.gardener.cloud/imageTagPolicy",
+		weakens: func(value string, spec v1alpha1.KarydiaConfigSpec) bool {
+			return imageTagPolicyLevel(value) < imageTagPolicyLevel(spec.ImageTagPolicy)
+		},
+	},
+	{
+		annotation: "karydia.gardener.cloud/podSecurityStandard",
+		weakens: func(value string, spec v1alpha1.KarydiaConfigSpec) bool {
+			return podSecurityStandardLevel(value) < podSecurityStandardLevel(spec.PodSecurityStandard)
+		},
+	},
+	{
+		annotation: "karydia.gardener.cloud/containerSecurityContext",
+		weakens: func(value string, spec v1alpha1.KarydiaConfigSpec) bool {
+			return containerSecurityContextLevel(value) < containerSecurityContextLevel(spec.ContainerSecurityContext)
+		},
+	},
+	{
+		annotation: "karydia.gardener.cloud/capabilities",
+		weakens: func(value string, spec v1alpha1.KarydiaConfigSpec) bool {
+			if spec.Capabilities == "" || spec.Capabilities == "none" {
+				return false
+			}
+			capabilities := allowedCapabilities(value)
+			return value == "" || value == "none" || len(capabilities) > 0 && !isSubset(capabilities, allowedCapabilities(spec.Capabilities))
+		},
+	},
+	{
+		annotation: "karydia.gardener.cloud/hostIsolation",
+		weakens: func(value string, spec v1alpha1.KarydiaConfigSpec) bool {
+			return value != "restricted" && spec.HostIsolation == "restricted"
+		},
+	},
+	{
+		annotation: "karydia.gardener.cloud/hostPathVolumes",
+		weakens:    hostPathVolumesWeakens,
+	},
+	{
+		annotation: "karydia.gardener.cloud/sysctls",
+		weakens:    sysctlsWeakens,
+	},
+	{
+		annotation: "karydia.gardener.cloud/runtimeClass",
+		weakens: func(value string, spec v1alpha1.KarydiaConfigSpec) bool {
+			return namespaceEntriesWeakens(value, spec.RuntimeClass)
+		},
+	},
+	{
+		annotation: "karydia.gardener.cloud/resources",
+		weakens:    resourcesWeakens,
+	},
+	{
+		annotation: "karydia.gardener.cloud/nodePlacement",
+		weakens: func(value string, spec v1alpha1.KarydiaConfigSpec) bool {
+			return namespaceEntriesWeakens(value, spec.NodePlacement)
+		},
+	},
+	{
+		annotation: "karydia.gardener.cloud/serviceTypes",
+		weakens: func(value string, spec v1alpha1.KarydiaConfigSpec) bool {
+			return spec.ServiceTypes != "" && spec.ServiceTypes != "none" && !isSubset(splitSetting(value), splitSetting(spec.ServiceTypes))
+		},
+	},
+	{
+		annotation: "karydia.gardener.cloud/serviceExternalIPs",
+		weakens: func(value string, spec v1alpha1.KarydiaConfigSpec) bool {
+			return value != "deny" && spec.ServiceExternalIPs == "deny"
+		},
+	},
+	{
+		annotation: "karydia.gardener.cloud/internalLoadBalancer",
+		weakens: func(value string, spec v1alpha1.KarydiaConfigSpec) bool {
+			return value != spec.InternalLoadBalancer && spec.InternalLoadBalancer != "" && spec.InternalLoadBalancer != "none"
+		},
+	},
+	{
+		annotation: "karydia.gardener.cloud/imageRegistries",
+		weakens: func(value string, spec v1alpha1.KarydiaConfigSpec) bool {
+			return spec.ImageRegistries != "" && !isSubset(splitSetting(value), splitSetting(spec.ImageRegistries))
+		},
+	},
+}
+
+// allowedProfilesWeakens reports whether the value allows a (seccomp or
+// AppArmor) profile which is not allowed by the configured allowed profiles
+func allowedProfilesWeakens(value string, config string) bool {
+	if config == "" {
+		return false
+	}
+	profiles := splitSetting(value)
+	for _, profile := range profiles {
+		if !profileAllowed(profile, splitSetting(config)) {
+			return true
+		}
+	}
+	return len(profiles) == 0
+}
+
+// isSubset reports whether values is a non-empty subset of allowed
+func isSubset(values []string, allowed []string) bool {
+	if len(values) == 0 {
+		return false
+	}
+	for _, value := range values {
+		found := false
+		for _, a := range allowed {
+			if value == a {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// hostPathVolumesWeakens reports whether the value allows a host path or a
+// writable mount which is not allowed by the config
+func hostPathVolumesWeakens(value string, spec v1alpha1.KarydiaConfigSpec) bool {
+	if spec.HostPathVolumes == "" || spec.HostPathVolumes == "none" || value == "deny" {
+		return false
+	}
+	if value == "" || value == "none" || spec.HostPathVolumes == "deny" {
+		return true
+	}
+	allowed := parseHostPathEntries(spec.HostPathVolumes)
+	for _, entry := range parseHostPathEntries(value) {
+		covered := false
+		for _, a := range allowed {
+			if hasPathPrefix(entry.prefix, a.prefix) && (entry.readOnly || !a.readOnly) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return true
+		}
+	}
+	return false
+}
+
+// sysctlsWeakens reports whether the value allows a sysctl which is not allowed
+// by the config
+func sysctlsWeakens(value string, spec v1alpha1.KarydiaConfigSpec) bool {
+	if spec.Sysctls == "" || spec.Sysctls == "none" {
+		return false
+	}
+	if value == "" || value == "none" {
+		return true
+	}
+	allowed := allowedSysctls(spec.Sysctls)
+	for _, sysctl := range allowedSysctls(value) {
+		if !sysctlAllowed(sysctl, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// podSecurityContextWeakens compares the chosen pod security context profile
+// with the profile of the karydia config. A profile weakens the config if it
+// runs pods as root where the config does not, drops 'runAsNonRoot' or sets
+// sysctls the config's profile does not set. Undefined profiles are rejected
+// by the validation anyway.
+func podSecurityContextWeakens(value string, spec v1alpha1.KarydiaConfigSpec) bool {
+	configProfile := podSecurityContextProfile(spec, spec.PodSecurityContext)
+	if configProfile == nil {
+		return false
+	}
+	if value == "" || value == "none" {
+		return true
+	}
+	profile := podSecurityContextProfile(spec, value)
+	if profile == nil {
+		return false
+	}
+
+	runsAsRoot := func(id *int64) bool {
+		return id == nil || *id == 0
+	}
+	if !runsAsRoot(configProfile.RunAsUser) && runsAsRoot(profile.RunAsUser) {
+		return true
+	}
+	if !runsAsRoot(configProfile.RunAsGroup) && runsAsRoot(profile.RunAsGroup) {
+		return true
+	}
+	if configProfile.RunAsNonRoot != nil && *configProfile.RunAsNonRoot && (profile.RunAsNonRoot == nil || !*profile.RunAsNonRoot) {
+		return true
+	}
+	for _, sysctl := range profile.Sysctls {
+		found := false
+		for _, configSysctl := range configProfile.Sysctls {
+			if sysctl == configSysctl {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return true
+		}
+	}
+	return false
+}
+
+// containerSecurityContextLevel ranks 'validate' above 'harden' as it also
+// rejects explicitly disabled settings
+func containerSecurityContextLevel(value string) int {
+	switch value {
+	case "harden":
+		return 1
+	case "validate":
+		return 2
+	}
+	return 0
+}
+
+func imageTagPolicyLevel(value string) int {
+	switch value {
+	case "reject-mutable":
+		return 1
+	case "pin-digest":
+		return 2
+	}
+	return 0
+}
+
+func automountServiceAccountTokenLevel(value string) int {
+	switch value {
+	case "change-default":
+		return 1
+	case "change-all":
+		return 2
+	}
+	return 0
+}
+
+// validateOverrides checks if the requesting user is allowed to set all newly
+// added or changed karydia annotations of the given object which weaken the
+// karydia config
+func (k *KarydiaAdmission) validateOverrides(req v1beta1.AdmissionRequest, obj metav1.ObjectMeta, ns *corev1.Namespace) *v1beta1.AdmissionResponse {
+	var validationErrors []string
+
+	if k.authorizer == nil || !k.annotationsAllowed(ns) {
+		return k8sutil.AllowAdmissionResponse()
+	}
+
+	oldAnnotations, err := decodeAnnotations(req.OldObject.Raw)
+	if err != nil {
+		k.logger.Errorln("failed to decode old object:", err)
+		return k8sutil.ErrToAdmissionResponse(err)
+	}
+
+	spec := k.getConfigSpec()
+	for _, w := range weakeningAnnotations {
+		value, ok := obj.Annotations[w.annotation]
+		if !ok {
+			continue
+		}
+		if oldValue, ok := oldAnnotations[w.annotation]; ok && oldValue == value {
+			continue
+		}
+		if !w.weakens(value, spec) {
+			continue
+		}
+		setting := strings.TrimPrefix(w.annotation, overrideAPIGroup+"/")
+		allowed, err := k.authorizeOverride(req.UserInfo, ns.Name, setting)
+		if err != nil {
+			k.logger.Errorln("failed to authorize override:", err)
+			return k8sutil.ErrToAdmissionResponse(err)
+		}
+		if !allowed {
+			validationErrorMsg := fmt.Sprintf("user '%s' is not allowed to override '%s' with '%s' (requires verb '%s' on resource '%s.%s')", req.UserInfo.Username, setting, value, overrideVerb, overrideResource, overrideAPIGroup)
+			validationErrors = append(validationErrors, validationErrorMsg)
+		}
+	}
+
+	return k8sutil.ValidatingAdmissionResponse(validationErrors)
+}
+
+func (k *KarydiaAdmission) authorizeOverride(userInfo authenticationv1.UserInfo, namespace, setting string) (bool, error) {
+	extra := make(map[string][]string, len(userInfo.Extra))
+	for key, value := range userInfo.Extra {
+		extra[key] = value
+	}
+	attributes := authorizer.AttributesRecord{
+		User: &user.DefaultInfo{
+			Name:   userInfo.Username,
+			UID:    userInfo.UID,
+			Groups: userInfo.Groups,
+			Extra:  extra,
+		},
+		Verb:            overrideVerb,
+		Namespace:       namespace,
+		APIGroup:        overrideAPIGroup,
+		Resource:        overrideResource,
+		Name:            setting,
+		ResourceRequest: true,
+	}
+	decision, reason, err := k.authorizer.Authorize(attributes)
+	if err != nil {
+		return false, err
+	}
+	k.logger.Debugf("override of '%s' in namespace '%s' by user '%s': decision='%v' reason='%s'", setting, namespace, userInfo.Username, decision, reason)
+	return decision == authorizer.DecisionAllow, nil
+}
+
+/* Utility functions to decode raw resources into objects */
+func decodeAnnotations(raw []byte) (map[string]string, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	obj := &metav1.PartialObjectMetadata{}
+	if err := json.Unmarshal(raw, obj); err != nil {
+		return nil, err
+	}
+	return obj.Annotations, nil
+}
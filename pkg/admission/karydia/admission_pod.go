@@ -17,151 +17,785 @@
 package karydia
 
 import (
+	"encoding/json"
 	"fmt"
+	"path"
 	"strconv"
 	"strings"
 
 	"k8s.io/api/admission/v1beta1"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
+	"github.com/karydia/karydia/pkg/apis/karydia/v1alpha1"
 	"github.com/karydia/karydia/pkg/k8sutil"
 	"github.com/karydia/karydia/pkg/k8sutil/scheme"
 )
 
-func (k *KarydiaAdmission) mutatePod(pod *corev1.Pod, ns *corev1.Namespace) *v1beta1.AdmissionResponse {
+// mutatePod applies the settings to the pod. Settings which change immutable
+// fields of the pod spec are only applied when the pod is created.
+func (k *KarydiaAdmission) mutatePod(pod *corev1.Pod, profiles seccompProfiles, ns *corev1.Namespace, operation v1beta1.Operation) *v1beta1.AdmissionResponse {
 	var patches Patches
 
-	setting := k.getSeccompProfileSetting(ns)
-	if setting.value != "" {
-		patches = mutatePodSeccompProfile(*pod, setting, patches)
+	setting := k.getSeccompProfileSetting(pod, ns)
+	if pss := k.getPodSecurityStandardSetting(pod, ns); pss.value == podSecurityStandardRestricted && (setting.value == "" || setting.value == "unconfined") {
+		// the restricted pod security standard requires a seccomp profile
+		setting = Setting{value: "runtime/default", src: pss.src}
 	}
-	setting = k.getSecurityContextSetting(ns)
-	if setting.value != "" {
-		patches = mutatePodSecurityContext(*pod, setting, patches)
+	if setting.value != "" && operation == v1beta1.Create {
+		patches = mutatePodSeccompProfile(*pod, profiles, setting, k.seccompProfileField, patches)
+	}
+	setting = k.getAppArmorProfileSetting(pod, ns)
+	if setting.value != "" && setting.value != "unconfined" && operation == v1beta1.Create {
+		patches = mutatePodAppArmorProfile(*pod, setting, patches)
+	}
+	setting = k.getSecurityContextSetting(pod, ns)
+	if setting.value != "" && setting.value != "none" && operation == v1beta1.Create {
+		if profile := k.getPodSecurityContextProfile(setting.value); profile != nil {
+			patches = mutatePodSecurityContext(*pod, setting, profile, patches)
+		} else {
+			k.logger.Warnf("pod security context profile '%s' is not defined", setting.value)
+		}
+	}
+	setting = k.getContainerSecurityContextSetting(pod, ns)
+	if setting.value != "" && operation == v1beta1.Create {
+		patches = mutatePodContainerSecurityContext(*pod, setting, patches)
+	}
+	setting = k.getCapabilitiesSetting(pod, ns)
+	if setting.value != "" && operation == v1beta1.Create {
+		patches = mutatePodCapabilities(*pod, setting, patches)
+	}
+	setting = k.getImageTagPolicySetting(pod, ns)
+	if setting.value != "" && operation == v1beta1.Create {
+		patches = k.mutatePodImageTags(*pod, k.getImageRegistriesSetting(pod, ns), setting, patches)
+	}
+	setting = k.getHostIsolationSetting(pod, ns)
+	if setting.value != "" && operation == v1beta1.Create {
+		patches = mutatePodHostIsolation(*pod, setting, patches)
+	}
+	setting = k.getRuntimeClassSetting(ns)
+	if setting.value != "" && operation == v1beta1.Create {
+		patches = mutatePodRuntimeClass(*pod, setting, patches)
+	}
+	setting = k.getResourcesSetting(ns)
+	if setting.value != "" && setting.value != "none" && setting.value != resourcesValidate && operation == v1beta1.Create {
+		if profile := k.getResourceProfile(setting.value); profile != nil {
+			patches = mutatePodResources(*pod, setting, profile, patches)
+		} else {
+			k.logger.Warnf("resource profile '%s' is not defined", setting.value)
+		}
+	}
+	setting = k.getNodePlacementSetting(ns)
+	if setting.value != "" && setting.value != "none" && operation == v1beta1.Create {
+		if profile := k.getNodePlacementProfile(setting.value); profile != nil {
+			patches = mutatePodNodePlacement(*pod, setting, profile, patches)
+		} else {
+			k.logger.Warnf("node placement profile '%s' is not defined", setting.value)
+		}
+	}
+	setting = k.getPodSecurityStandardSetting(pod, ns)
+	if setting.value != "" && operation == v1beta1.Create {
+		patches = mutatePodSecurityStandard(*pod, setting, patches)
+	}
+	if operation == v1beta1.Create {
+		automountSetting := k.getPodAutomountServiceAccountTokenSetting(pod, ns)
+		sAcc, err := k.getPodServiceAccount(pod, ns, automountSetting)
+		if err != nil {
+			k.logger.Errorln(err)
+			return k8sutil.ErrToAdmissionResponse(err)
+		}
+		if automountSetting.value != "" {
+			patches = mutatePodServiceAccountTokenMount(*pod, sAcc, automountSetting, patches)
+		}
+		setting = k.getServiceAccountTokenProjectionSetting(pod, ns)
+		if setting.value != "" && !serviceAccountTokenRemoved(*pod, sAcc, automountSetting) {
+			patches = mutatePodServiceAccountTokenProjection(*pod, k.getConfigSpec(), setting, patches)
+		}
 	}
 	return k8sutil.MutatingAdmissionResponse(patches.toBytes())
 }
 
-func (k *KarydiaAdmission) validatePod(pod *corev1.Pod, ns *corev1.Namespace) *v1beta1.AdmissionResponse {
+// validatePod checks the pod against the settings. Settings concerning
+// immutable fields of the pod spec are only checked when the pod is created,
+// as pods created before the setting changed could not be updated otherwise.
+func (k *KarydiaAdmission) validatePod(pod *corev1.Pod, ephemeralContainers []corev1.Container, profiles seccompProfiles, ns *corev1.Namespace, operation v1beta1.Operation) *v1beta1.AdmissionResponse {
+	validationErrors, err := k.podValidationErrors(pod, ephemeralContainers, profiles, ns, operation)
+	if err != nil {
+		k.logger.Errorln(err)
+		return k8sutil.ErrToAdmissionResponse(err)
+	}
+	return k8sutil.ValidatingAdmissionResponse(validationErrors)
+}
+
+func (k *KarydiaAdmission) podValidationErrors(pod *corev1.Pod, ephemeralContainers []corev1.Container, profiles seccompProfiles, ns *corev1.Namespace, operation v1beta1.Operation) ([]string, error) {
 	var validationErrors []string
 
-	setting := k.getSeccompProfileSetting(ns)
+	setting := k.getSeccompProfileSetting(pod, ns)
+	if setting.value != "" && operation == v1beta1.Create {
+		validationErrors = validatePodSeccompProfile(*pod, profiles, setting, validationErrors)
+	}
+	setting = k.getAllowedSeccompProfilesSetting(pod, ns)
+	if setting.value != "" && operation == v1beta1.Create {
+		validationErrors = validatePodAllowedSeccompProfiles(*pod, ephemeralContainers, profiles, setting, validationErrors)
+	}
+	if k.seccompProfilesAvailable() && operation == v1beta1.Create {
+		validationErrors = validatePodLocalhostSeccompProfiles(*pod, ephemeralContainers, profiles, k.seccompProfiles, k.requireDeclaredSeccompProfiles, validationErrors)
+	}
+	setting = k.getAppArmorProfileSetting(pod, ns)
+	if setting.value != "" && setting.value != "unconfined" && operation == v1beta1.Create {
+		validationErrors = validatePodAppArmorProfile(*pod, setting, validationErrors)
+	}
+	setting = k.getAllowedAppArmorProfilesSetting(pod, ns)
+	if setting.value != "" && operation == v1beta1.Create {
+		validationErrors = validatePodAllowedAppArmorProfiles(*pod, ephemeralContainers, setting, validationErrors)
+	}
+	setting = k.getSecurityContextSetting(pod, ns)
+	if setting.value != "" && setting.value != "none" && operation == v1beta1.Create {
+		if profile := k.getPodSecurityContextProfile(setting.value); profile != nil {
+			validationErrors = validatePodSecurityContext(*pod, ephemeralContainers, profile, validationErrors)
+		} else {
+			validationErrorMsg := fmt.Sprintf("pod security context profile '%s' is not defined", setting.value)
+			validationErrors = append(validationErrors, validationErrorMsg)
+		}
+	}
+	setting = k.getContainerSecurityContextSetting(pod, ns)
+	if setting.value != "" && operation == v1beta1.Create {
+		validationErrors = validatePodContainerSecurityContext(*pod, ephemeralContainers, setting, validationErrors)
+	}
+	setting = k.getCapabilitiesSetting(pod, ns)
+	if setting.value != "" && operation == v1beta1.Create {
+		validationErrors = validatePodCapabilities(*pod, ephemeralContainers, setting, validationErrors)
+	}
+	setting = k.getImageRegistriesSetting(pod, ns)
 	if setting.value != "" {
-		validationErrors = validatePodSeccompProfile(*pod, setting, validationErrors)
+		validationErrors = validatePodImageRegistries(*pod, ephemeralContainers, setting, validationErrors)
+	}
+	setting = k.getImageTagPolicySetting(pod, ns)
+	if setting.value == "pin-digest" && operation != v1beta1.Create {
+		// digests are only pinned when pods are created, as changing the
+		// image restarts the container
+		setting.value = "reject-mutable"
 	}
-	setting = k.getSecurityContextSetting(ns)
 	if setting.value != "" {
-		validationErrors = validatePodSecurityContext(*pod, setting, validationErrors)
+		validationErrors = validatePodImageTags(*pod, ephemeralContainers, setting, validationErrors)
+	}
+	setting = k.getHostIsolationSetting(pod, ns)
+	if setting.value != "" && operation == v1beta1.Create {
+		validationErrors = validatePodHostIsolation(*pod, ephemeralContainers, setting, validationErrors)
+	}
+	setting = k.getHostPathVolumesSetting(pod, ns)
+	if setting.value != "" && operation == v1beta1.Create {
+		validationErrors = validatePodHostPathVolumes(*pod, ephemeralContainers, setting, validationErrors)
+	}
+	setting = k.getSysctlsSetting(pod, ns)
+	if setting.value != "" && operation == v1beta1.Create {
+		validationErrors = validatePodSysctls(*pod, ephemeralContainers, setting, validationErrors)
+	}
+	setting = k.getRuntimeClassSetting(ns)
+	if setting.value != "" && operation == v1beta1.Create {
+		validationErrors = validatePodRuntimeClass(*pod, setting, validationErrors)
+	}
+	if operation == v1beta1.Create {
+		setting = k.getResourcesSetting(ns)
+		if setting.value == resourcesValidate {
+			validationErrors = validatePodResources(*pod, nil, validationErrors)
+		} else if setting.value != "" && setting.value != "none" {
+			if profile := k.getResourceProfile(setting.value); profile != nil {
+				validationErrors = validatePodResources(*pod, profile, validationErrors)
+			} else {
+				validationErrorMsg := fmt.Sprintf("resource profile '%s' is not defined", setting.value)
+				validationErrors = append(validationErrors, validationErrorMsg)
+			}
+		}
+	}
+	setting = k.getNodePlacementSetting(ns)
+	if setting.value != "" && setting.value != "none" && operation == v1beta1.Create {
+		if profile := k.getNodePlacementProfile(setting.value); profile != nil {
+			validationErrors = validatePodNodePlacement(*pod, profile, validationErrors)
+		} else {
+			validationErrorMsg := fmt.Sprintf("node placement profile '%s' is not defined", setting.value)
+			validationErrors = append(validationErrors, validationErrorMsg)
+		}
+	}
+	setting = k.getPodSecurityStandardSetting(pod, ns)
+	if setting.value != "" && operation == v1beta1.Create {
+		validationErrors = validatePodSecurityStandard(*pod, ephemeralContainers, profiles, setting, validationErrors)
+	}
+	setting = k.getPodAutomountServiceAccountTokenSetting(pod, ns)
+	if setting.value != "" && operation == v1beta1.Create {
+		sAcc, err := k.getPodServiceAccount(pod, ns, setting)
+		if err != nil {
+			return nil, err
+		}
+		validationErrors = validatePodServiceAccountTokenMount(*pod, sAcc, setting, validationErrors)
+	}
+	setting = k.getServiceAccountTokenProjectionSetting(pod, ns)
+	if setting.value != "" && operation == v1beta1.Create {
+		validationErrors = validatePodServiceAccountTokenProjection(*pod, setting, validationErrors)
 	}
 
-	return k8sutil.ValidatingAdmissionResponse(validationErrors)
+	return validationErrors, nil
 }
 
-func (k *KarydiaAdmission) getSeccompProfileSetting(ns *corev1.Namespace) Setting {
-	var src string
-	seccompProfile, annotated := ns.ObjectMeta.Annotations["karydia.gardener.cloud/seccompProfile"]
-	if annotated && (ns.Name == "kube-system" || (k.karydiaConfig != nil && k.karydiaConfig.Spec.Enforcement == false)) {
-		src = "namespace"
-	} else if k.karydiaConfig != nil {
-		seccompProfile = k.karydiaConfig.Spec.SeccompProfile
-		src = "config"
-	}
-	return Setting{value: seccompProfile, src: src}
+func (k *KarydiaAdmission) getSeccompProfileSetting(pod *corev1.Pod, ns *corev1.Namespace) Setting {
+	return k.getSetting("karydia.gardener.cloud/seccompProfile", pod.ObjectMeta, "pod", ns, k.getConfigSpec().SeccompProfile)
+}
+
+func (k *KarydiaAdmission) getSecurityContextSetting(pod *corev1.Pod, ns *corev1.Namespace) Setting {
+	return k.getSetting("karydia.gardener.cloud/podSecurityContext", pod.ObjectMeta, "pod", ns, k.getConfigSpec().PodSecurityContext)
 }
 
-func (k *KarydiaAdmission) getSecurityContextSetting(ns *corev1.Namespace) Setting {
-	var src string
-	securityContext, annotated := ns.ObjectMeta.Annotations["karydia.gardener.cloud/podSecurityContext"]
-	if annotated && (ns.Name == "kube-system" || (k.karydiaConfig != nil && k.karydiaConfig.Spec.Enforcement == false)) {
-		src = "namespace"
-	} else if k.karydiaConfig != nil {
-		securityContext = k.karydiaConfig.Spec.PodSecurityContext
-		src = "config"
+// nobodyProfile is the built-in pod security context profile which runs pods
+// as user and group 'nobody'
+var nobodyProfile = func() v1alpha1.PodSecurityContextProfile {
+	var nobody int64 = 65534
+	return v1alpha1.PodSecurityContextProfile{Name: "nobody", RunAsUser: &nobody, RunAsGroup: &nobody}
+}()
+
+// getPodSecurityContextProfile returns the pod security context profile with
+// the given name from the karydia config, falling back to the built-in
+// 'nobody' profile, or nil if no such profile is defined
+func (k *KarydiaAdmission) getPodSecurityContextProfile(name string) *v1alpha1.PodSecurityContextProfile {
+	return podSecurityContextProfile(k.getConfigSpec(), name)
+}
+
+func podSecurityContextProfile(spec v1alpha1.KarydiaConfigSpec, name string) *v1alpha1.PodSecurityContextProfile {
+	for _, profile := range spec.PodSecurityContextProfiles {
+		if profile.Name == name {
+			return &profile
+		}
+	}
+	if name == nobodyProfile.Name {
+		return &nobodyProfile
 	}
-	return Setting{value: securityContext, src: src}
+	return nil
+}
+
+func (k *KarydiaAdmission) getContainerSecurityContextSetting(pod *corev1.Pod, ns *corev1.Namespace) Setting {
+	return k.getSetting("karydia.gardener.cloud/containerSecurityContext", pod.ObjectMeta, "pod", ns, k.getConfigSpec().ContainerSecurityContext)
+}
+
+func (k *KarydiaAdmission) getCapabilitiesSetting(pod *corev1.Pod, ns *corev1.Namespace) Setting {
+	return k.getSetting("karydia.gardener.cloud/capabilities", pod.ObjectMeta, "pod", ns, k.getConfigSpec().Capabilities)
+}
+
+func (k *KarydiaAdmission) getHostIsolationSetting(pod *corev1.Pod, ns *corev1.Namespace) Setting {
+	return k.getSetting("karydia.gardener.cloud/hostIsolation", pod.ObjectMeta, "pod", ns, k.getConfigSpec().HostIsolation)
+}
+
+func (k *KarydiaAdmission) getHostPathVolumesSetting(pod *corev1.Pod, ns *corev1.Namespace) Setting {
+	return k.getSetting("karydia.gardener.cloud/hostPathVolumes", pod.ObjectMeta, "pod", ns, k.getConfigSpec().HostPathVolumes)
+}
+
+func (k *KarydiaAdmission) getSysctlsSetting(pod *corev1.Pod, ns *corev1.Namespace) Setting {
+	return k.getSetting("karydia.gardener.cloud/sysctls", pod.ObjectMeta, "pod", ns, k.getConfigSpec().Sysctls)
 }
 
-func validatePodSeccompProfile(pod corev1.Pod, setting Setting, validationErrors []string) []string {
-	_, ok := pod.ObjectMeta.Annotations["seccomp.security.alpha.kubernetes.io/pod"]
-	if !ok {
-		validationErrorMsg := fmt.Sprintf("seccomp profile ('seccomp.security.alpha.kubernetes.io/pod') must be '%s'", setting.value)
+// validatePodSeccompProfile checks that a seccomp profile is set for the pod
+// or for each of its (init) containers
+func validatePodSeccompProfile(pod corev1.Pod, profiles seccompProfiles, setting Setting, validationErrors []string) []string {
+	containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	containerProfiles := len(containers) > 0
+	for _, container := range containers {
+		containerProfiles = containerProfiles && profiles.ownContainerProfile(pod, container.Name) != ""
+	}
+	if profiles.podProfile(pod) == "" && !containerProfiles {
+		validationErrorMsg := fmt.Sprintf("seccomp profile ('seccomp.security.alpha.kubernetes.io/pod' or 'securityContext.seccompProfile') must be '%s'", setting.value)
 		validationErrors = append(validationErrors, validationErrorMsg)
 	}
 	return validationErrors
 }
 
-func validatePodSecurityContext(pod corev1.Pod, setting Setting, validationErrors []string) []string {
-	if setting.value == "nobody" {
+func validatePodSecurityContext(pod corev1.Pod, ephemeralContainers []corev1.Container, profile *v1alpha1.PodSecurityContextProfile, validationErrors []string) []string {
+	if profile != nil {
 		if pod.Spec.SecurityContext == nil {
 			validationErrorMsg := fmt.Sprintf("security context must be defined")
 			validationErrors = append(validationErrors, validationErrorMsg)
-		} else if pod.Spec.SecurityContext.RunAsUser == nil && pod.Spec.SecurityContext.RunAsGroup == nil {
+		} else if pod.Spec.SecurityContext.RunAsUser == nil && pod.Spec.SecurityContext.RunAsGroup == nil && (profile.RunAsUser != nil || profile.RunAsGroup != nil) {
 			validationErrorMsg := fmt.Sprintf("User or group in security context must be defined")
 			validationErrors = append(validationErrors, validationErrorMsg)
 		}
+		containers := append(append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...), ephemeralContainers...)
+		for _, container := range containers {
+			if container.SecurityContext == nil || container.SecurityContext.AllowPrivilegeEscalation == nil {
+				validationErrorMsg := fmt.Sprintf("allowPrivilegeEscalation of container '%s' must be defined", container.Name)
+				validationErrors = append(validationErrors, validationErrorMsg)
+			}
+		}
+	}
+	return validationErrors
+}
+
+// runAsNonRoot returns the runAsNonRoot value of the container, which falls
+// back to the pod security context
+func runAsNonRoot(pod corev1.Pod, container corev1.Container) *bool {
+	if container.SecurityContext != nil && container.SecurityContext.RunAsNonRoot != nil {
+		return container.SecurityContext.RunAsNonRoot
+	}
+	if pod.Spec.SecurityContext != nil {
+		return pod.Spec.SecurityContext.RunAsNonRoot
+	}
+	return nil
+}
+
+func validatePodContainerSecurityContext(pod corev1.Pod, ephemeralContainers []corev1.Container, setting Setting, validationErrors []string) []string {
+	if setting.value != "harden" && setting.value != "validate" {
+		return validationErrors
+	}
+	containers := append(append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...), ephemeralContainers...)
+	for _, container := range containers {
+		var readOnlyRootFilesystem *bool
+		if container.SecurityContext != nil {
+			readOnlyRootFilesystem = container.SecurityContext.ReadOnlyRootFilesystem
+		}
+		nonRoot := runAsNonRoot(pod, container)
+		if setting.value == "harden" {
+			if readOnlyRootFilesystem == nil {
+				validationErrorMsg := fmt.Sprintf("readOnlyRootFilesystem of container '%s' must be defined", container.Name)
+				validationErrors = append(validationErrors, validationErrorMsg)
+			}
+			if nonRoot == nil {
+				validationErrorMsg := fmt.Sprintf("runAsNonRoot of container '%s' must be defined", container.Name)
+				validationErrors = append(validationErrors, validationErrorMsg)
+			}
+		} else {
+			if readOnlyRootFilesystem == nil || !*readOnlyRootFilesystem {
+				validationErrorMsg := fmt.Sprintf("readOnlyRootFilesystem of container '%s' must be true", container.Name)
+				validationErrors = append(validationErrors, validationErrorMsg)
+			}
+			if nonRoot == nil || !*nonRoot {
+				validationErrorMsg := fmt.Sprintf("runAsNonRoot of container '%s' must be true", container.Name)
+				validationErrors = append(validationErrors, validationErrorMsg)
+			}
+		}
+	}
+	return validationErrors
+}
+
+// allowedCapabilities returns the capabilities which may be added according
+// to the capabilities setting, e.g. 'drop-all;NET_BIND_SERVICE'
+func allowedCapabilities(value string) []string {
+	var capabilities []string
+	for _, capability := range splitSetting(value) {
+		if capability != "drop-all" {
+			capabilities = append(capabilities, normalizeCapability(capability))
+		}
+	}
+	return capabilities
+}
+
+// normalizeCapability strips the optional 'CAP_' prefix of a capability
+func normalizeCapability(capability string) string {
+	return strings.TrimPrefix(strings.ToUpper(capability), "CAP_")
+}
+
+func validatePodCapabilities(pod corev1.Pod, ephemeralContainers []corev1.Container, setting Setting, validationErrors []string) []string {
+	if setting.value == "none" {
+		return validationErrors
+	}
+	allowed := allowedCapabilities(setting.value)
+	containers := append(append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...), ephemeralContainers...)
+	for _, container := range containers {
+		if container.SecurityContext == nil || container.SecurityContext.Capabilities == nil {
+			continue
+		}
+		for _, capability := range container.SecurityContext.Capabilities.Add {
+			found := false
+			for _, a := range allowed {
+				if normalizeCapability(string(capability)) == a {
+					found = true
+					break
+				}
+			}
+			if !found {
+				validationErrorMsg := fmt.Sprintf("container '%s' must not add capability '%s'", container.Name, capability)
+				validationErrors = append(validationErrors, validationErrorMsg)
+			}
+		}
+	}
+	return validationErrors
+}
+
+func validatePodHostIsolation(pod corev1.Pod, ephemeralContainers []corev1.Container, setting Setting, validationErrors []string) []string {
+	if setting.value == "restricted" {
+		if pod.Spec.HostNetwork {
+			validationErrors = append(validationErrors, "host network ('hostNetwork') must not be used")
+		}
+		if pod.Spec.HostPID {
+			validationErrors = append(validationErrors, "host PID namespace ('hostPID') must not be used")
+		}
+		if pod.Spec.HostIPC {
+			validationErrors = append(validationErrors, "host IPC namespace ('hostIPC') must not be used")
+		}
+		containers := append(append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...), ephemeralContainers...)
+		for _, container := range containers {
+			if container.SecurityContext != nil && container.SecurityContext.Privileged != nil && *container.SecurityContext.Privileged {
+				validationErrorMsg := fmt.Sprintf("container '%s' must not be privileged", container.Name)
+				validationErrors = append(validationErrors, validationErrorMsg)
+			}
+			for _, port := range container.Ports {
+				if port.HostPort != 0 {
+					validationErrorMsg := fmt.Sprintf("container '%s' must not use host port %d", container.Name, port.HostPort)
+					validationErrors = append(validationErrors, validationErrorMsg)
+				}
+			}
+		}
+	}
+	return validationErrors
+}
+
+// deniedHostPaths can never be mounted, independent of the allowed host paths
+var deniedHostPaths = []string{"/", "/proc", "/var/run/docker.sock", "/run/docker.sock"}
+
+type hostPathEntry struct {
+	prefix   string
+	readOnly bool
+}
+
+// parseHostPathEntries parses a ';'-separated list of host path prefixes,
+// each optionally suffixed with ':ro' to allow read-only mounts only
+func parseHostPathEntries(value string) []hostPathEntry {
+	var entries []hostPathEntry
+	for _, entry := range splitSetting(value) {
+		readOnly := strings.HasSuffix(entry, ":ro")
+		entries = append(entries, hostPathEntry{
+			prefix:   path.Clean(strings.TrimSuffix(entry, ":ro")),
+			readOnly: readOnly,
+		})
+	}
+	return entries
+}
+
+// hasPathPrefix reports whether p equals prefix or is located below it
+func hasPathPrefix(p string, prefix string) bool {
+	return p == prefix || prefix == "/" || strings.HasPrefix(p, prefix+"/")
+}
+
+// isDeniedHostPath reports whether the host path is one of the always denied
+// paths, contains one of them (e.g. '/var/run') or is located below '/proc'
+func isDeniedHostPath(p string) bool {
+	for _, denied := range deniedHostPaths {
+		if hasPathPrefix(denied, p) {
+			return true
+		}
+	}
+	return hasPathPrefix(p, "/proc")
+}
+
+func validatePodHostPathVolumes(pod corev1.Pod, ephemeralContainers []corev1.Container, setting Setting, validationErrors []string) []string {
+	if setting.value == "none" {
+		return validationErrors
+	}
+	entries := parseHostPathEntries(setting.value)
+	if setting.value == "deny" {
+		entries = nil
+	}
+
+	containers := append(append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...), ephemeralContainers...)
+	for _, volume := range pod.Spec.Volumes {
+		if volume.HostPath == nil {
+			continue
+		}
+		hostPath := path.Clean(volume.HostPath.Path)
+		if isDeniedHostPath(hostPath) {
+			validationErrorMsg := fmt.Sprintf("host path '%s' of volume '%s' must not be mounted", volume.HostPath.Path, volume.Name)
+			validationErrors = append(validationErrors, validationErrorMsg)
+			continue
+		}
+
+		var entry *hostPathEntry
+		for i := range entries {
+			// prefer read-write entries if the path matches multiple ones
+			if hasPathPrefix(hostPath, entries[i].prefix) && (entry == nil || entry.readOnly) {
+				entry = &entries[i]
+			}
+		}
+		if entry == nil {
+			validationErrorMsg := fmt.Sprintf("host path '%s' of volume '%s' is not allowed", volume.HostPath.Path, volume.Name)
+			validationErrors = append(validationErrors, validationErrorMsg)
+			continue
+		}
+		if !entry.readOnly {
+			continue
+		}
+		for _, container := range containers {
+			for _, mount := range container.VolumeMounts {
+				if mount.Name == volume.Name && !mount.ReadOnly {
+					validationErrorMsg := fmt.Sprintf("host path '%s' of volume '%s' must be mounted read-only in container '%s'", volume.HostPath.Path, volume.Name, container.Name)
+					validationErrors = append(validationErrors, validationErrorMsg)
+				}
+			}
+		}
+	}
+	return validationErrors
+}
+
+// sysctlAllowed reports whether the sysctl is a safe sysctl or matches one of
+// the allowed sysctls. An allowed sysctl ending with '*' matches all sysctls
+// with the same prefix, e.g. 'net.core.*'.
+func sysctlAllowed(name string, allowed []string) bool {
+	// sysctls may also be written with '/' as separator
+	name = strings.Replace(name, "/", ".", -1)
+	if contains(safeSysctls, name) {
+		return true
+	}
+	for _, a := range allowed {
+		if name == a || strings.HasSuffix(a, "*") && strings.HasPrefix(name, strings.TrimSuffix(a, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedSysctls returns the sysctls allowed by the setting in addition to
+// the safe sysctls
+func allowedSysctls(value string) []string {
+	var sysctls []string
+	for _, sysctl := range splitSetting(value) {
+		if sysctl != "safe" {
+			sysctls = append(sysctls, sysctl)
+		}
+	}
+	return sysctls
+}
+
+// validatePodSysctls rejects pods setting sysctls which are neither safe nor
+// allowed by the setting and (init or ephemeral) containers using a non-default
+// /proc mount type
+func validatePodSysctls(pod corev1.Pod, ephemeralContainers []corev1.Container, setting Setting, validationErrors []string) []string {
+	if setting.value == "none" {
+		return validationErrors
+	}
+	allowed := allowedSysctls(setting.value)
+	if pod.Spec.SecurityContext != nil {
+		for _, sysctl := range pod.Spec.SecurityContext.Sysctls {
+			if sysctlAllowed(sysctl.Name, allowed) {
+				continue
+			}
+			validationErrorMsg := fmt.Sprintf("sysctl '%s' must not be set (only safe sysctls are allowed)", sysctl.Name)
+			if len(allowed) > 0 {
+				validationErrorMsg = fmt.Sprintf("sysctl '%s' must not be set (allowed are the safe sysctls and '%s')", sysctl.Name, strings.Join(allowed, settingDelimiter))
+			}
+			validationErrors = append(validationErrors, validationErrorMsg)
+		}
+	}
+	containers := append(append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...), ephemeralContainers...)
+	for _, container := range containers {
+		if secCtx := container.SecurityContext; secCtx != nil && secCtx.ProcMount != nil && *secCtx.ProcMount != corev1.DefaultProcMount {
+			validationErrorMsg := fmt.Sprintf("container '%s' must use the default /proc mount type", container.Name)
+			validationErrors = append(validationErrors, validationErrorMsg)
+		}
 	}
 	return validationErrors
 }
 
-func mutatePodSeccompProfile(pod corev1.Pod, setting Setting, patches Patches) Patches {
-	_, ok := pod.ObjectMeta.Annotations["seccomp.security.alpha.kubernetes.io/pod"]
-	if !ok {
-		annotatePod(pod, &patches, "seccomp.security.alpha.kubernetes.io/pod", setting.value)
+// mutatePodSeccompProfile applies the seccomp profile to pods without a pod
+// seccomp profile, either as annotation or as 'securityContext.seccompProfile'
+// field (Kubernetes >= 1.19). Container seccomp profiles take precedence over
+// the pod profile and are kept.
+func mutatePodSeccompProfile(pod corev1.Pod, profiles seccompProfiles, setting Setting, field bool, patches Patches) Patches {
+	if profiles.podProfile(pod) == "" {
+		if field {
+			addSecurityContextFields(pod.Spec.SecurityContext != nil, "/spec", []securityContextField{{"seccompProfile", newSeccompProfileField(setting.value)}}, &patches)
+		} else {
+			annotatePod(pod, &patches, seccompPodAnnotation, setting.value)
+		}
 		annotatePod(pod, &patches, "karydia.gardener.cloud/seccompProfile.internal", setting.src+"/"+setting.value)
 	}
 	return patches
 }
 
-func mutatePodSecurityContext(pod corev1.Pod, setting Setting, patches Patches) Patches {
-	if setting.value == "nobody" {
-		var uid int64 = 65534
-		var gid int64 = 65534
-		var privilegeEscalation = false
+// mutatePodSecurityContext applies the fields of the pod security context
+// profile which are not defined in the pod. User and group are only applied
+// if both are undefined.
+func mutatePodSecurityContext(pod corev1.Pod, setting Setting, profile *v1alpha1.PodSecurityContextProfile, patches Patches) Patches {
+	if profile != nil {
+		var fields []securityContextField
+		addField := func(field string, value interface{}) {
+			fields = append(fields, securityContextField{field, value})
+		}
 		secCtx := pod.Spec.SecurityContext
 		if secCtx == nil {
-			patches.operations = append(patches.operations, patchOperation{
-				Op:   "add",
-				Path: "/spec/securityContext",
-				Value: corev1.SecurityContext{
-					RunAsUser:  &uid,
-					RunAsGroup: &gid,
-				},
-			})
+			secCtx = &corev1.PodSecurityContext{}
+		}
+		if secCtx.RunAsUser == nil && secCtx.RunAsGroup == nil {
+			if profile.RunAsUser != nil {
+				addField("runAsUser", *profile.RunAsUser)
+			}
+			if profile.RunAsGroup != nil {
+				addField("runAsGroup", *profile.RunAsGroup)
+			}
+		}
+		if secCtx.RunAsNonRoot == nil && profile.RunAsNonRoot != nil {
+			addField("runAsNonRoot", *profile.RunAsNonRoot)
+		}
+		if secCtx.FSGroup == nil && profile.FSGroup != nil {
+			addField("fsGroup", *profile.FSGroup)
+		}
+		if len(secCtx.SupplementalGroups) == 0 && len(profile.SupplementalGroups) > 0 {
+			addField("supplementalGroups", profile.SupplementalGroups)
+		}
+		if len(secCtx.Sysctls) == 0 && len(profile.Sysctls) > 0 {
+			addField("sysctls", profile.Sysctls)
+		}
+
+		if len(fields) > 0 {
+			addSecurityContextFields(pod.Spec.SecurityContext != nil, "/spec", fields, &patches)
 			annotatePod(pod, &patches, "karydia.gardener.cloud/podSecurityContext.internal", setting.src+"/"+setting.value)
-		} else if secCtx.RunAsUser == nil && secCtx.RunAsGroup == nil {
-			patches.operations = append(patches.operations, patchOperation{
-				Op:    "add",
-				Path:  "/spec/securityContext/runAsUser",
-				Value: uid,
-			})
+		}
+		defaultContainers(pod, pod.Spec.InitContainers, "/spec/initContainers", &patches, defaultAllowPrivilegeEscalation)
+		defaultContainers(pod, pod.Spec.Containers, "/spec/containers", &patches, defaultAllowPrivilegeEscalation)
+	}
+	return patches
+}
+
+func mutatePodContainerSecurityContext(pod corev1.Pod, setting Setting, patches Patches) Patches {
+	if setting.value == "harden" {
+		mutated := defaultContainers(pod, pod.Spec.InitContainers, "/spec/initContainers", &patches, hardenContainer)
+		mutated = defaultContainers(pod, pod.Spec.Containers, "/spec/containers", &patches, hardenContainer) || mutated
+		if mutated {
+			annotatePod(pod, &patches, "karydia.gardener.cloud/containerSecurityContext.internal", setting.src+"/"+setting.value)
+		}
+	}
+	return patches
+}
+
+func mutatePodCapabilities(pod corev1.Pod, setting Setting, patches Patches) Patches {
+	if setting.value != "none" {
+		mutated := defaultContainers(pod, pod.Spec.InitContainers, "/spec/initContainers", &patches, dropCapabilities)
+		mutated = defaultContainers(pod, pod.Spec.Containers, "/spec/containers", &patches, dropCapabilities) || mutated
+		if mutated {
+			annotatePod(pod, &patches, "karydia.gardener.cloud/capabilities.internal", setting.src+"/"+setting.value)
+		}
+	}
+	return patches
+}
+
+// mutatePodHostIsolation sets 'privileged' to false for (init) containers
+// which do not specify it. Host namespaces are not removed, as the workload
+// would silently run on the pod network instead, but rejected by validation.
+func mutatePodHostIsolation(pod corev1.Pod, setting Setting, patches Patches) Patches {
+	if setting.value == "restricted" {
+		mutated := defaultContainers(pod, pod.Spec.InitContainers, "/spec/initContainers", &patches, defaultPrivileged)
+		mutated = defaultContainers(pod, pod.Spec.Containers, "/spec/containers", &patches, defaultPrivileged) || mutated
+		if mutated {
+			annotatePod(pod, &patches, "karydia.gardener.cloud/hostIsolation.internal", setting.src+"/"+setting.value)
+		}
+	}
+	return patches
+}
+
+// defaultContainers applies the defaulting function to all given containers
+// of the pod, which are located at the given path, and reports whether any
+// container has been mutated
+func defaultContainers(pod corev1.Pod, containers []corev1.Container, path string, patches *Patches, defaultContainer func(pod corev1.Pod, container corev1.Container, path string, patches *Patches) bool) bool {
+	mutated := false
+	for i, container := range containers {
+		mutated = defaultContainer(pod, container, path+"/"+strconv.Itoa(i), patches) || mutated
+	}
+	return mutated
+}
+
+/* Defaulting functions for the security context of a single container, which
+ * is located at the given path. They report whether the container has been
+ * mutated.
+ */
+func defaultAllowPrivilegeEscalation(pod corev1.Pod, container corev1.Container, path string, patches *Patches) bool {
+	var privilegeEscalation = false
+	if container.SecurityContext == nil || container.SecurityContext.AllowPrivilegeEscalation == nil {
+		addContainerSecurityContextField(container, path, "allowPrivilegeEscalation", privilegeEscalation, patches)
+		return true
+	}
+	return false
+}
+
+func hardenContainer(pod corev1.Pod, container corev1.Container, path string, patches *Patches) bool {
+	var readOnlyRootFilesystem = true
+	mutated := false
+	if container.SecurityContext == nil || container.SecurityContext.ReadOnlyRootFilesystem == nil {
+		addContainerSecurityContextField(container, path, "readOnlyRootFilesystem", readOnlyRootFilesystem, patches)
+		mutated = true
+	}
+	return defaultRunAsNonRoot(pod, container, path, patches) || mutated
+}
+
+func defaultRunAsNonRoot(pod corev1.Pod, container corev1.Container, path string, patches *Patches) bool {
+	var nonRoot = true
+	if runAsNonRoot(pod, container) == nil {
+		addContainerSecurityContextField(container, path, "runAsNonRoot", nonRoot, patches)
+		return true
+	}
+	return false
+}
+
+func dropCapabilities(pod corev1.Pod, container corev1.Container, path string, patches *Patches) bool {
+	capabilities := corev1.Capabilities{Drop: []corev1.Capability{"ALL"}}
+	if container.SecurityContext == nil || container.SecurityContext.Capabilities == nil {
+		addContainerSecurityContextField(container, path, "capabilities", capabilities, patches)
+		return true
+	}
+	return false
+}
+
+func defaultPrivileged(pod corev1.Pod, container corev1.Container, path string, patches *Patches) bool {
+	var privileged = false
+	if container.SecurityContext == nil || container.SecurityContext.Privileged == nil {
+		addContainerSecurityContextField(container, path, "privileged", privileged, patches)
+		return true
+	}
+	return false
+}
+
+// addContainerSecurityContextField adds a field to the security context of
+// the container at the given path
+func addContainerSecurityContextField(container corev1.Container, path string, field string, value interface{}, patches *Patches) {
+	addSecurityContextFields(container.SecurityContext != nil, path, []securityContextField{{field, value}}, patches)
+}
+
+type securityContextField struct {
+	name  string
+	value interface{}
+}
+
+// addSecurityContextFields adds fields to the security context of the pod
+// spec or container at the given path. The security context is created if it
+// is neither defined nor added by a previous patch. Fields which have already
+// been added by a previous patch are skipped.
+func addSecurityContextFields(defined bool, path string, fields []securityContextField, patches *Patches) {
+	if patches.securityContexts == nil {
+		patches.securityContexts = make(map[string]bool)
+	}
+	var newFields []securityContextField
+	for _, field := range fields {
+		fieldPath := path + "/securityContext/" + field.name
+		if !patches.securityContexts[fieldPath] {
+			patches.securityContexts[fieldPath] = true
+			newFields = append(newFields, field)
+		}
+	}
+	if len(newFields) == 0 {
+		return
+	}
+	if !defined && !patches.securityContexts[path] {
+		value := make(map[string]interface{}, len(newFields))
+		for _, field := range newFields {
+			value[field.name] = field.value
+		}
+		patches.operations = append(patches.operations, patchOperation{
+			Op:    "add",
+			Path:  path + "/securityContext",
+			Value: value,
+		})
+		patches.securityContexts[path] = true
+	} else {
+		for _, field := range newFields {
 			patches.operations = append(patches.operations, patchOperation{
 				Op:    "add",
-				Path:  "/spec/securityContext/runAsGroup",
-				Value: gid,
+				Path:  path + "/securityContext/" + field.name,
+				Value: field.value,
 			})
-			annotatePod(pod, &patches, "karydia.gardener.cloud/podSecurityContext.internal", setting.src+"/"+setting.value)
-		}
-		containers := pod.Spec.Containers
-		for i := range containers {
-			secCtxContainers := pod.Spec.Containers[i].SecurityContext
-			if secCtxContainers == nil {
-				patches.operations = append(patches.operations, patchOperation{
-					Op:   "add",
-					Path: "/spec/containers/" + strconv.Itoa(i) + "/securityContext",
-					Value: corev1.SecurityContext{
-						AllowPrivilegeEscalation: &privilegeEscalation,
-					},
-				})
-			} else if secCtxContainers.AllowPrivilegeEscalation == nil {
-				patches.operations = append(patches.operations, patchOperation{
-					Op:    "add",
-					Path:  "/spec/containers/" + strconv.Itoa(i) + "/securityContext/allowPrivilegeEscalation",
-					Value: privilegeEscalation,
-				})
-			}
 		}
 	}
-	return patches
 }
 
 /* Utility functions to decode raw resources into objects */
@@ -174,8 +808,28 @@ func decodePod(raw []byte) (*corev1.Pod, error) {
 	return pod, nil
 }
 
+// Ephemeral containers are not part of the vendored core/v1 API, thus they
+// are decoded separately. The common container fields are sufficient for
+// karydia.
+func decodeEphemeralContainers(raw []byte) ([]corev1.Container, error) {
+	pod := struct {
+		Spec struct {
+			EphemeralContainers []corev1.Container `json:"ephemeralContainers"`
+		} `json:"spec"`
+	}{}
+	if err := json.Unmarshal(raw, &pod); err != nil {
+		return nil, err
+	}
+	return pod.Spec.EphemeralContainers, nil
+}
+
 func annotatePod(resource corev1.Pod, patches *Patches, key string, value string) {
-	if len(resource.ObjectMeta.Annotations) == 0 && !patches.annotated {
+	annotateObject(resource.ObjectMeta, patches, key, value)
+}
+
+// annotateObject adds the annotation to the object the patches apply to
+func annotateObject(obj metav1.ObjectMeta, patches *Patches, key string, value string) {
+	if len(obj.Annotations) == 0 && !patches.annotated {
 		patches.operations = append(patches.operations, patchOperation{
 			Op:   "add",
 			Path: "/metadata/annotations",
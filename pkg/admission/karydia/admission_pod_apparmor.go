@@ -0,0 +1,78 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package karydia
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const appArmorContainerAnnotationPrefix = "container.apparmor.security.beta.kubernetes.io/"
+
+func (k *KarydiaAdmission) getAppArmorProfileSetting(pod *corev1.Pod, ns *corev1.Namespace) Setting {
+	return k.getSetting("karydia.gardener.cloud/appArmorProfile", pod.ObjectMeta, "pod", ns, k.getConfigSpec().AppArmorProfile)
+}
+
+func (k *KarydiaAdmission) getAllowedAppArmorProfilesSetting(pod *corev1.Pod, ns *corev1.Namespace) Setting {
+	return k.getSetting("karydia.gardener.cloud/allowedAppArmorProfiles", pod.ObjectMeta, "pod", ns, k.getConfigSpec().AllowedAppArmorProfiles)
+}
+
+// mutatePodAppArmorProfile applies the AppArmor profile to all (init)
+// containers which do not specify a profile
+func mutatePodAppArmorProfile(pod corev1.Pod, setting Setting, patches Patches) Patches {
+	mutated := false
+	containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, container := range containers {
+		if _, ok := pod.ObjectMeta.Annotations[appArmorContainerAnnotationPrefix+container.Name]; !ok {
+			annotatePod(pod, &patches, appArmorContainerAnnotationPrefix+container.Name, setting.value)
+			mutated = true
+		}
+	}
+	if mutated {
+		annotatePod(pod, &patches, "karydia.gardener.cloud/appArmorProfile.internal", setting.src+"/"+setting.value)
+	}
+	return patches
+}
+
+// validatePodAppArmorProfile checks that an AppArmor profile is set for each
+// (init) container
+func validatePodAppArmorProfile(pod corev1.Pod, setting Setting, validationErrors []string) []string {
+	containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, container := range containers {
+		if _, ok := pod.ObjectMeta.Annotations[appArmorContainerAnnotationPrefix+container.Name]; !ok {
+			validationErrorMsg := fmt.Sprintf("AppArmor profile ('%s%s') must be '%s'", appArmorContainerAnnotationPrefix, container.Name, setting.value)
+			validationErrors = append(validationErrors, validationErrorMsg)
+		}
+	}
+	return validationErrors
+}
+
+// validatePodAllowedAppArmorProfiles checks the AppArmor profiles set for the
+// (init or ephemeral) containers against the allowed profiles
+func validatePodAllowedAppArmorProfiles(pod corev1.Pod, ephemeralContainers []corev1.Container, setting Setting, validationErrors []string) []string {
+	allowed := splitSetting(setting.value)
+	containers := append(append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...), ephemeralContainers...)
+	for _, container := range containers {
+		if profile, ok := pod.ObjectMeta.Annotations[appArmorContainerAnnotationPrefix+container.Name]; ok && !profileAllowed(profile, allowed) {
+			validationErrorMsg := fmt.Sprintf("AppArmor profile '%s' of container '%s' must be one of '%s'", profile, container.Name, strings.Join(allowed, "', '"))
+			validationErrors = append(validationErrors, validationErrorMsg)
+		}
+	}
+	return validationErrors
+}
@@ -0,0 +1,185 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package karydia
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/karydia/karydia/pkg/k8sutil"
+)
+
+const ephemeralContainersSubResource = "ephemeralcontainers"
+
+// admitEphemeralContainers handles requests to the 'pods/ephemeralcontainers'
+// subresource. Depending on the Kubernetes version, the admitted object is
+// either the pod itself or an 'EphemeralContainers' object.
+func (k *KarydiaAdmission) admitEphemeralContainers(req v1beta1.AdmissionRequest, ns *corev1.Namespace, mutationAllowed bool) *v1beta1.AdmissionResponse {
+	var pod *corev1.Pod
+	var ephemeralContainers, oldEphemeralContainers []corev1.Container
+	var profiles seccompProfiles
+	var path string
+	var err error
+
+	switch req.Kind {
+	case kindPod:
+		path = "/spec/ephemeralContainers"
+		if pod, err = decodePod(req.Object.Raw); err == nil {
+			if ephemeralContainers, err = decodeEphemeralContainers(req.Object.Raw); err == nil && len(req.OldObject.Raw) > 0 {
+				oldEphemeralContainers, err = decodeEphemeralContainers(req.OldObject.Raw)
+			}
+		}
+		if err == nil {
+			profiles, err = decodeSeccompProfiles(req.Object.Raw)
+		}
+	case kindEphemeralContainers:
+		path = "/ephemeralContainers"
+		if ephemeralContainers, err = decodeEphemeralContainersSubResource(req.Object.Raw); err == nil && len(req.OldObject.Raw) > 0 {
+			oldEphemeralContainers, err = decodeEphemeralContainersSubResource(req.OldObject.Raw)
+		}
+		if err == nil {
+			profiles, err = decodeEphemeralContainersSeccompProfiles(req.Object.Raw)
+		}
+	default:
+		return k8sutil.AllowAdmissionResponse()
+	}
+	if err != nil {
+		k.logger.Errorln("failed to decode object:", err)
+		return k8sutil.ErrToAdmissionResponse(err)
+	}
+	if pod == nil {
+		// the seccomp profile fields of the pod are lost when getting the pod
+		// with the vendored API, but they are synced to the seccomp
+		// annotations by Kubernetes < 1.27 which still serve the
+		// 'EphemeralContainers' object. The profiles of the ephemeral
+		// containers are decoded from the object itself.
+		pod, err = k.kubeClientset.CoreV1().Pods(req.Namespace).Get(req.Name, metav1.GetOptions{})
+		if err != nil {
+			e := fmt.Errorf("failed to get pod of ephemeral containers: %v", err)
+			k.logger.Errorln(e)
+			return k8sutil.ErrToAdmissionResponse(e)
+		}
+	}
+
+	if mutationAllowed {
+		return k.mutateEphemeralContainers(pod, ephemeralContainers, oldEphemeralContainers, path, ns)
+	}
+	return k.validateEphemeralContainers(pod, ephemeralContainers, oldEphemeralContainers, profiles, ns)
+}
+
+// mutateEphemeralContainers applies the container security context defaults
+// to newly added ephemeral containers and pins their images to digests.
+// Existing ephemeral containers must not be changed and annotations of the
+// pod can not be updated through the subresource, so no '.internal'
+// annotations are added.
+func (k *KarydiaAdmission) mutateEphemeralContainers(pod *corev1.Pod, ephemeralContainers []corev1.Container, oldEphemeralContainers []corev1.Container, path string, ns *corev1.Namespace) *v1beta1.AdmissionResponse {
+	var patches Patches
+
+	existing := make(map[string]bool, len(oldEphemeralContainers))
+	for _, container := range oldEphemeralContainers {
+		existing[container.Name] = true
+	}
+	mutate := func(defaultContainer func(pod corev1.Pod, container corev1.Container, path string, patches *Patches) bool) {
+		for i, container := range ephemeralContainers {
+			if !existing[container.Name] {
+				defaultContainer(*pod, container, path+"/"+strconv.Itoa(i), &patches)
+			}
+		}
+	}
+
+	if setting := k.getSecurityContextSetting(pod, ns); setting.value != "" && setting.value != "none" {
+		mutate(defaultAllowPrivilegeEscalation)
+	}
+	if setting := k.getContainerSecurityContextSetting(pod, ns); setting.value == "harden" {
+		mutate(hardenContainer)
+	}
+	if setting := k.getCapabilitiesSetting(pod, ns); setting.value != "" && setting.value != "none" {
+		mutate(dropCapabilities)
+	}
+	if setting := k.getHostIsolationSetting(pod, ns); setting.value == "restricted" {
+		mutate(defaultPrivileged)
+	}
+	if setting := k.getPodSecurityStandardSetting(pod, ns); setting.value == podSecurityStandardRestricted {
+		for _, defaultContainer := range podSecurityStandardDefaults {
+			mutate(defaultContainer)
+		}
+	}
+	if setting := k.getImageTagPolicySetting(pod, ns); setting.value == "pin-digest" && k.digestResolver != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), imageDigestTimeout)
+		defer cancel()
+		registries := k.getImageRegistriesSetting(pod, ns)
+		mutate(func(pod corev1.Pod, container corev1.Container, path string, patches *Patches) bool {
+			return k.pinImage(ctx, container, registries, path, patches)
+		})
+	}
+	return k8sutil.MutatingAdmissionResponse(patches.toBytes())
+}
+
+// validateEphemeralContainers only rejects newly added ephemeral containers.
+// Violations of the pod itself, e.g. of settings tightened after the pod was
+// created, are ignored, so debug containers can still be attached to it.
+func (k *KarydiaAdmission) validateEphemeralContainers(pod *corev1.Pod, ephemeralContainers []corev1.Container, oldEphemeralContainers []corev1.Container, profiles seccompProfiles, ns *corev1.Namespace) *v1beta1.AdmissionResponse {
+	existing := make(map[string]bool, len(oldEphemeralContainers))
+	for _, container := range oldEphemeralContainers {
+		existing[container.Name] = true
+	}
+	var newEphemeralContainers []corev1.Container
+	for _, container := range ephemeralContainers {
+		if !existing[container.Name] {
+			newEphemeralContainers = append(newEphemeralContainers, container)
+		}
+	}
+
+	if len(newEphemeralContainers) == 0 {
+		return k8sutil.AllowAdmissionResponse()
+	}
+
+	podValidationErrors, err := k.podValidationErrors(pod, nil, profiles, ns, v1beta1.Create)
+	if err != nil {
+		k.logger.Errorln(err)
+		return k8sutil.ErrToAdmissionResponse(err)
+	}
+	allValidationErrors, err := k.podValidationErrors(pod, newEphemeralContainers, profiles, ns, v1beta1.Create)
+	if err != nil {
+		k.logger.Errorln(err)
+		return k8sutil.ErrToAdmissionResponse(err)
+	}
+	var validationErrors []string
+	for _, validationError := range allValidationErrors {
+		if !contains(podValidationErrors, validationError) {
+			validationErrors = append(validationErrors, validationError)
+		}
+	}
+	return k8sutil.ValidatingAdmissionResponse(validationErrors)
+}
+
+/* Utility functions to decode raw resources into objects */
+func decodeEphemeralContainersSubResource(raw []byte) ([]corev1.Container, error) {
+	obj := struct {
+		EphemeralContainers []corev1.Container `json:"ephemeralContainers"`
+	}{}
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, err
+	}
+	return obj.EphemeralContainers, nil
+}
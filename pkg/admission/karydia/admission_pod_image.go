@@ -0,0 +1,187 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package karydia
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const defaultImageRegistry = "docker.io"
+
+// imageDigestTimeout bounds the time spent resolving the digests of all
+// images of a pod, which has to stay below the timeout of the webhook
+const imageDigestTimeout = 5 * time.Second
+
+type imageReference struct {
+	registry   string
+	repository string
+	tag        string
+	digest     string
+}
+
+// parseImage splits an image reference into its parts and applies the same
+// defaults as docker, e.g. 'nginx' becomes 'docker.io/library/nginx'
+func parseImage(image string) imageReference {
+	var ref imageReference
+
+	if i := strings.Index(image, "@"); i >= 0 {
+		ref.digest = image[i+1:]
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i >= 0 && !strings.Contains(image[i+1:], "/") {
+		ref.tag = image[i+1:]
+		image = image[:i]
+	}
+
+	i := strings.Index(image, "/")
+	if i < 0 || !strings.ContainsAny(image[:i], ".:") && image[:i] != "localhost" {
+		ref.registry = defaultImageRegistry
+		ref.repository = image
+	} else {
+		ref.registry = image[:i]
+		ref.repository = image[i+1:]
+	}
+	if ref.registry == defaultImageRegistry && !strings.Contains(ref.repository, "/") {
+		ref.repository = "library/" + ref.repository
+	}
+	return ref
+}
+
+func (ref imageReference) name() string {
+	return ref.registry + "/" + ref.repository
+}
+
+func (k *KarydiaAdmission) getImageRegistriesSetting(pod *corev1.Pod, ns *corev1.Namespace) Setting {
+	return k.getSetting("karydia.gardener.cloud/imageRegistries", pod.ObjectMeta, "pod", ns, k.getConfigSpec().ImageRegistries)
+}
+
+func validatePodImageRegistries(pod corev1.Pod, ephemeralContainers []corev1.Container, setting Setting, validationErrors []string) []string {
+	registries := splitSetting(setting.value)
+	containers := append(append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...), ephemeralContainers...)
+	for _, container := range containers {
+		if !imageRegistryAllowed(container.Image, registries) {
+			validationErrorMsg := fmt.Sprintf("image '%s' of container '%s' must be pulled from one of the registries '%s'", container.Image, container.Name, strings.Join(registries, "', '"))
+			validationErrors = append(validationErrors, validationErrorMsg)
+		}
+	}
+	return validationErrors
+}
+
+// imageRegistryAllowed reports whether the image is located in one of the
+// given registries. A registry can be restricted to a repository prefix,
+// e.g. 'gcr.io/my-project'.
+func imageRegistryAllowed(image string, registries []string) bool {
+	name := parseImage(image).name()
+	for _, registry := range registries {
+		registry = strings.TrimSuffix(registry, "/")
+		if name == registry || strings.HasPrefix(name, registry+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (k *KarydiaAdmission) getImageTagPolicySetting(pod *corev1.Pod, ns *corev1.Namespace) Setting {
+	return k.getSetting("karydia.gardener.cloud/imageTagPolicy", pod.ObjectMeta, "pod", ns, k.getConfigSpec().ImageTagPolicy)
+}
+
+// isMutableImage reports whether the image is referenced without digest
+// and with the 'latest' or without tag
+func isMutableImage(ref imageReference) bool {
+	return ref.digest == "" && (ref.tag == "" || ref.tag == "latest")
+}
+
+func validatePodImageTags(pod corev1.Pod, ephemeralContainers []corev1.Container, setting Setting, validationErrors []string) []string {
+	containers := append(append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...), ephemeralContainers...)
+	for _, container := range containers {
+		ref := parseImage(container.Image)
+		if setting.value == "reject-mutable" && isMutableImage(ref) {
+			validationErrorMsg := fmt.Sprintf("image '%s' of container '%s' must have a tag other than 'latest' or a digest", container.Image, container.Name)
+			validationErrors = append(validationErrors, validationErrorMsg)
+		} else if setting.value == "pin-digest" && ref.digest == "" {
+			validationErrorMsg := fmt.Sprintf("image '%s' of container '%s' must be pinned to a digest", container.Image, container.Name)
+			validationErrors = append(validationErrors, validationErrorMsg)
+		}
+	}
+	return validationErrors
+}
+
+// mutatePodImageTags pins the tags of all (init) container images to the
+// digests resolved by the digest resolver. Only images of the allowed
+// registries are resolved, if registries are configured. Images which cannot
+// be resolved are left as they are and rejected by the validation.
+func (k *KarydiaAdmission) mutatePodImageTags(pod corev1.Pod, registries Setting, setting Setting, patches Patches) Patches {
+	if setting.value != "pin-digest" {
+		return patches
+	}
+	if k.digestResolver == nil {
+		k.logger.Warnln("image tag policy 'pin-digest' requires a digest resolver")
+		return patches
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), imageDigestTimeout)
+	defer cancel()
+
+	pinned := false
+	pinImages := func(containers []corev1.Container, path string) {
+		for i, container := range containers {
+			if k.pinImage(ctx, container, registries, path+"/"+strconv.Itoa(i), &patches) {
+				pinned = true
+			}
+		}
+	}
+	pinImages(pod.Spec.InitContainers, "/spec/initContainers")
+	pinImages(pod.Spec.Containers, "/spec/containers")
+
+	if pinned {
+		annotatePod(pod, &patches, "karydia.gardener.cloud/imageTagPolicy.internal", setting.src+"/"+setting.value)
+	}
+	return patches
+}
+
+// pinImage pins the image of the container at the given path to the digest
+// resolved by the digest resolver. It reports whether the image was pinned.
+func (k *KarydiaAdmission) pinImage(ctx context.Context, container corev1.Container, registries Setting, path string, patches *Patches) bool {
+	ref := parseImage(container.Image)
+	if ref.digest != "" {
+		return false
+	}
+	if registries.value != "" && !imageRegistryAllowed(container.Image, splitSetting(registries.value)) {
+		return false
+	}
+	tag := ref.tag
+	if tag == "" {
+		tag = "latest"
+	}
+	digest, err := k.digestResolver.Resolve(ctx, ref.registry, ref.repository, tag)
+	if err != nil {
+		k.logger.Errorf("failed to resolve digest of image '%s': %v", container.Image, err)
+		return false
+	}
+	patches.operations = append(patches.operations, patchOperation{
+		Op:    "replace",
+		Path:  path + "/image",
+		Value: container.Image + "@" + digest,
+	})
+	return true
+}
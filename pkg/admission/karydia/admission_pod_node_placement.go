@@ -0,0 +1,217 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package karydia
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/karydia/karydia/pkg/apis/karydia/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const requiredNodeAffinityPath = "/spec/affinity/nodeAffinity/requiredDuringSchedulingIgnoredDuringExecution"
+
+// nodeConditionTolerationKeys are the taints of node conditions, which
+// Kubernetes tolerates for pods by default (e.g. 'not-ready' and
+// 'unreachable') or for daemon set pods. They are always allowed.
+var nodeConditionTolerationKeys = []string{
+	"node.kubernetes.io/not-ready",
+	"node.kubernetes.io/unreachable",
+	"node.kubernetes.io/disk-pressure",
+	"node.kubernetes.io/memory-pressure",
+	"node.kubernetes.io/pid-pressure",
+	"node.kubernetes.io/unschedulable",
+	"node.kubernetes.io/network-unavailable",
+}
+
+// getNodePlacementSetting only considers the namespace annotation as tenants
+// must not be able to leave their nodes with pod annotations
+func (k *KarydiaAdmission) getNodePlacementSetting(ns *corev1.Namespace) Setting {
+	return k.getSetting("karydia.gardener.cloud/nodePlacement", ns.ObjectMeta, "namespace", ns, valueForNamespace(k.getConfigSpec().NodePlacement, ns.Name))
+}
+
+func (k *KarydiaAdmission) getNodePlacementProfile(name string) *v1alpha1.NodePlacementProfile {
+	for _, profile := range k.getConfigSpec().NodePlacementProfiles {
+		if profile.Name == name {
+			return &profile
+		}
+	}
+	return nil
+}
+
+// mutatePodNodePlacement merges the node selector of the profile into the
+// node selector of the pod and adds the node affinity of the profile to all
+// required node affinity terms of the pod
+func mutatePodNodePlacement(pod corev1.Pod, setting Setting, profile *v1alpha1.NodePlacementProfile, patches Patches) Patches {
+	mutated := false
+
+	if len(pod.Spec.NodeSelector) == 0 && len(profile.NodeSelector) > 0 {
+		patches.operations = append(patches.operations, patchOperation{Op: "add", Path: "/spec/nodeSelector", Value: profile.NodeSelector})
+		mutated = true
+	} else {
+		var keys []string
+		for key := range profile.NodeSelector {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if value, ok := pod.Spec.NodeSelector[key]; ok && value == profile.NodeSelector[key] {
+				continue
+			}
+			patches.operations = append(patches.operations, patchOperation{Op: "add", Path: "/spec/nodeSelector/" + strings.Replace(strings.Replace(key, "~", "~0", -1), "/", "~1", -1), Value: profile.NodeSelector[key]})
+			mutated = true
+		}
+	}
+
+	if len(profile.NodeAffinity) > 0 {
+		affinity := pod.Spec.Affinity
+		required := &corev1.NodeSelector{NodeSelectorTerms: []corev1.NodeSelectorTerm{{MatchExpressions: profile.NodeAffinity}}}
+		switch {
+		case affinity == nil:
+			patches.operations = append(patches.operations, patchOperation{Op: "add", Path: "/spec/affinity", Value: corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{RequiredDuringSchedulingIgnoredDuringExecution: required}}})
+			mutated = true
+		case affinity.NodeAffinity == nil:
+			patches.operations = append(patches.operations, patchOperation{Op: "add", Path: "/spec/affinity/nodeAffinity", Value: corev1.NodeAffinity{RequiredDuringSchedulingIgnoredDuringExecution: required}})
+			mutated = true
+		case affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil || len(affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms) == 0:
+			patches.operations = append(patches.operations, patchOperation{Op: "add", Path: requiredNodeAffinityPath, Value: required})
+			mutated = true
+		default:
+			for i, term := range affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+				termPath := fmt.Sprintf("%s/nodeSelectorTerms/%d/matchExpressions", requiredNodeAffinityPath, i)
+				missing := missingNodeSelectorRequirements(term, profile.NodeAffinity)
+				if len(missing) == 0 {
+					continue
+				}
+				if len(term.MatchExpressions) == 0 {
+					patches.operations = append(patches.operations, patchOperation{Op: "add", Path: termPath, Value: missing})
+				} else {
+					for _, requirement := range missing {
+						patches.operations = append(patches.operations, patchOperation{Op: "add", Path: termPath + "/-", Value: requirement})
+					}
+				}
+				mutated = true
+			}
+		}
+	}
+
+	if mutated {
+		annotatePod(pod, &patches, "karydia.gardener.cloud/nodePlacement.internal", setting.src+"/"+setting.value)
+	}
+	return patches
+}
+
+// missingNodeSelectorRequirements returns the requirements which are not part
+// of the node affinity term
+func missingNodeSelectorRequirements(term corev1.NodeSelectorTerm, requirements []corev1.NodeSelectorRequirement) []corev1.NodeSelectorRequirement {
+	var missing []corev1.NodeSelectorRequirement
+	for _, requirement := range requirements {
+		found := false
+		for _, expression := range term.MatchExpressions {
+			if reflect.DeepEqual(expression, requirement) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, requirement)
+		}
+	}
+	return missing
+}
+
+// tolerationAllowed reports whether the toleration is one of the allowed
+// tolerations. An allowed toleration without effect allows all effects, the
+// toleration seconds are not compared.
+func tolerationAllowed(toleration corev1.Toleration, allowed []corev1.Toleration) bool {
+	if toleration.Key != "" && contains(nodeConditionTolerationKeys, toleration.Key) {
+		return true
+	}
+	operator := func(t corev1.Toleration) corev1.TolerationOperator {
+		if t.Operator == "" {
+			return corev1.TolerationOpEqual
+		}
+		return t.Operator
+	}
+	for _, a := range allowed {
+		if a.Key == toleration.Key && operator(a) == operator(toleration) && (operator(a) == corev1.TolerationOpExists || a.Value == toleration.Value) && (a.Effect == "" || a.Effect == toleration.Effect) {
+			return true
+		}
+	}
+	return false
+}
+
+// validatePodNodePlacement rejects pods which do not use the node selector
+// and node affinity of the profile and pods with tolerations which are not
+// allowed by the profile
+func validatePodNodePlacement(pod corev1.Pod, profile *v1alpha1.NodePlacementProfile, validationErrors []string) []string {
+	var keys []string
+	for key := range profile.NodeSelector {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if value, ok := pod.Spec.NodeSelector[key]; !ok || value != profile.NodeSelector[key] {
+			validationErrorMsg := fmt.Sprintf("node selector '%s' of the pod must be '%s'", key, profile.NodeSelector[key])
+			validationErrors = append(validationErrors, validationErrorMsg)
+		}
+	}
+
+	if len(profile.NodeAffinity) > 0 {
+		var terms []corev1.NodeSelectorTerm
+		if affinity := pod.Spec.Affinity; affinity != nil && affinity.NodeAffinity != nil && affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution != nil {
+			terms = affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+		}
+		if len(terms) == 0 {
+			validationErrors = append(validationErrors, "pod must define the required node affinity of the node placement profile")
+		}
+		for i, term := range terms {
+			if len(missingNodeSelectorRequirements(term, profile.NodeAffinity)) > 0 {
+				validationErrorMsg := fmt.Sprintf("required node affinity term %d of the pod must contain the node affinity of the node placement profile", i)
+				validationErrors = append(validationErrors, validationErrorMsg)
+			}
+		}
+	}
+
+	for _, toleration := range pod.Spec.Tolerations {
+		if !tolerationAllowed(toleration, profile.Tolerations) {
+			validationErrorMsg := fmt.Sprintf("toleration '%s' of the pod is not allowed", formatToleration(toleration))
+			validationErrors = append(validationErrors, validationErrorMsg)
+		}
+	}
+	return validationErrors
+}
+
+// formatToleration formats the toleration like kubectl, e.g.
+// 'dedicated=tenant:NoSchedule' or 'dedicated:NoSchedule op=Exists'
+func formatToleration(toleration corev1.Toleration) string {
+	s := toleration.Key
+	if toleration.Value != "" {
+		s += "=" + toleration.Value
+	}
+	if toleration.Effect != "" {
+		s += ":" + string(toleration.Effect)
+	}
+	if toleration.Operator == corev1.TolerationOpExists {
+		s += " op=Exists"
+	}
+	return s
+}
@@ -0,0 +1,193 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package karydia
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/karydia/karydia/pkg/apis/karydia/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// resourcesValidate only rejects containers without limits, without applying
+// a profile
+const resourcesValidate = "validate"
+
+// requiredLimits are the limits (init) containers must always define
+var requiredLimits = []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory}
+
+// getResourcesSetting only considers the namespace annotation as tenants must
+// not be able to opt out of the limits with pod annotations
+func (k *KarydiaAdmission) getResourcesSetting(ns *corev1.Namespace) Setting {
+	return k.getSetting("karydia.gardener.cloud/resources", ns.ObjectMeta, "namespace", ns, k.getConfigSpec().Resources)
+}
+
+func (k *KarydiaAdmission) getResourceProfile(name string) *v1alpha1.ResourceProfile {
+	return findResourceProfile(k.getConfigSpec(), name)
+}
+
+func findResourceProfile(spec v1alpha1.KarydiaConfigSpec, name string) *v1alpha1.ResourceProfile {
+	for _, profile := range spec.ResourceProfiles {
+		if profile.Name == name {
+			return &profile
+		}
+	}
+	return nil
+}
+
+// sortedResourceNames returns the resource names of the list in a stable
+// order to generate deterministic patches
+func sortedResourceNames(resources corev1.ResourceList) []corev1.ResourceName {
+	var names []corev1.ResourceName
+	for name := range resources {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
+// mutatePodResources applies the requests and limits of the profile to all
+// (init) containers which do not define them. A request is not applied if the
+// container defines a limit for the resource, which Kubernetes uses as
+// request, and a limit is raised to the request of the container.
+func mutatePodResources(pod corev1.Pod, setting Setting, profile *v1alpha1.ResourceProfile, patches Patches) Patches {
+	mutated := false
+	mutateContainers := func(containers []corev1.Container, path string) {
+		for i, container := range containers {
+			resourcesPath := path + "/" + strconv.Itoa(i) + "/resources"
+
+			requests := corev1.ResourceList{}
+			for _, name := range sortedResourceNames(profile.Requests) {
+				_, hasRequest := container.Resources.Requests[name]
+				_, hasLimit := container.Resources.Limits[name]
+				if !hasRequest && !hasLimit {
+					requests[name] = profile.Requests[name]
+				}
+			}
+			limits := corev1.ResourceList{}
+			for _, name := range sortedResourceNames(profile.Limits) {
+				if _, ok := container.Resources.Limits[name]; ok {
+					continue
+				}
+				limit := profile.Limits[name]
+				request, ok := container.Resources.Requests[name]
+				if !ok {
+					request, ok = requests[name]
+				}
+				if ok && request.Cmp(limit) > 0 {
+					limit = request
+				}
+				limits[name] = limit
+			}
+
+			mutated = addResources(container.Resources.Requests, requests, resourcesPath+"/requests", &patches) || mutated
+			mutated = addResources(container.Resources.Limits, limits, resourcesPath+"/limits", &patches) || mutated
+		}
+	}
+	mutateContainers(pod.Spec.InitContainers, "/spec/initContainers")
+	mutateContainers(pod.Spec.Containers, "/spec/containers")
+
+	if mutated {
+		annotatePod(pod, &patches, "karydia.gardener.cloud/resources.internal", setting.src+"/"+setting.value)
+	}
+	return patches
+}
+
+// addResources adds the resources to the (possibly undefined) resource list
+// at the given path and reports whether any resource has been added
+func addResources(existing corev1.ResourceList, resources corev1.ResourceList, path string, patches *Patches) bool {
+	if len(resources) == 0 {
+		return false
+	}
+	if len(existing) == 0 {
+		patches.operations = append(patches.operations, patchOperation{Op: "add", Path: path, Value: resources})
+		return true
+	}
+	for _, name := range sortedResourceNames(resources) {
+		patches.operations = append(patches.operations, patchOperation{Op: "add", Path: path + "/" + strings.Replace(string(name), "/", "~1", -1), Value: resources[name]})
+	}
+	return true
+}
+
+// requiredResourceLimits returns the limits (init) containers must define:
+// CPU and memory for 'validate', the limits of the profile otherwise
+func requiredResourceLimits(profile *v1alpha1.ResourceProfile) []corev1.ResourceName {
+	if profile == nil {
+		return requiredLimits
+	}
+	return sortedResourceNames(profile.Limits)
+}
+
+// validatePodResources rejects pods with (init) containers without the
+// required limits
+func validatePodResources(pod corev1.Pod, profile *v1alpha1.ResourceProfile, validationErrors []string) []string {
+	required := requiredResourceLimits(profile)
+	containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, container := range containers {
+		for _, name := range required {
+			if _, ok := container.Resources.Limits[name]; !ok {
+				validationErrorMsg := fmt.Sprintf("container '%s' must define a '%s' limit", container.Name, name)
+				validationErrors = append(validationErrors, validationErrorMsg)
+			}
+		}
+	}
+	return validationErrors
+}
+
+// resourcesWeakens reports whether the value requires less limits than the
+// config or whose profile has higher limits than the profile of the config
+func resourcesWeakens(value string, spec v1alpha1.KarydiaConfigSpec) bool {
+	if spec.Resources == "" || spec.Resources == "none" {
+		return false
+	}
+	if value == "" || value == "none" {
+		return true
+	}
+	configProfile := findResourceProfile(spec, spec.Resources)
+	profile := findResourceProfile(spec, value)
+	if profile == nil && value != resourcesValidate {
+		return true
+	}
+	required := requiredResourceLimits(profile)
+	for _, name := range requiredResourceLimits(configProfile) {
+		if !containsResourceName(required, name) {
+			return true
+		}
+	}
+	if configProfile == nil || profile == nil {
+		return false
+	}
+	for name, configLimit := range configProfile.Limits {
+		if limit := profile.Limits[name]; limit.Cmp(configLimit) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func containsResourceName(names []corev1.ResourceName, name corev1.ResourceName) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
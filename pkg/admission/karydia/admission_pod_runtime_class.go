@@ -0,0 +1,60 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package karydia
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// getRuntimeClassSetting only considers the namespace annotation as tenants
+// must not be able to opt out of the runtime class with pod annotations
+func (k *KarydiaAdmission) getRuntimeClassSetting(ns *corev1.Namespace) Setting {
+	return k.getSetting("karydia.gardener.cloud/runtimeClass", ns.ObjectMeta, "namespace", ns, valueForNamespace(k.getConfigSpec().RuntimeClass, ns.Name))
+}
+
+// runtimeClassRequired reports whether the setting requires a runtime class
+func runtimeClassRequired(setting Setting) bool {
+	return setting.value != "" && setting.value != "none"
+}
+
+// mutatePodRuntimeClass sets the required runtime class of pods which do not
+// specify a runtime class
+func mutatePodRuntimeClass(pod corev1.Pod, setting Setting, patches Patches) Patches {
+	if !runtimeClassRequired(setting) || pod.Spec.RuntimeClassName != nil {
+		return patches
+	}
+	patches.operations = append(patches.operations, patchOperation{Op: "add", Path: "/spec/runtimeClassName", Value: setting.value})
+	annotatePod(pod, &patches, "karydia.gardener.cloud/runtimeClass.internal", setting.src+"/"+setting.value)
+	return patches
+}
+
+// validatePodRuntimeClass rejects pods without the required runtime class
+func validatePodRuntimeClass(pod corev1.Pod, setting Setting, validationErrors []string) []string {
+	if !runtimeClassRequired(setting) {
+		return validationErrors
+	}
+	if pod.Spec.RuntimeClassName == nil {
+		validationErrorMsg := fmt.Sprintf("runtime class of the pod must be '%s'", setting.value)
+		validationErrors = append(validationErrors, validationErrorMsg)
+	} else if *pod.Spec.RuntimeClassName != setting.value {
+		validationErrorMsg := fmt.Sprintf("runtime class '%s' of the pod must be '%s'", *pod.Spec.RuntimeClassName, setting.value)
+		validationErrors = append(validationErrors, validationErrorMsg)
+	}
+	return validationErrors
+}
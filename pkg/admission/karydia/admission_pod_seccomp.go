@@ -0,0 +1,234 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package karydia
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	listers "github.com/karydia/karydia/pkg/client/listers/karydia/v1alpha1"
+	"github.com/karydia/karydia/pkg/util/seccomp"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	seccompPodAnnotation             = "seccomp.security.alpha.kubernetes.io/pod"
+	seccompContainerAnnotationPrefix = "container.seccomp.security.alpha.kubernetes.io/"
+)
+
+// seccompProfiles holds the seccomp profiles of the GA
+// 'securityContext.seccompProfile' fields of a pod (Kubernetes >= 1.19),
+// which are not part of the vendored core/v1 API. The profiles are stored in
+// annotation notation, e.g. 'runtime/default', container profiles are keyed
+// by container name.
+type seccompProfiles struct {
+	pod        string
+	containers map[string]string
+}
+
+type seccompProfileField struct {
+	Type             string `json:"type"`
+	LocalhostProfile string `json:"localhostProfile,omitempty"`
+}
+
+// newSeccompProfileField converts a seccomp profile in annotation notation
+// to the 'securityContext.seccompProfile' field
+func newSeccompProfileField(profile string) seccompProfileField {
+	switch {
+	case profile == "unconfined":
+		return seccompProfileField{Type: "Unconfined"}
+	case strings.HasPrefix(profile, "localhost/"):
+		return seccompProfileField{Type: "Localhost", LocalhostProfile: strings.TrimPrefix(profile, "localhost/")}
+	}
+	return seccompProfileField{Type: "RuntimeDefault"}
+}
+
+// annotation returns the seccomp profile field in annotation notation
+func (field *seccompProfileField) annotation() string {
+	if field == nil {
+		return ""
+	}
+	switch field.Type {
+	case "Unconfined":
+		return "unconfined"
+	case "Localhost":
+		return "localhost/" + field.LocalhostProfile
+	case "RuntimeDefault":
+		return "runtime/default"
+	}
+	return ""
+}
+
+// podProfile returns the seccomp profile of the pod, the field takes
+// precedence over the annotation
+func (profiles seccompProfiles) podProfile(pod corev1.Pod) string {
+	if profiles.pod != "" {
+		return profiles.pod
+	}
+	return pod.ObjectMeta.Annotations[seccompPodAnnotation]
+}
+
+// containerProfile returns the seccomp profile which applies to the container,
+// i.e. the container profile or the profile of the pod
+func (profiles seccompProfiles) containerProfile(pod corev1.Pod, name string) string {
+	if profile := profiles.ownContainerProfile(pod, name); profile != "" {
+		return profile
+	}
+	return profiles.podProfile(pod)
+}
+
+// ownContainerProfile returns the seccomp profile set for the container itself
+func (profiles seccompProfiles) ownContainerProfile(pod corev1.Pod, name string) string {
+	if profile := profiles.containers[name]; profile != "" {
+		return profile
+	}
+	return pod.ObjectMeta.Annotations[seccompContainerAnnotationPrefix+name]
+}
+
+func (k *KarydiaAdmission) getAllowedSeccompProfilesSetting(pod *corev1.Pod, ns *corev1.Namespace) Setting {
+	return k.getSetting("karydia.gardener.cloud/allowedSeccompProfiles", pod.ObjectMeta, "pod", ns, k.getConfigSpec().AllowedSeccompProfiles)
+}
+
+// validatePodAllowedSeccompProfiles checks the seccomp profiles set for the
+// pod and its (init or ephemeral) containers against the allowed profiles
+func validatePodAllowedSeccompProfiles(pod corev1.Pod, ephemeralContainers []corev1.Container, profiles seccompProfiles, setting Setting, validationErrors []string) []string {
+	allowed := splitSetting(setting.value)
+	if profile := profiles.podProfile(pod); profile != "" && !profileAllowed(profile, allowed) {
+		validationErrorMsg := fmt.Sprintf("seccomp profile '%s' of the pod must be one of '%s'", profile, strings.Join(allowed, "', '"))
+		validationErrors = append(validationErrors, validationErrorMsg)
+	}
+	containers := append(append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...), ephemeralContainers...)
+	for _, container := range containers {
+		if profile := profiles.ownContainerProfile(pod, container.Name); profile != "" && !profileAllowed(profile, allowed) {
+			validationErrorMsg := fmt.Sprintf("seccomp profile '%s' of container '%s' must be one of '%s'", profile, container.Name, strings.Join(allowed, "', '"))
+			validationErrors = append(validationErrors, validationErrorMsg)
+		}
+	}
+	return validationErrors
+}
+
+// seccompProfilesAvailable reports whether the declared seccomp profiles can
+// be checked. Until the cache is synced, e.g. as the CRD was not installed with
+// the chart, all profiles are allowed.
+func (k *KarydiaAdmission) seccompProfilesAvailable() bool {
+	if k.seccompProfiles == nil {
+		return false
+	}
+	if k.seccompProfilesSynced != nil && !k.seccompProfilesSynced() {
+		k.logger.Warnln("KarydiaSeccompProfile cache is not synced, seccomp profiles are not checked")
+		return false
+	}
+	return true
+}
+
+// validatePodLocalhostSeccompProfiles checks that the 'localhost/karydia/'
+// seccomp profiles of the pod and its (init or ephemeral) containers are
+// declared as KarydiaSeccompProfile, as only those are distributed to the
+// nodes. Other 'localhost/' profiles are only rejected if requireDeclared is
+// set.
+func validatePodLocalhostSeccompProfiles(pod corev1.Pod, ephemeralContainers []corev1.Container, profiles seccompProfiles, lister listers.KarydiaSeccompProfileLister, requireDeclared bool, validationErrors []string) []string {
+	localhostProfiles := []string{profiles.podProfile(pod)}
+	containers := append(append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...), ephemeralContainers...)
+	for _, container := range containers {
+		localhostProfiles = append(localhostProfiles, profiles.ownContainerProfile(pod, container.Name))
+	}
+	for _, profile := range localhostProfiles {
+		if !seccomp.IsLocalhostProfile(profile) {
+			continue
+		}
+		name, ok := seccomp.ProfileName(profile)
+		if !ok && !requireDeclared && !strings.HasPrefix(profile, seccomp.LocalhostProfile("")) {
+			continue
+		}
+		if !ok {
+			validationErrorMsg := fmt.Sprintf("seccomp profile '%s' must reference a KarydiaSeccompProfile ('%s')", profile, seccomp.LocalhostProfile("<name>"))
+			validationErrors = append(validationErrors, validationErrorMsg)
+			continue
+		}
+		if _, err := lister.Get(name); errors.IsNotFound(err) {
+			validationErrorMsg := fmt.Sprintf("seccomp profile '%s' is not declared as KarydiaSeccompProfile '%s'", profile, name)
+			validationErrors = append(validationErrors, validationErrorMsg)
+		} else if err != nil {
+			validationErrorMsg := fmt.Sprintf("failed to get KarydiaSeccompProfile '%s': %v", name, err)
+			validationErrors = append(validationErrors, validationErrorMsg)
+		}
+	}
+	return validationErrors
+}
+
+/* Utility functions to decode raw resources into objects */
+type seccompSecurityContext struct {
+	SeccompProfile *seccompProfileField `json:"seccompProfile"`
+}
+
+type seccompContainer struct {
+	Name            string                  `json:"name"`
+	SecurityContext *seccompSecurityContext `json:"securityContext"`
+}
+
+func decodeSeccompProfiles(raw []byte) (seccompProfiles, error) {
+	pod := struct {
+		Spec struct {
+			SecurityContext     *seccompSecurityContext `json:"securityContext"`
+			InitContainers      []seccompContainer      `json:"initContainers"`
+			Containers          []seccompContainer      `json:"containers"`
+			EphemeralContainers []seccompContainer      `json:"ephemeralContainers"`
+		} `json:"spec"`
+	}{}
+
+	var profiles seccompProfiles
+	if err := json.Unmarshal(raw, &pod); err != nil {
+		return profiles, err
+	}
+	if pod.Spec.SecurityContext != nil {
+		profiles.pod = pod.Spec.SecurityContext.SeccompProfile.annotation()
+	}
+	containers := append(append(append([]seccompContainer{}, pod.Spec.InitContainers...), pod.Spec.Containers...), pod.Spec.EphemeralContainers...)
+	profiles.containers = containerSeccompProfiles(containers)
+	return profiles, nil
+}
+
+// decodeEphemeralContainersSeccompProfiles decodes the seccomp profiles of the
+// containers of an 'EphemeralContainers' object. The profiles of the pod are
+// left empty, so the synced annotations of the pod are used for them.
+func decodeEphemeralContainersSeccompProfiles(raw []byte) (seccompProfiles, error) {
+	obj := struct {
+		EphemeralContainers []seccompContainer `json:"ephemeralContainers"`
+	}{}
+
+	var profiles seccompProfiles
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return profiles, err
+	}
+	profiles.containers = containerSeccompProfiles(obj.EphemeralContainers)
+	return profiles, nil
+}
+
+func containerSeccompProfiles(containers []seccompContainer) map[string]string {
+	profiles := make(map[string]string)
+	for _, c := range containers {
+		if c.SecurityContext != nil {
+			if profile := c.SecurityContext.SeccompProfile.annotation(); profile != "" {
+				profiles[c.Name] = profile
+			}
+		}
+	}
+	return profiles
+}
@@ -0,0 +1,226 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package karydia
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Pod Security Standards, see
+// https://kubernetes.io/docs/concepts/security/pod-security-standards/
+const (
+	podSecurityStandardBaseline   = "baseline"
+	podSecurityStandardRestricted = "restricted"
+)
+
+// baselineCapabilities are the capabilities which may be added according to
+// the baseline pod security standard
+var baselineCapabilities = []string{"AUDIT_WRITE", "CHOWN", "DAC_OVERRIDE", "FOWNER", "FSETID", "KILL", "MKNOD", "NET_BIND_SERVICE", "SETFCAP", "SETGID", "SETPCAP", "SETUID", "SYS_CHROOT"}
+
+// safeSysctls are the sysctls which may be set according to the baseline
+// pod security standard
+var safeSysctls = []string{"kernel.shm_rmid_forced", "net.ipv4.ip_local_port_range", "net.ipv4.ip_unprivileged_port_start", "net.ipv4.tcp_syncookies", "net.ipv4.ping_group_range"}
+
+// allowedSELinuxTypes are the SELinux types which may be set according to
+// the baseline pod security standard
+var allowedSELinuxTypes = []string{"", "container_t", "container_init_t", "container_kvm_t"}
+
+func (k *KarydiaAdmission) getPodSecurityStandardSetting(pod *corev1.Pod, ns *corev1.Namespace) Setting {
+	return k.getSetting("karydia.gardener.cloud/podSecurityStandard", pod.ObjectMeta, "pod", ns, k.getConfigSpec().PodSecurityStandard)
+}
+
+func podSecurityStandardLevel(value string) int {
+	switch value {
+	case podSecurityStandardBaseline:
+		return 1
+	case podSecurityStandardRestricted:
+		return 2
+	}
+	return 0
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// isRestrictedSeccompProfile reports whether the seccomp profile is allowed
+// by the restricted pod security standard
+func isRestrictedSeccompProfile(profile string) bool {
+	return profile == "runtime/default" || profile == "docker/default" || strings.HasPrefix(profile, "localhost/")
+}
+
+func validatePodSecurityStandard(pod corev1.Pod, ephemeralContainers []corev1.Container, profiles seccompProfiles, setting Setting, validationErrors []string) []string {
+	level := podSecurityStandardLevel(setting.value)
+	if level == 0 {
+		return validationErrors
+	}
+	violation := func(control string, format string, a ...interface{}) {
+		validationErrorMsg := fmt.Sprintf("pod security standard '%s', control '%s': %s", setting.value, control, fmt.Sprintf(format, a...))
+		validationErrors = append(validationErrors, validationErrorMsg)
+	}
+
+	/* Baseline */
+	if pod.Spec.HostNetwork || pod.Spec.HostPID || pod.Spec.HostIPC {
+		violation("Host Namespaces", "hostNetwork, hostPID and hostIPC must not be used")
+	}
+	for _, volume := range pod.Spec.Volumes {
+		if volume.HostPath != nil {
+			violation("HostPath Volumes", "volume '%s' must not be a hostPath volume", volume.Name)
+		}
+	}
+	if profiles.podProfile(pod) == "unconfined" {
+		violation("Seccomp", "seccomp profile of the pod must not be 'unconfined'")
+	}
+	podSecCtx := pod.Spec.SecurityContext
+	if podSecCtx == nil {
+		podSecCtx = &corev1.PodSecurityContext{}
+	}
+	if options := podSecCtx.SELinuxOptions; options != nil && (options.User != "" || options.Role != "" || !contains(allowedSELinuxTypes, options.Type)) {
+		violation("SELinux", "SELinux options of the pod must not set user or role or a custom type")
+	}
+	for _, sysctl := range podSecCtx.Sysctls {
+		if !contains(safeSysctls, sysctl.Name) {
+			violation("Sysctls", "sysctl '%s' must not be set", sysctl.Name)
+		}
+	}
+
+	containers := append(append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...), ephemeralContainers...)
+	for _, container := range containers {
+		secCtx := container.SecurityContext
+		if secCtx == nil {
+			secCtx = &corev1.SecurityContext{}
+		}
+		if secCtx.Privileged != nil && *secCtx.Privileged {
+			violation("Privileged Containers", "container '%s' must not be privileged", container.Name)
+		}
+		if secCtx.Capabilities != nil {
+			for _, capability := range secCtx.Capabilities.Add {
+				if !contains(baselineCapabilities, normalizeCapability(string(capability))) {
+					violation("Capabilities", "container '%s' must not add capability '%s'", container.Name, capability)
+				}
+			}
+		}
+		for _, port := range container.Ports {
+			if port.HostPort != 0 {
+				violation("Host Ports", "container '%s' must not use host port %d", container.Name, port.HostPort)
+			}
+		}
+		if profile, ok := pod.ObjectMeta.Annotations[appArmorContainerAnnotationPrefix+container.Name]; ok && profile != "runtime/default" && !strings.HasPrefix(profile, "localhost/") {
+			violation("AppArmor", "AppArmor profile of container '%s' must be 'runtime/default' or 'localhost/*'", container.Name)
+		}
+		if options := secCtx.SELinuxOptions; options != nil && (options.User != "" || options.Role != "" || !contains(allowedSELinuxTypes, options.Type)) {
+			violation("SELinux", "SELinux options of container '%s' must not set user or role or a custom type", container.Name)
+		}
+		if secCtx.ProcMount != nil && *secCtx.ProcMount != corev1.DefaultProcMount {
+			violation("/proc Mount Type", "container '%s' must use the default /proc mount type", container.Name)
+		}
+		if profiles.ownContainerProfile(pod, container.Name) == "unconfined" {
+			violation("Seccomp", "seccomp profile of container '%s' must not be 'unconfined'", container.Name)
+		}
+
+		if level < podSecurityStandardLevel(podSecurityStandardRestricted) {
+			continue
+		}
+
+		/* Restricted */
+		if secCtx.AllowPrivilegeEscalation == nil || *secCtx.AllowPrivilegeEscalation {
+			violation("Privilege Escalation", "container '%s' must set allowPrivilegeEscalation to false", container.Name)
+		}
+		if nonRoot := runAsNonRoot(pod, container); nonRoot == nil || !*nonRoot {
+			violation("Running as Non-root", "container '%s' must set runAsNonRoot to true", container.Name)
+		}
+		if secCtx.RunAsUser != nil && *secCtx.RunAsUser == 0 {
+			violation("Running as Non-root user", "container '%s' must not run as user 0", container.Name)
+		}
+		if !isRestrictedSeccompProfile(profiles.containerProfile(pod, container.Name)) {
+			violation("Seccomp", "seccomp profile of container '%s' must be 'runtime/default' or 'localhost/*'", container.Name)
+		}
+		dropsAll := false
+		if secCtx.Capabilities != nil {
+			for _, capability := range secCtx.Capabilities.Drop {
+				dropsAll = dropsAll || normalizeCapability(string(capability)) == "ALL"
+			}
+			// capabilities outside of the baseline are already reported
+			for _, capability := range secCtx.Capabilities.Add {
+				if normalizeCapability(string(capability)) != "NET_BIND_SERVICE" && contains(baselineCapabilities, normalizeCapability(string(capability))) {
+					violation("Capabilities", "container '%s' must not add capability '%s'", container.Name, capability)
+				}
+			}
+		}
+		if !dropsAll {
+			violation("Capabilities", "container '%s' must drop all capabilities", container.Name)
+		}
+	}
+
+	if level >= podSecurityStandardLevel(podSecurityStandardRestricted) {
+		if podSecCtx.RunAsUser != nil && *podSecCtx.RunAsUser == 0 {
+			violation("Running as Non-root user", "pod must not run as user 0")
+		}
+		for _, volume := range pod.Spec.Volumes {
+			if !isRestrictedVolume(volume) {
+				violation("Volume Types", "volume '%s' must be of type configMap, csi, downwardAPI, emptyDir, ephemeral, persistentVolumeClaim, projected or secret", volume.Name)
+			}
+		}
+	}
+	return validationErrors
+}
+
+// isRestrictedVolume reports whether the volume type is allowed by the
+// restricted pod security standard. Volume types unknown to the vendored API
+// (e.g. ephemeral volumes) are allowed.
+func isRestrictedVolume(volume corev1.Volume) bool {
+	source := volume.VolumeSource
+	if source.ConfigMap != nil || source.CSI != nil || source.DownwardAPI != nil || source.EmptyDir != nil ||
+		source.PersistentVolumeClaim != nil || source.Projected != nil || source.Secret != nil {
+		return true
+	}
+	return source == corev1.VolumeSource{}
+}
+
+// mutatePodSecurityStandard applies safe defaults for the restricted pod
+// security standard. The seccomp profile is defaulted by the seccomp profile
+// feature. The baseline pod security standard is only validated as its
+// controls can not be met by defaulting.
+func mutatePodSecurityStandard(pod corev1.Pod, setting Setting, patches Patches) Patches {
+	if setting.value == podSecurityStandardRestricted {
+		mutated := false
+		for _, defaultContainer := range podSecurityStandardDefaults {
+			mutated = defaultContainers(pod, pod.Spec.InitContainers, "/spec/initContainers", &patches, defaultContainer) || mutated
+			mutated = defaultContainers(pod, pod.Spec.Containers, "/spec/containers", &patches, defaultContainer) || mutated
+		}
+		if mutated {
+			annotatePod(pod, &patches, "karydia.gardener.cloud/podSecurityStandard.internal", setting.src+"/"+setting.value)
+		}
+	}
+	return patches
+}
+
+// podSecurityStandardDefaults are the container defaults of the restricted
+// pod security standard
+var podSecurityStandardDefaults = []func(pod corev1.Pod, container corev1.Container, path string, patches *Patches) bool{
+	defaultAllowPrivilegeEscalation,
+	defaultRunAsNonRoot,
+	dropCapabilities,
+}
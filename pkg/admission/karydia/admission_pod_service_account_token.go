@@ -0,0 +1,235 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package karydia
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/karydia/karydia/pkg/apis/karydia/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// serviceAccountTokenMountPath is the path the service account admission
+// plugin of the API server mounts the service account token to
+const serviceAccountTokenMountPath = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+func (k *KarydiaAdmission) getPodAutomountServiceAccountTokenSetting(pod *corev1.Pod, ns *corev1.Namespace) Setting {
+	return k.getSetting("karydia.gardener.cloud/automountServiceAccountToken", pod.ObjectMeta, "pod", ns, k.getConfigSpec().AutomountServiceAccountToken)
+}
+
+// getPodServiceAccount returns the service account of the pod. A service
+// account which does not exist (yet) is returned empty, i.e. with undefined
+// 'automountServiceAccountToken'.
+func (k *KarydiaAdmission) getPodServiceAccount(pod *corev1.Pod, ns *corev1.Namespace, setting Setting) (corev1.ServiceAccount, error) {
+	name := pod.Spec.ServiceAccountName
+	if name == "" {
+		name = "default"
+	}
+	if setting.value != "change-default" && setting.value != "change-all" {
+		return corev1.ServiceAccount{}, nil
+	}
+	sAcc, err := k.kubeClientset.CoreV1().ServiceAccounts(ns.Name).Get(name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return corev1.ServiceAccount{}, nil
+	} else if err != nil {
+		return corev1.ServiceAccount{}, fmt.Errorf("failed to get service account '%s' of pod: %v", name, err)
+	}
+	return *sAcc, nil
+}
+
+// automountServiceAccountTokenApplies reports whether the setting applies to
+// the service account of the pod. Service accounts explicitly opting in to
+// the automount of their token are left untouched.
+func automountServiceAccountTokenApplies(pod corev1.Pod, sAcc corev1.ServiceAccount, setting Setting) bool {
+	if sAcc.AutomountServiceAccountToken != nil && *sAcc.AutomountServiceAccountToken {
+		return false
+	}
+	switch setting.value {
+	case "change-default":
+		return pod.Spec.ServiceAccountName == "" || pod.Spec.ServiceAccountName == "default"
+	case "change-all":
+		return true
+	}
+	return false
+}
+
+// mutatePodServiceAccountTokenMount sets 'automountServiceAccountToken' of the
+// pod to false if it is undefined for both the pod and its service account.
+// The token volume, which the service account admission plugin already added
+// to the pod, is removed.
+func mutatePodServiceAccountTokenMount(pod corev1.Pod, sAcc corev1.ServiceAccount, setting Setting, patches Patches) Patches {
+	if !serviceAccountTokenRemoved(pod, sAcc, setting) {
+		return patches
+	}
+	patches.operations = append(patches.operations, patchOperation{Op: "add", Path: "/spec/automountServiceAccountToken", Value: false})
+
+	tokenVolumes := make(map[string]bool)
+	for i := len(pod.Spec.Volumes) - 1; i >= 0; i-- {
+		if isServiceAccountTokenVolume(pod, pod.Spec.Volumes[i]) {
+			tokenVolumes[pod.Spec.Volumes[i].Name] = true
+		}
+	}
+	removeTokenVolumeMounts := func(containers []corev1.Container, path string) {
+		for i, container := range containers {
+			for j := len(container.VolumeMounts) - 1; j >= 0; j-- {
+				if mount := container.VolumeMounts[j]; tokenVolumes[mount.Name] && mount.MountPath == serviceAccountTokenMountPath {
+					patches.operations = append(patches.operations, patchOperation{Op: "remove", Path: fmt.Sprintf("%s/%d/volumeMounts/%d", path, i, j)})
+				}
+			}
+		}
+	}
+	removeTokenVolumeMounts(pod.Spec.InitContainers, "/spec/initContainers")
+	removeTokenVolumeMounts(pod.Spec.Containers, "/spec/containers")
+	for i := len(pod.Spec.Volumes) - 1; i >= 0; i-- {
+		if tokenVolumes[pod.Spec.Volumes[i].Name] {
+			patches.operations = append(patches.operations, patchOperation{Op: "remove", Path: fmt.Sprintf("/spec/volumes/%d", i)})
+		}
+	}
+
+	annotatePod(pod, &patches, "karydia.gardener.cloud/automountServiceAccountToken.internal", setting.src+"/"+setting.value)
+	return patches
+}
+
+// isServiceAccountTokenVolume reports whether the volume was added by the
+// service account admission plugin, i.e. the token secret of the service
+// account or the projected 'kube-api-access-' volume (Kubernetes >= 1.21)
+func isServiceAccountTokenVolume(pod corev1.Pod, volume corev1.Volume) bool {
+	serviceAccountName := pod.Spec.ServiceAccountName
+	if serviceAccountName == "" {
+		serviceAccountName = "default"
+	}
+	if volume.Secret != nil {
+		return strings.HasPrefix(volume.Name, serviceAccountName+"-token-")
+	}
+	return volume.Projected != nil && strings.HasPrefix(volume.Name, "kube-api-access-")
+}
+
+// validatePodServiceAccountTokenMount rejects pods which do not disable the
+// automount of the service account token. An explicit opt-in requires the
+// setting 'no-change' for the pod or its namespace.
+func validatePodServiceAccountTokenMount(pod corev1.Pod, sAcc corev1.ServiceAccount, setting Setting, validationErrors []string) []string {
+	if !automountServiceAccountTokenApplies(pod, sAcc, setting) {
+		return validationErrors
+	}
+	if pod.Spec.AutomountServiceAccountToken == nil {
+		if sAcc.AutomountServiceAccountToken == nil {
+			validationErrors = append(validationErrors, "implicit automount of service account token not allowed")
+		}
+	} else if *pod.Spec.AutomountServiceAccountToken {
+		validationErrors = append(validationErrors, "automount of service account token not allowed (requires 'karydia.gardener.cloud/automountServiceAccountToken' to be 'no-change')")
+	}
+	return validationErrors
+}
+
+// defaultServiceAccountTokenExpirationSeconds is used if the karydia config
+// does not define the lifetime of projected service account tokens. The API
+// server does not accept a lifetime below minServiceAccountTokenExpirationSeconds.
+const (
+	defaultServiceAccountTokenExpirationSeconds int64 = 3600
+	minServiceAccountTokenExpirationSeconds     int64 = 600
+)
+
+func (k *KarydiaAdmission) getServiceAccountTokenProjectionSetting(pod *corev1.Pod, ns *corev1.Namespace) Setting {
+	return k.getSetting("karydia.gardener.cloud/serviceAccountTokenProjection", pod.ObjectMeta, "pod", ns, k.getConfigSpec().ServiceAccountTokenProjection)
+}
+
+// serviceAccountTokenRemoved reports whether mutatePodServiceAccountTokenMount
+// removes the token volume of the pod
+func serviceAccountTokenRemoved(pod corev1.Pod, sAcc corev1.ServiceAccount, setting Setting) bool {
+	return automountServiceAccountTokenApplies(pod, sAcc, setting) && pod.Spec.AutomountServiceAccountToken == nil && sAcc.AutomountServiceAccountToken == nil
+}
+
+// mutatePodServiceAccountTokenProjection replaces the legacy token secret
+// volume, which the service account admission plugin added to the pod, with a
+// projected volume of the same name. The volume provides the same files but
+// the token is bound to the pod, has the configured audience and expires.
+func mutatePodServiceAccountTokenProjection(pod corev1.Pod, spec v1alpha1.KarydiaConfigSpec, setting Setting, patches Patches) Patches {
+	if setting.value != "projected" {
+		return patches
+	}
+	expirationSeconds := spec.ServiceAccountTokenExpirationSeconds
+	if expirationSeconds == 0 {
+		expirationSeconds = defaultServiceAccountTokenExpirationSeconds
+	} else if expirationSeconds < minServiceAccountTokenExpirationSeconds {
+		expirationSeconds = minServiceAccountTokenExpirationSeconds
+	}
+
+	replaced := false
+	for i, volume := range pod.Spec.Volumes {
+		if volume.Secret == nil || !isServiceAccountTokenVolume(pod, volume) {
+			continue
+		}
+		projected := projectedServiceAccountTokenVolume(volume, spec.ServiceAccountTokenAudience, expirationSeconds)
+		patches.operations = append(patches.operations, patchOperation{Op: "replace", Path: fmt.Sprintf("/spec/volumes/%d", i), Value: projected})
+		replaced = true
+	}
+	if replaced {
+		annotatePod(pod, &patches, "karydia.gardener.cloud/serviceAccountTokenProjection.internal", setting.src+"/"+setting.value)
+	}
+	return patches
+}
+
+// projectedServiceAccountTokenVolume builds the projected replacement of a
+// legacy token secret volume. 'ca.crt' and 'namespace' are still taken from
+// the token secret, which the pod already depends on.
+func projectedServiceAccountTokenVolume(volume corev1.Volume, audience string, expirationSeconds int64) corev1.Volume {
+	return corev1.Volume{
+		Name: volume.Name,
+		VolumeSource: corev1.VolumeSource{
+			Projected: &corev1.ProjectedVolumeSource{
+				DefaultMode: volume.Secret.DefaultMode,
+				Sources: []corev1.VolumeProjection{
+					{
+						ServiceAccountToken: &corev1.ServiceAccountTokenProjection{
+							Audience:          audience,
+							ExpirationSeconds: &expirationSeconds,
+							Path:              "token",
+						},
+					},
+					{
+						Secret: &corev1.SecretProjection{
+							LocalObjectReference: corev1.LocalObjectReference{Name: volume.Secret.SecretName},
+							Items: []corev1.KeyToPath{
+								{Key: "ca.crt", Path: "ca.crt"},
+								{Key: "namespace", Path: "namespace"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// validatePodServiceAccountTokenProjection rejects pods which still mount the
+// legacy token secret of their service account
+func validatePodServiceAccountTokenProjection(pod corev1.Pod, setting Setting, validationErrors []string) []string {
+	if setting.value != "projected" {
+		return validationErrors
+	}
+	for _, volume := range pod.Spec.Volumes {
+		if volume.Secret != nil && isServiceAccountTokenVolume(pod, volume) {
+			validationErrorMsg := fmt.Sprintf("service account token secret '%s' must be mounted as projected token volume", volume.Secret.SecretName)
+			validationErrors = append(validationErrors, validationErrorMsg)
+		}
+	}
+	return validationErrors
+}
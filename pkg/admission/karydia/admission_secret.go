@@ -0,0 +1,90 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package karydia
+
+import (
+	"fmt"
+
+	"k8s.io/api/admission/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/karydia/karydia/pkg/k8sutil"
+	"github.com/karydia/karydia/pkg/k8sutil/scheme"
+)
+
+// kubeControllerManagerUser is the user of the token controller, which
+// creates the token secrets of service accounts
+const kubeControllerManagerUser = "system:kube-controller-manager"
+
+func (k *KarydiaAdmission) validateSecret(req v1beta1.AdmissionRequest, secret *corev1.Secret, ns *corev1.Namespace) *v1beta1.AdmissionResponse {
+	var validationErrors []string
+
+	setting := k.getServiceAccountTokenSecretsSetting(ns)
+	if setting.value == "restricted" && req.Operation == v1beta1.Create && secret.Type == corev1.SecretTypeServiceAccountToken {
+		allowed, err := k.serviceAccountTokenSecretCreatorAllowed(req.UserInfo, ns.Name)
+		if err != nil {
+			k.logger.Errorln("failed to authorize service account token secret:", err)
+			return k8sutil.ErrToAdmissionResponse(err)
+		}
+		if !allowed {
+			validationErrorMsg := fmt.Sprintf("user '%s' is not allowed to create service account token secret '%s' (requires an entry in 'serviceAccountTokenSecretCreators' or verb '%s' on resource '%s.%s')", req.UserInfo.Username, secret.Name, overrideVerb, overrideResource, overrideAPIGroup)
+			validationErrors = append(validationErrors, validationErrorMsg)
+		}
+	}
+
+	return k8sutil.ValidatingAdmissionResponse(validationErrors)
+}
+
+// getServiceAccountTokenSecretsSetting only considers the namespace annotation
+// as the creator of a secret must not be able to opt out
+func (k *KarydiaAdmission) getServiceAccountTokenSecretsSetting(ns *corev1.Namespace) Setting {
+	return k.getSetting("karydia.gardener.cloud/serviceAccountTokenSecrets", ns.ObjectMeta, "namespace", ns, k.getConfigSpec().ServiceAccountTokenSecrets)
+}
+
+// serviceAccountTokenSecretCreatorAllowed reports whether the user may create
+// service account token secrets: the token controller, users and groups listed
+// in the karydia config and users allowed to override the setting
+func (k *KarydiaAdmission) serviceAccountTokenSecretCreatorAllowed(userInfo authenticationv1.UserInfo, namespace string) (bool, error) {
+	if userInfo.Username == kubeControllerManagerUser {
+		return true, nil
+	}
+	for _, creator := range splitSetting(k.getConfigSpec().ServiceAccountTokenSecretCreators) {
+		if creator == userInfo.Username {
+			return true, nil
+		}
+		for _, group := range userInfo.Groups {
+			if creator == group {
+				return true, nil
+			}
+		}
+	}
+	if k.authorizer == nil {
+		return false, nil
+	}
+	return k.authorizeOverride(userInfo, namespace, "serviceAccountTokenSecrets")
+}
+
+/* Utility functions to decode raw resources into objects */
+func decodeSecret(raw []byte) (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	deserializer := scheme.Codecs.UniversalDeserializer()
+	if _, _, err := deserializer.Decode(raw, nil, secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
@@ -0,0 +1,185 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package karydia
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/karydia/karydia/pkg/k8sutil"
+	"github.com/karydia/karydia/pkg/k8sutil/scheme"
+)
+
+type internalLoadBalancerAnnotation struct {
+	key   string
+	value string
+}
+
+// internalLoadBalancerAnnotations are the annotations which make the cloud
+// providers create internal load balancers for services. The names of the
+// cloud providers match 'cloudProvider' of the chart.
+var internalLoadBalancerAnnotations = map[string]internalLoadBalancerAnnotation{
+	"AWS":       {key: "service.beta.kubernetes.io/aws-load-balancer-internal", value: "true"},
+	"Azure":     {key: "service.beta.kubernetes.io/azure-load-balancer-internal", value: "true"},
+	"GCP":       {key: "networking.gke.io/load-balancer-type", value: "Internal"},
+	"OpenStack": {key: "service.beta.kubernetes.io/openstack-internal-load-balancer", value: "true"},
+	"AliCloud":  {key: "service.beta.kubernetes.io/alibaba-cloud-loadbalancer-address-type", value: "intranet"},
+}
+
+func (k *KarydiaAdmission) mutateService(svc *corev1.Service, ns *corev1.Namespace) *v1beta1.AdmissionResponse {
+	var patches Patches
+
+	setting := k.getInternalLoadBalancerSetting(svc, ns)
+	if setting.value != "" && setting.value != "none" {
+		patches = mutateServiceInternalLoadBalancer(*svc, setting, patches)
+	}
+
+	return k8sutil.MutatingAdmissionResponse(patches.toBytes())
+}
+
+// validateService validates the service. allocateNodePorts is the value of
+// 'allocateLoadBalancerNodePorts', which is missing in the vendored API.
+// oldExternalIPs are the external IPs of the service before an update.
+func (k *KarydiaAdmission) validateService(svc *corev1.Service, oldExternalIPs []string, allocateNodePorts *bool, ns *corev1.Namespace) *v1beta1.AdmissionResponse {
+	var validationErrors []string
+
+	setting := k.getServiceTypesSetting(svc, ns)
+	if setting.value != "" && setting.value != "none" {
+		validationErrors = validateServiceType(*svc, allocateNodePorts, setting, validationErrors)
+	}
+	setting = k.getServiceExternalIPsSetting(svc, ns)
+	if setting.value != "" {
+		validationErrors = validateServiceExternalIPs(*svc, oldExternalIPs, setting, validationErrors)
+	}
+	setting = k.getInternalLoadBalancerSetting(svc, ns)
+	if setting.value != "" && setting.value != "none" {
+		validationErrors = validateServiceInternalLoadBalancer(*svc, setting, validationErrors)
+	}
+
+	return k8sutil.ValidatingAdmissionResponse(validationErrors)
+}
+
+func (k *KarydiaAdmission) getServiceTypesSetting(svc *corev1.Service, ns *corev1.Namespace) Setting {
+	return k.getSetting("karydia.gardener.cloud/serviceTypes", svc.ObjectMeta, "service", ns, k.getConfigSpec().ServiceTypes)
+}
+
+func (k *KarydiaAdmission) getServiceExternalIPsSetting(svc *corev1.Service, ns *corev1.Namespace) Setting {
+	return k.getSetting("karydia.gardener.cloud/serviceExternalIPs", svc.ObjectMeta, "service", ns, k.getConfigSpec().ServiceExternalIPs)
+}
+
+func (k *KarydiaAdmission) getInternalLoadBalancerSetting(svc *corev1.Service, ns *corev1.Namespace) Setting {
+	return k.getSetting("karydia.gardener.cloud/internalLoadBalancer", svc.ObjectMeta, "service", ns, k.getConfigSpec().InternalLoadBalancer)
+}
+
+// serviceType returns the type of the service, which defaults to 'ClusterIP'
+func serviceType(svc corev1.Service) corev1.ServiceType {
+	if svc.Spec.Type == "" {
+		return corev1.ServiceTypeClusterIP
+	}
+	return svc.Spec.Type
+}
+
+// validateServiceType rejects services whose type is not one of the allowed
+// types, e.g. 'ClusterIP;LoadBalancer'. As load balancer services also expose
+// node ports, they are rejected if 'NodePort' is not allowed and node ports
+// are not disabled with 'allocateLoadBalancerNodePorts: false'.
+func validateServiceType(svc corev1.Service, allocateNodePorts *bool, setting Setting, validationErrors []string) []string {
+	allowed := splitSetting(setting.value)
+	if !contains(allowed, string(serviceType(svc))) {
+		validationErrorMsg := fmt.Sprintf("service type '%s' must be one of '%s'", serviceType(svc), setting.value)
+		validationErrors = append(validationErrors, validationErrorMsg)
+	} else if serviceType(svc) == corev1.ServiceTypeLoadBalancer && !contains(allowed, string(corev1.ServiceTypeNodePort)) && (allocateNodePorts == nil || *allocateNodePorts) {
+		validationErrorMsg := fmt.Sprintf("load balancer must not allocate node ports as service type '%s' is not allowed (requires 'allocateLoadBalancerNodePorts: false')", corev1.ServiceTypeNodePort)
+		validationErrors = append(validationErrors, validationErrorMsg)
+	}
+	return validationErrors
+}
+
+// validateServiceExternalIPs rejects services with external IPs, which allow
+// to intercept the traffic of other pods (CVE-2020-8554). External IPs the
+// service already had before an update are accepted, so existing services
+// can still be updated.
+func validateServiceExternalIPs(svc corev1.Service, oldExternalIPs []string, setting Setting, validationErrors []string) []string {
+	if setting.value != "deny" {
+		return validationErrors
+	}
+	for _, externalIP := range svc.Spec.ExternalIPs {
+		if !contains(oldExternalIPs, externalIP) {
+			validationErrors = append(validationErrors, "external IPs ('externalIPs') must not be used")
+			break
+		}
+	}
+	return validationErrors
+}
+
+// mutateServiceInternalLoadBalancer adds the internal load balancer annotation
+// of the cloud provider to load balancer services without it
+func mutateServiceInternalLoadBalancer(svc corev1.Service, setting Setting, patches Patches) Patches {
+	annotation, ok := internalLoadBalancerAnnotations[setting.value]
+	if !ok || serviceType(svc) != corev1.ServiceTypeLoadBalancer {
+		return patches
+	}
+	if _, ok := svc.Annotations[annotation.key]; ok {
+		return patches
+	}
+	annotateObject(svc.ObjectMeta, &patches, annotation.key, annotation.value)
+	annotateObject(svc.ObjectMeta, &patches, "karydia.gardener.cloud/internalLoadBalancer.internal", setting.src+"/"+setting.value)
+	return patches
+}
+
+// validateServiceInternalLoadBalancer rejects load balancer services without
+// the internal load balancer annotation of the cloud provider
+func validateServiceInternalLoadBalancer(svc corev1.Service, setting Setting, validationErrors []string) []string {
+	if serviceType(svc) != corev1.ServiceTypeLoadBalancer {
+		return validationErrors
+	}
+	annotation, ok := internalLoadBalancerAnnotations[setting.value]
+	if !ok {
+		validationErrorMsg := fmt.Sprintf("internal load balancers of cloud provider '%s' are not supported", setting.value)
+		return append(validationErrors, validationErrorMsg)
+	}
+	if svc.Annotations[annotation.key] != annotation.value {
+		validationErrorMsg := fmt.Sprintf("load balancer must be internal (requires annotation '%s: %s')", annotation.key, annotation.value)
+		validationErrors = append(validationErrors, validationErrorMsg)
+	}
+	return validationErrors
+}
+
+/* Utility functions to decode raw resources into objects */
+func decodeService(raw []byte) (*corev1.Service, error) {
+	svc := &corev1.Service{}
+	deserializer := scheme.Codecs.UniversalDeserializer()
+	if _, _, err := deserializer.Decode(raw, nil, svc); err != nil {
+		return nil, err
+	}
+	return svc, nil
+}
+
+func decodeAllocateLoadBalancerNodePorts(raw []byte) (*bool, error) {
+	svc := struct {
+		Spec struct {
+			AllocateLoadBalancerNodePorts *bool `json:"allocateLoadBalancerNodePorts"`
+		} `json:"spec"`
+	}{}
+	if err := json.Unmarshal(raw, &svc); err != nil {
+		return nil, err
+	}
+	return svc.Spec.AllocateLoadBalancerNodePorts, nil
+}
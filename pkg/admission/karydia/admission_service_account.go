@@ -29,7 +29,7 @@ import (
 func (k *KarydiaAdmission) mutateServiceAccount(sAcc *corev1.ServiceAccount, ns *corev1.Namespace) *v1beta1.AdmissionResponse {
 	var patches Patches
 
-	setting := k.getAutomountServiceAccountTokenSetting(ns)
+	setting := k.getAutomountServiceAccountTokenSetting(sAcc, ns)
 	if setting.value != "" {
 		patches = mutateServiceAccountTokenMount(*sAcc, setting, patches)
 	}
@@ -40,7 +40,7 @@ func (k *KarydiaAdmission) mutateServiceAccount(sAcc *corev1.ServiceAccount, ns
 func (k *KarydiaAdmission) validateServiceAccount(sAcc *corev1.ServiceAccount, ns *corev1.Namespace) *v1beta1.AdmissionResponse {
 	var validationErrors []string
 
-	setting := k.getAutomountServiceAccountTokenSetting(ns)
+	setting := k.getAutomountServiceAccountTokenSetting(sAcc, ns)
 	if setting.value != "" {
 		validationErrors = validateServiceAccountTokenMount(*sAcc, setting, validationErrors)
 	}
@@ -48,14 +48,8 @@ func (k *KarydiaAdmission) validateServiceAccount(sAcc *corev1.ServiceAccount, n
 	return k8sutil.ValidatingAdmissionResponse(validationErrors)
 }
 
-func (k *KarydiaAdmission) getAutomountServiceAccountTokenSetting(ns *corev1.Namespace) Setting {
-	automountServiceAccountToken, annotated := ns.ObjectMeta.Annotations["karydia.gardener.cloud/automountServiceAccountToken"]
-	src := "namespace"
-	if !annotated || (ns.Name != "kube-system" && k.karydiaConfig != nil && k.karydiaConfig.Spec.Enforcement == true) {
-		automountServiceAccountToken = k.karydiaConfig.Spec.AutomountServiceAccountToken
-		src = "config"
-	}
-	return Setting{value: automountServiceAccountToken, src: src}
+func (k *KarydiaAdmission) getAutomountServiceAccountTokenSetting(sAcc *corev1.ServiceAccount, ns *corev1.Namespace) Setting {
+	return k.getSetting("karydia.gardener.cloud/automountServiceAccountToken", sAcc.ObjectMeta, "serviceaccount", ns, k.getConfigSpec().AutomountServiceAccountToken)
 }
 
 func validateServiceAccountTokenMount(sAcc corev1.ServiceAccount, setting Setting, validationErrors []string) []string {
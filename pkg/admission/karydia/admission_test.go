@@ -21,6 +21,7 @@ import (
 	"testing"
 
 	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/karydia/karydia/pkg/apis/karydia/v1alpha1"
 	"k8s.io/api/admission/v1beta1"
 	coreV1 "k8s.io/api/core/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -555,6 +556,207 @@ func TestPodCorrectSeccomp(t *testing.T) {
 	}
 }
 
+func TestPodAnnotationOverridesNamespaceAnnotation(t *testing.T) {
+	var kubeobjects []runtime.Object
+
+	namespace := &coreV1.Namespace{}
+	namespace.Name = "special"
+	namespace.Annotations = map[string]string{
+		"karydia.gardener.cloud/seccompProfile": "runtime/default",
+	}
+	kubeobjects = append(kubeobjects, namespace)
+
+	kubeclient := k8sfake.NewSimpleClientset(kubeobjects...)
+
+	karydiaAdmission, err := New(&Config{
+		KubeClientset: kubeclient,
+		KarydiaConfig: &v1alpha1.KarydiaConfig{
+			Spec: v1alpha1.KarydiaConfigSpec{
+				Enforcement:    false,
+				SeccompProfile: "runtime/default",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal("Failed to load karydia admission:", err)
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "karydia-e2e-test-pod",
+			Namespace: "special",
+			Annotations: map[string]string{
+				"karydia.gardener.cloud/seccompProfile": "unconfined",
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:  "nginx",
+					Image: "nginx",
+				},
+			},
+		},
+	}
+	rawPod, _ := json.Marshal(pod)
+
+	ar := v1beta1.AdmissionReview{
+		Request: &v1beta1.AdmissionRequest{
+			Operation: "CREATE",
+			Namespace: "special",
+			Kind:      metav1.GroupVersionKind{Group: "", Version: "v1", Kind: "Pod"},
+			Object: runtime.RawExtension{
+				Raw: rawPod,
+			},
+		},
+	}
+
+	mutationResponse := karydiaAdmission.Admit(ar, true)
+	if !mutationResponse.Allowed {
+		t.Error("expected mutation response to be true but is", mutationResponse.Allowed)
+	}
+
+	mutatedPod, err := patchPodRaw(*pod, mutationResponse.Patch)
+	if err != nil {
+		t.Error("failed to apply patches:", err)
+	}
+
+	if profile := mutatedPod.Annotations["seccomp.security.alpha.kubernetes.io/pod"]; profile != "unconfined" {
+		t.Errorf("expected seccomp profile to be %v but is %v", "unconfined", profile)
+	}
+	if src := mutatedPod.Annotations["karydia.gardener.cloud/seccompProfile.internal"]; src != "pod/unconfined" {
+		t.Errorf("expected internal annotation to be %v but is %v", "pod/unconfined", src)
+	}
+}
+
+func TestPodAnnotationIgnoredWithEnforcement(t *testing.T) {
+	var kubeobjects []runtime.Object
+
+	namespace := &coreV1.Namespace{}
+	namespace.Name = "special"
+	kubeobjects = append(kubeobjects, namespace)
+
+	kubeclient := k8sfake.NewSimpleClientset(kubeobjects...)
+
+	karydiaAdmission, err := New(&Config{
+		KubeClientset: kubeclient,
+		KarydiaConfig: &v1alpha1.KarydiaConfig{
+			Spec: v1alpha1.KarydiaConfigSpec{
+				Enforcement:    true,
+				SeccompProfile: "runtime/default",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal("Failed to load karydia admission:", err)
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "karydia-e2e-test-pod",
+			Namespace: "special",
+			Annotations: map[string]string{
+				"karydia.gardener.cloud/seccompProfile": "unconfined",
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:  "nginx",
+					Image: "nginx",
+				},
+			},
+		},
+	}
+	rawPod, _ := json.Marshal(pod)
+
+	ar := v1beta1.AdmissionReview{
+		Request: &v1beta1.AdmissionRequest{
+			Operation: "CREATE",
+			Namespace: "special",
+			Kind:      metav1.GroupVersionKind{Group: "", Version: "v1", Kind: "Pod"},
+			Object: runtime.RawExtension{
+				Raw: rawPod,
+			},
+		},
+	}
+
+	mutationResponse := karydiaAdmission.Admit(ar, true)
+	if !mutationResponse.Allowed {
+		t.Error("expected mutation response to be true but is", mutationResponse.Allowed)
+	}
+
+	mutatedPod, err := patchPodRaw(*pod, mutationResponse.Patch)
+	if err != nil {
+		t.Error("failed to apply patches:", err)
+	}
+
+	if profile := mutatedPod.Annotations["seccomp.security.alpha.kubernetes.io/pod"]; profile != "runtime/default" {
+		t.Errorf("expected seccomp profile to be %v but is %v", "runtime/default", profile)
+	}
+	if src := mutatedPod.Annotations["karydia.gardener.cloud/seccompProfile.internal"]; src != "config/runtime/default" {
+		t.Errorf("expected internal annotation to be %v but is %v", "config/runtime/default", src)
+	}
+}
+
+func TestServiceAccountAnnotationOverridesNamespaceAnnotation(t *testing.T) {
+	var kubeobjects []runtime.Object
+
+	namespace := &coreV1.Namespace{}
+	namespace.Name = "special"
+	namespace.Annotations = map[string]string{
+		"karydia.gardener.cloud/automountServiceAccountToken": "change-all",
+	}
+	kubeobjects = append(kubeobjects, namespace)
+
+	kubeclient := k8sfake.NewSimpleClientset(kubeobjects...)
+
+	karydiaAdmission, err := New(&Config{
+		KubeClientset: kubeclient,
+	})
+	if err != nil {
+		t.Fatal("Failed to load karydia admission:", err)
+	}
+
+	sAcc := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "karydia-e2e-test-sa",
+			Namespace: "special",
+			Annotations: map[string]string{
+				"karydia.gardener.cloud/automountServiceAccountToken": "no-change",
+			},
+		},
+	}
+	rawServiceAccount, _ := json.Marshal(sAcc)
+
+	ar := v1beta1.AdmissionReview{
+		Request: &v1beta1.AdmissionRequest{
+			Operation: "CREATE",
+			Namespace: "special",
+			Kind:      metav1.GroupVersionKind{Group: "", Version: "v1", Kind: "ServiceAccount"},
+			Object: runtime.RawExtension{
+				Raw: rawServiceAccount,
+			},
+		},
+	}
+
+	mutationResponse := karydiaAdmission.Admit(ar, true)
+	if !mutationResponse.Allowed {
+		t.Error("expected mutation response to be true but is", mutationResponse.Allowed)
+	}
+
+	var patches []patchOperation
+	err = json.Unmarshal(mutationResponse.Patch, &patches)
+	if len(patches) != 0 {
+		t.Error("expected number of patches to be 0 but is", len(patches))
+	}
+
+	validationResponse := karydiaAdmission.Admit(ar, false)
+	if !validationResponse.Allowed {
+		t.Error("expected validation response to be true but is", validationResponse.Allowed)
+	}
+}
+
 func TestServiceAccountPlain(t *testing.T) {
 	var kubeobjects []runtime.Object
 
@@ -927,6 +1129,29 @@ func TestInvalidDecodeOfResources(t *testing.T) {
 	}
 }
 
+func TestValueForNamespace(t *testing.T) {
+	config := "runc;tenant-*=gvisor;tenant-trusted-*=none;untrusted=kata"
+
+	tests := []struct {
+		namespace string
+		value     string
+	}{
+		{"default", "runc"},
+		{"tenant-a", "gvisor"},
+		{"tenant-trusted-b", "none"},
+		{"untrusted", "kata"},
+		{"untrusted-b", "runc"},
+	}
+	for _, tt := range tests {
+		if value := valueForNamespace(config, tt.namespace); value != tt.value {
+			t.Errorf("namespace '%s': expected value '%s' but got '%s'", tt.namespace, tt.value, value)
+		}
+	}
+	if value := valueForNamespace("tenant-*=gvisor", "default"); value != "" {
+		t.Error("expected no value but got:", value)
+	}
+}
+
 /* Helper functions to patch k8s resources */
 func patchPodRaw(pod corev1.Pod, patches []byte) (corev1.Pod, error) {
 	var podJSON []byte
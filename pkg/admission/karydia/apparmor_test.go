@@ -0,0 +1,128 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package karydia
+
+import (
+	"testing"
+
+	"k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+/* Mutating and Validating Webhook
+ * Applies the AppArmor profile to all (init) containers without profile.
+ * kubectl annotate ns default karydia.gardener.cloud/appArmorProfile=runtime/default
+ */
+func TestPodAppArmorDefaultProfile(t *testing.T) {
+	pod := corev1.Pod{}
+	pod.Annotations = map[string]string{
+		"container.apparmor.security.beta.kubernetes.io/nginx": "localhost/nginx",
+	}
+	pod.Spec.InitContainers = []corev1.Container{{Name: "init", Image: "busybox"}}
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "nginx"}, {Name: "sidecar", Image: "busybox"}}
+	var patches Patches
+
+	setting := Setting{value: "runtime/default", src: "namespace"}
+
+	validationErrors := validatePodAppArmorProfile(pod, setting, nil)
+	if len(validationErrors) != 2 {
+		t.Error("expected 2 validationErrors but got:", validationErrors)
+	}
+
+	patches = mutatePodAppArmorProfile(pod, setting, patches)
+	if len(patches.operations) != 3 {
+		t.Error("expected 3 patches but got:", patches.operations)
+	}
+	mutatedPod, err := patchPod(pod, patches)
+	if err != nil {
+		t.Error("failed to apply patches:", err)
+	}
+	for container, profile := range map[string]string{"init": "runtime/default", "nginx": "localhost/nginx", "sidecar": "runtime/default"} {
+		if mutatedPod.Annotations["container.apparmor.security.beta.kubernetes.io/"+container] != profile {
+			t.Errorf("expected AppArmor profile '%s' of container '%s' but got: %v", profile, container, mutatedPod.Annotations)
+		}
+	}
+	if mutatedPod.Annotations["karydia.gardener.cloud/appArmorProfile.internal"] != "namespace/runtime/default" {
+		t.Error("expected internal annotation but got:", mutatedPod.Annotations)
+	}
+
+	validationErrors = validatePodAppArmorProfile(mutatedPod, setting, nil)
+	if len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+
+	patches = mutatePodAppArmorProfile(mutatedPod, setting, Patches{})
+	if len(patches.operations) != 0 {
+		t.Error("expected 0 patches but got:", patches.operations)
+	}
+}
+
+/* Validating Webhook
+ * Rejects AppArmor profiles which are not allowed.
+ * kubectl annotate ns default karydia.gardener.cloud/allowedAppArmorProfiles="runtime/default;localhost/*"
+ */
+func TestPodAllowedAppArmorProfiles(t *testing.T) {
+	pod := corev1.Pod{}
+	pod.Annotations = map[string]string{
+		"container.apparmor.security.beta.kubernetes.io/init":  "runtime/default",
+		"container.apparmor.security.beta.kubernetes.io/nginx": "localhost/nginx",
+		"container.apparmor.security.beta.kubernetes.io/debug": "unconfined",
+	}
+	pod.Spec.InitContainers = []corev1.Container{{Name: "init", Image: "busybox"}}
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "nginx"}}
+	ephemeralContainers := []corev1.Container{{Name: "debug", Image: "busybox"}}
+
+	setting := Setting{value: "runtime/default;localhost/*", src: "namespace"}
+
+	validationErrors := validatePodAllowedAppArmorProfiles(pod, ephemeralContainers, setting, nil)
+	if len(validationErrors) != 1 {
+		t.Error("expected 1 validationError but got:", validationErrors)
+	}
+
+	setting = Setting{value: "runtime/default", src: "namespace"}
+	validationErrors = validatePodAllowedAppArmorProfiles(pod, ephemeralContainers, setting, nil)
+	if len(validationErrors) != 2 {
+		t.Error("expected 2 validationErrors but got:", validationErrors)
+	}
+}
+
+func TestPodAppArmorProfileUpdate(t *testing.T) {
+	namespace := &corev1.Namespace{}
+	namespace.Name = "special"
+	namespace.Annotations = map[string]string{"karydia.gardener.cloud/appArmorProfile": "runtime/default"}
+
+	karydiaAdmission, err := New(&Config{KubeClientset: k8sfake.NewSimpleClientset(namespace)})
+	if err != nil {
+		t.Fatal("Failed to load karydia admission:", err)
+	}
+
+	// AppArmor annotations cannot be added to existing pods, so pods created
+	// before the setting applied are not changed or rejected
+	pod := &corev1.Pod{}
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "nginx"}}
+
+	if response := karydiaAdmission.mutatePod(pod, seccompProfiles{}, namespace, v1beta1.Update); len(response.Patch) != 0 && string(response.Patch) != "null" {
+		t.Error("expected 0 patches but got:", string(response.Patch))
+	}
+	if response := karydiaAdmission.validatePod(pod, nil, seccompProfiles{}, namespace, v1beta1.Update); !response.Allowed {
+		t.Error("expected update to be allowed but got:", response.Result)
+	}
+	if response := karydiaAdmission.validatePod(pod, nil, seccompProfiles{}, namespace, v1beta1.Create); response.Allowed {
+		t.Error("expected create to be rejected")
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package karydia
+
+import (
+	"testing"
+
+	"github.com/karydia/karydia/pkg/apis/karydia/v1alpha1"
+
+	"k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+/* Mutating and Validating Webhook
+ * Drops all capabilities by default and restricts added capabilities.
+ * kubectl annotate ns default karydia.gardener.cloud/capabilities=NET_BIND_SERVICE
+ */
+func TestPodCapabilitiesPlain(t *testing.T) {
+	var patches Patches
+	var validationErrors []string
+
+	pod := corev1.Pod{}
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "nginx"}}
+
+	patches = mutatePodSecurityContext(pod, Setting{value: "nobody", src: "config"}, &nobodyProfile, patches)
+	patches = mutatePodCapabilities(pod, Setting{value: "NET_BIND_SERVICE", src: "namespace"}, patches)
+
+	mutatedPod, err := patchPod(pod, patches)
+	if err != nil {
+		t.Error("failed to apply patches:", err)
+	}
+	secCtx := mutatedPod.Spec.Containers[0].SecurityContext
+	if secCtx == nil || secCtx.AllowPrivilegeEscalation == nil || secCtx.Capabilities == nil {
+		t.Fatal("expected container security context to define allowPrivilegeEscalation and capabilities but got:", secCtx)
+	}
+	if len(secCtx.Capabilities.Drop) != 1 || secCtx.Capabilities.Drop[0] != "ALL" {
+		t.Error("expected capabilities to drop 'ALL' but got:", secCtx.Capabilities.Drop)
+	}
+	if mutatedPod.ObjectMeta.Annotations["karydia.gardener.cloud/capabilities.internal"] != "namespace/NET_BIND_SERVICE" {
+		t.Error("expected internal annotation but got:", mutatedPod.ObjectMeta.Annotations)
+	}
+
+	validationErrors = validatePodCapabilities(mutatedPod, nil, Setting{value: "NET_BIND_SERVICE", src: "namespace"}, validationErrors)
+	if len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+}
+
+func TestPodCapabilitiesDefined(t *testing.T) {
+	var patches Patches
+	var validationErrors []string
+
+	pod := corev1.Pod{}
+	pod.Spec.Containers = []corev1.Container{
+		{
+			Name:  "nginx",
+			Image: "nginx",
+			SecurityContext: &corev1.SecurityContext{
+				Capabilities: &corev1.Capabilities{Add: []corev1.Capability{"CAP_NET_BIND_SERVICE", "SYS_ADMIN"}},
+			},
+		},
+	}
+	ephemeralContainers := []corev1.Container{
+		{
+			Name:            "debug",
+			Image:           "busybox",
+			SecurityContext: &corev1.SecurityContext{Capabilities: &corev1.Capabilities{Add: []corev1.Capability{"SYS_PTRACE"}}},
+		},
+	}
+	setting := Setting{value: "NET_BIND_SERVICE", src: "config"}
+
+	patches = mutatePodCapabilities(pod, setting, patches)
+	if len(patches.operations) != 0 {
+		t.Error("expected 0 patches but got:", patches.operations)
+	}
+	validationErrors = validatePodCapabilities(pod, ephemeralContainers, setting, validationErrors)
+	if len(validationErrors) != 2 {
+		t.Error("expected 2 validationErrors but got:", validationErrors)
+	}
+	validationErrors = validatePodCapabilities(pod, ephemeralContainers, Setting{value: "drop-all", src: "config"}, nil)
+	if len(validationErrors) != 3 {
+		t.Error("expected 3 validationErrors but got:", validationErrors)
+	}
+	validationErrors = validatePodCapabilities(pod, ephemeralContainers, Setting{value: "none", src: "config"}, nil)
+	if len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+}
+
+func TestCapabilitiesWeakens(t *testing.T) {
+	spec := v1alpha1.KarydiaConfigSpec{Capabilities: "NET_BIND_SERVICE;CHOWN"}
+
+	tests := []struct {
+		value   string
+		weakens bool
+	}{
+		{"drop-all", false},
+		{"NET_BIND_SERVICE", false},
+		{"CAP_CHOWN", false},
+		{"SYS_ADMIN", true},
+		{"none", true},
+	}
+	for _, tt := range tests {
+		for _, w := range weakeningAnnotations {
+			if w.annotation == "karydia.gardener.cloud/capabilities" && w.weakens(tt.value, spec) != tt.weakens {
+				t.Errorf("value '%s': expected weakens to be %v", tt.value, tt.weakens)
+			}
+		}
+	}
+}
+
+func TestPodCapabilitiesUpdate(t *testing.T) {
+	namespace := &corev1.Namespace{}
+	namespace.Name = "special"
+	namespace.Annotations = map[string]string{"karydia.gardener.cloud/capabilities": "drop-all"}
+
+	karydiaAdmission, err := New(&Config{KubeClientset: k8sfake.NewSimpleClientset(namespace)})
+	if err != nil {
+		t.Fatal("Failed to load karydia admission:", err)
+	}
+
+	// the security contexts of containers are immutable, so pods created
+	// before the setting applied are not changed or rejected
+	pod := &corev1.Pod{}
+	pod.Spec.Containers = []corev1.Container{
+		{
+			Name:            "nginx",
+			Image:           "nginx",
+			SecurityContext: &corev1.SecurityContext{Capabilities: &corev1.Capabilities{Add: []corev1.Capability{"NET_ADMIN"}}},
+		},
+	}
+
+	if response := karydiaAdmission.mutatePod(pod, seccompProfiles{}, namespace, v1beta1.Update); len(response.Patch) != 0 && string(response.Patch) != "null" {
+		t.Error("expected 0 patches but got:", string(response.Patch))
+	}
+	if response := karydiaAdmission.validatePod(pod, nil, seccompProfiles{}, namespace, v1beta1.Update); !response.Allowed {
+		t.Error("expected update to be allowed but got:", response.Result)
+	}
+	if response := karydiaAdmission.validatePod(pod, nil, seccompProfiles{}, namespace, v1beta1.Create); response.Allowed {
+		t.Error("expected create to be rejected")
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package karydia
+
+import (
+	"testing"
+
+	"k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+/* Mutating and Validating Webhook
+ * Defaults readOnlyRootFilesystem and runAsNonRoot of containers to true.
+ * kubectl annotate ns default karydia.gardener.cloud/containerSecurityContext=harden
+ */
+func TestPodContainerSecurityContextHarden(t *testing.T) {
+	var patches Patches
+	var validationErrors []string
+
+	pod := corev1.Pod{}
+	pod.Spec.InitContainers = []corev1.Container{{Name: "init", Image: "busybox"}}
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "nginx"}}
+
+	setting := Setting{value: "harden", src: "namespace"}
+
+	validationErrors = validatePodContainerSecurityContext(pod, nil, setting, validationErrors)
+	if len(validationErrors) != 4 {
+		t.Error("expected 4 validationErrors but got:", validationErrors)
+	}
+
+	patches = mutatePodSecurityContext(pod, Setting{value: "nobody", src: "config"}, &nobodyProfile, patches)
+	patches = mutatePodContainerSecurityContext(pod, setting, patches)
+	mutatedPod, err := patchPod(pod, patches)
+	if err != nil {
+		t.Fatal("failed to apply patches:", err)
+	}
+	for _, container := range append(mutatedPod.Spec.InitContainers, mutatedPod.Spec.Containers...) {
+		secCtx := container.SecurityContext
+		if secCtx == nil || secCtx.ReadOnlyRootFilesystem == nil || !*secCtx.ReadOnlyRootFilesystem || secCtx.RunAsNonRoot == nil || !*secCtx.RunAsNonRoot {
+			t.Errorf("expected container '%s' to be hardened but got: %v", container.Name, secCtx)
+		}
+	}
+	if mutatedPod.Spec.Containers[0].SecurityContext.AllowPrivilegeEscalation == nil {
+		t.Error("expected allowPrivilegeEscalation to be defined")
+	}
+	if mutatedPod.ObjectMeta.Annotations["karydia.gardener.cloud/containerSecurityContext.internal"] != "namespace/harden" {
+		t.Error("expected internal annotation but got:", mutatedPod.ObjectMeta.Annotations)
+	}
+
+	validationErrors = validatePodContainerSecurityContext(mutatedPod, nil, setting, nil)
+	if len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+}
+
+func TestPodContainerSecurityContextDefined(t *testing.T) {
+	var patches Patches
+
+	readOnly := false
+	nonRoot := false
+	pod := corev1.Pod{}
+	pod.Spec.SecurityContext = &corev1.PodSecurityContext{RunAsNonRoot: &nonRoot}
+	pod.Spec.Containers = []corev1.Container{
+		{
+			Name:            "nginx",
+			Image:           "nginx",
+			SecurityContext: &corev1.SecurityContext{ReadOnlyRootFilesystem: &readOnly},
+		},
+	}
+
+	patches = mutatePodContainerSecurityContext(pod, Setting{value: "harden", src: "config"}, patches)
+	if len(patches.operations) != 0 {
+		t.Error("expected 0 patches but got:", patches.operations)
+	}
+	validationErrors := validatePodContainerSecurityContext(pod, nil, Setting{value: "harden", src: "config"}, nil)
+	if len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+}
+
+func TestPodContainerSecurityContextValidate(t *testing.T) {
+	var patches Patches
+
+	readOnly := true
+	nonRoot := false
+	pod := corev1.Pod{}
+	pod.Spec.Containers = []corev1.Container{
+		{
+			Name:            "nginx",
+			Image:           "nginx",
+			SecurityContext: &corev1.SecurityContext{ReadOnlyRootFilesystem: &readOnly, RunAsNonRoot: &nonRoot},
+		},
+	}
+	ephemeralContainers := []corev1.Container{{Name: "debug", Image: "busybox"}}
+
+	setting := Setting{value: "validate", src: "config"}
+
+	patches = mutatePodContainerSecurityContext(pod, setting, patches)
+	if len(patches.operations) != 0 {
+		t.Error("expected 0 patches but got:", patches.operations)
+	}
+	validationErrors := validatePodContainerSecurityContext(pod, ephemeralContainers, setting, nil)
+	if len(validationErrors) != 3 {
+		t.Error("expected 3 validationErrors but got:", validationErrors)
+	}
+}
+
+func TestPodContainerSecurityContextUpdate(t *testing.T) {
+	namespace := &corev1.Namespace{}
+	namespace.Name = "special"
+	namespace.Annotations = map[string]string{"karydia.gardener.cloud/containerSecurityContext": "harden"}
+
+	karydiaAdmission, err := New(&Config{KubeClientset: k8sfake.NewSimpleClientset(namespace)})
+	if err != nil {
+		t.Fatal("Failed to load karydia admission:", err)
+	}
+
+	// the security contexts of containers are immutable, so pods created
+	// before the setting applied are not changed or rejected
+	pod := &corev1.Pod{}
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "nginx"}}
+
+	if response := karydiaAdmission.mutatePod(pod, seccompProfiles{}, namespace, v1beta1.Update); len(response.Patch) != 0 && string(response.Patch) != "null" {
+		t.Error("expected 0 patches but got:", string(response.Patch))
+	}
+	if response := karydiaAdmission.validatePod(pod, nil, seccompProfiles{}, namespace, v1beta1.Update); !response.Allowed {
+		t.Error("expected update to be allowed but got:", response.Result)
+	}
+	if response := karydiaAdmission.validatePod(pod, nil, seccompProfiles{}, namespace, v1beta1.Create); response.Allowed {
+		t.Error("expected create to be rejected")
+	}
+}
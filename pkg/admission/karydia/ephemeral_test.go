@@ -0,0 +1,291 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package karydia
+
+import (
+	"encoding/json"
+	"testing"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func newEphemeralTestAdmission(t *testing.T, kubeobjects ...runtime.Object) *KarydiaAdmission {
+	namespace := &corev1.Namespace{}
+	namespace.Name = "special"
+	namespace.Annotations = map[string]string{
+		"karydia.gardener.cloud/podSecurityContext": "nobody",
+		"karydia.gardener.cloud/hostIsolation":      "restricted",
+	}
+	kubeobjects = append(kubeobjects, namespace)
+
+	karydiaAdmission, err := New(&Config{
+		KubeClientset: k8sfake.NewSimpleClientset(kubeobjects...),
+	})
+	if err != nil {
+		t.Fatal("Failed to load karydia admission:", err)
+	}
+	return karydiaAdmission
+}
+
+func TestPodInitContainersSecContext(t *testing.T) {
+	var patches Patches
+	var validationErrors []string
+
+	pod := corev1.Pod{}
+	pod.Spec.InitContainers = []corev1.Container{{Name: "init", Image: "busybox"}}
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "nginx"}}
+
+	setting := Setting{value: "nobody", src: "config"}
+
+	validationErrors = validatePodSecurityContext(pod, []corev1.Container{{Name: "debug", Image: "busybox"}}, &nobodyProfile, validationErrors)
+	if len(validationErrors) != 4 {
+		t.Error("expected 4 validationErrors but got:", validationErrors)
+	}
+
+	patches = mutatePodSecurityContext(pod, setting, &nobodyProfile, patches)
+	mutatedPod, err := patchPod(pod, patches)
+	if err != nil {
+		t.Fatal("failed to apply patches:", err)
+	}
+	for _, container := range append(mutatedPod.Spec.InitContainers, mutatedPod.Spec.Containers...) {
+		if container.SecurityContext == nil || container.SecurityContext.AllowPrivilegeEscalation == nil || *container.SecurityContext.AllowPrivilegeEscalation {
+			t.Errorf("expected allowPrivilegeEscalation of container '%s' to be false", container.Name)
+		}
+	}
+	validationErrors = validatePodSecurityContext(mutatedPod, nil, &nobodyProfile, nil)
+	if len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+}
+
+/* Admission of the 'pods/ephemeralcontainers' subresource with the pod as
+ * object (Kubernetes >= 1.23)
+ */
+func TestPodEphemeralContainersSubResource(t *testing.T) {
+	karydiaAdmission := newEphemeralTestAdmission(t)
+
+	oldPod := []byte(`{"metadata":{"name":"karydia-e2e-test-pod","namespace":"special"},"spec":{"containers":[{"name":"nginx","image":"nginx"}],"ephemeralContainers":[{"name":"debug-old","image":"busybox"}]}}`)
+	newPod := []byte(`{"metadata":{"name":"karydia-e2e-test-pod","namespace":"special"},"spec":{"containers":[{"name":"nginx","image":"nginx"}],"ephemeralContainers":[{"name":"debug-old","image":"busybox"},{"name":"debug","image":"busybox"}]}}`)
+
+	ar := v1beta1.AdmissionReview{
+		Request: &v1beta1.AdmissionRequest{
+			Operation:   "UPDATE",
+			Namespace:   "special",
+			Name:        "karydia-e2e-test-pod",
+			Kind:        metav1.GroupVersionKind{Group: "", Version: "v1", Kind: "Pod"},
+			SubResource: "ephemeralcontainers",
+			Object:      runtime.RawExtension{Raw: newPod},
+			OldObject:   runtime.RawExtension{Raw: oldPod},
+		},
+	}
+
+	mutationResponse := karydiaAdmission.Admit(ar, true)
+	if !mutationResponse.Allowed {
+		t.Error("expected mutation response to be true but is", mutationResponse.Allowed)
+	}
+
+	var patches []patchOperation
+	if err := json.Unmarshal(mutationResponse.Patch, &patches); err != nil {
+		t.Fatal("failed to decode patches:", err)
+	}
+	if len(patches) != 2 {
+		t.Error("expected number of patches to be 2 but is", len(patches))
+	}
+	for _, patch := range patches {
+		if patch.Path != "/spec/ephemeralContainers/1/securityContext" && patch.Path != "/spec/ephemeralContainers/1/securityContext/privileged" {
+			t.Error("expected only the new ephemeral container to be patched but got:", patch)
+		}
+	}
+
+	patchObj, err := jsonpatch.DecodePatch(mutationResponse.Patch)
+	if err != nil {
+		t.Fatal("failed to decode patches:", err)
+	}
+	mutatedPod, err := patchObj.Apply(newPod)
+	if err != nil {
+		t.Fatal("failed to apply patches:", err)
+	}
+	ephemeralContainers, err := decodeEphemeralContainers(mutatedPod)
+	if err != nil {
+		t.Fatal("failed to decode ephemeral containers:", err)
+	}
+	secCtx := ephemeralContainers[1].SecurityContext
+	if secCtx == nil || secCtx.AllowPrivilegeEscalation == nil || secCtx.Privileged == nil {
+		t.Error("expected security context of ephemeral container to be defaulted but got:", secCtx)
+	}
+}
+
+/* Admission of the 'pods/ephemeralcontainers' subresource with an
+ * 'EphemeralContainers' object (Kubernetes < 1.23)
+ */
+func TestEphemeralContainersSubResource(t *testing.T) {
+	var uid int64 = 65534
+	privilegeEscalation := false
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "karydia-e2e-test-pod",
+			Namespace: "special",
+		},
+		Spec: corev1.PodSpec{
+			SecurityContext: &corev1.PodSecurityContext{RunAsUser: &uid},
+			Containers: []corev1.Container{
+				{
+					Name:            "nginx",
+					Image:           "nginx",
+					SecurityContext: &corev1.SecurityContext{AllowPrivilegeEscalation: &privilegeEscalation},
+				},
+			},
+		},
+	}
+	karydiaAdmission := newEphemeralTestAdmission(t, pod)
+
+	ephemeralContainers := []byte(`{"kind":"EphemeralContainers","apiVersion":"v1","metadata":{"name":"karydia-e2e-test-pod","namespace":"special"},"ephemeralContainers":[{"name":"debug","image":"busybox","securityContext":{"privileged":true}}]}`)
+
+	ar := v1beta1.AdmissionReview{
+		Request: &v1beta1.AdmissionRequest{
+			Operation:   "UPDATE",
+			Namespace:   "special",
+			Name:        "karydia-e2e-test-pod",
+			Kind:        metav1.GroupVersionKind{Group: "", Version: "v1", Kind: "EphemeralContainers"},
+			SubResource: "ephemeralcontainers",
+			Object:      runtime.RawExtension{Raw: ephemeralContainers},
+		},
+	}
+
+	mutationResponse := karydiaAdmission.Admit(ar, true)
+	if !mutationResponse.Allowed {
+		t.Error("expected mutation response to be true but is", mutationResponse.Allowed)
+	}
+
+	var patches []patchOperation
+	if err := json.Unmarshal(mutationResponse.Patch, &patches); err != nil {
+		t.Fatal("failed to decode patches:", err)
+	}
+	if len(patches) != 1 || patches[0].Path != "/ephemeralContainers/0/securityContext/allowPrivilegeEscalation" {
+		t.Error("expected allowPrivilegeEscalation of ephemeral container to be patched but got:", patches)
+	}
+
+	validationResponse := karydiaAdmission.Admit(ar, false)
+	if validationResponse.Allowed {
+		t.Error("expected validation response to be false but is", validationResponse.Allowed)
+	}
+}
+
+/* Validating Webhook
+ * Checks the seccomp profiles of ephemeral containers added through the
+ * 'EphemeralContainers' object, which are not part of the fetched pod.
+ * kubectl annotate ns special karydia.gardener.cloud/allowedSeccompProfiles=runtime/default
+ */
+func TestEphemeralContainersSubResourceSeccompProfiles(t *testing.T) {
+	namespace := &corev1.Namespace{}
+	namespace.Name = "special"
+	namespace.Annotations = map[string]string{"karydia.gardener.cloud/allowedSeccompProfiles": "runtime/default"}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "karydia-e2e-test-pod",
+			Namespace:   "special",
+			Annotations: map[string]string{"seccomp.security.alpha.kubernetes.io/pod": "runtime/default"},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "nginx", Image: "nginx"}},
+		},
+	}
+
+	karydiaAdmission, err := New(&Config{KubeClientset: k8sfake.NewSimpleClientset(namespace, pod)})
+	if err != nil {
+		t.Fatal("Failed to load karydia admission:", err)
+	}
+
+	tests := []struct {
+		profile string
+		allowed bool
+	}{
+		{"RuntimeDefault", true},
+		{"Unconfined", false},
+	}
+	for _, test := range tests {
+		ephemeralContainers := []byte(`{"kind":"EphemeralContainers","apiVersion":"v1","metadata":{"name":"karydia-e2e-test-pod","namespace":"special"},"ephemeralContainers":[{"name":"debug","image":"busybox","securityContext":{"seccompProfile":{"type":"` + test.profile + `"}}}]}`)
+		ar := v1beta1.AdmissionReview{
+			Request: &v1beta1.AdmissionRequest{
+				Operation:   "UPDATE",
+				Namespace:   "special",
+				Name:        "karydia-e2e-test-pod",
+				Kind:        metav1.GroupVersionKind{Group: "", Version: "v1", Kind: "EphemeralContainers"},
+				SubResource: "ephemeralcontainers",
+				Object:      runtime.RawExtension{Raw: ephemeralContainers},
+			},
+		}
+		if response := karydiaAdmission.Admit(ar, false); response.Allowed != test.allowed {
+			t.Errorf("%s: expected validation response to be %v but got: %v", test.profile, test.allowed, response.Result)
+		}
+	}
+}
+
+func TestEphemeralContainersSubResourceExistingViolations(t *testing.T) {
+	var uid int64 = 65534
+	privilegeEscalation := false
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "karydia-e2e-test-pod",
+			Namespace: "special",
+		},
+		Spec: corev1.PodSpec{
+			// created before host isolation was restricted
+			HostNetwork:     true,
+			SecurityContext: &corev1.PodSecurityContext{RunAsUser: &uid},
+			Containers: []corev1.Container{
+				{
+					Name:            "nginx",
+					Image:           "nginx",
+					SecurityContext: &corev1.SecurityContext{AllowPrivilegeEscalation: &privilegeEscalation},
+				},
+			},
+		},
+	}
+	karydiaAdmission := newEphemeralTestAdmission(t, pod)
+
+	oldEphemeralContainers := []byte(`{"kind":"EphemeralContainers","apiVersion":"v1","metadata":{"name":"karydia-e2e-test-pod","namespace":"special"},"ephemeralContainers":[{"name":"old","image":"busybox","securityContext":{"privileged":true}}]}`)
+	tests := []struct {
+		securityContext string
+		allowed         bool
+	}{
+		{`{"allowPrivilegeEscalation":false}`, true},
+		{`{"allowPrivilegeEscalation":false,"privileged":true}`, false},
+	}
+	for _, test := range tests {
+		ephemeralContainers := []byte(`{"kind":"EphemeralContainers","apiVersion":"v1","metadata":{"name":"karydia-e2e-test-pod","namespace":"special"},"ephemeralContainers":[{"name":"old","image":"busybox","securityContext":{"privileged":true}},{"name":"debug","image":"busybox","securityContext":` + test.securityContext + `}]}`)
+		ar := v1beta1.AdmissionReview{
+			Request: &v1beta1.AdmissionRequest{
+				Operation:   "UPDATE",
+				Namespace:   "special",
+				Name:        "karydia-e2e-test-pod",
+				Kind:        metav1.GroupVersionKind{Group: "", Version: "v1", Kind: "EphemeralContainers"},
+				SubResource: "ephemeralcontainers",
+				Object:      runtime.RawExtension{Raw: ephemeralContainers},
+				OldObject:   runtime.RawExtension{Raw: oldEphemeralContainers},
+			},
+		}
+		if response := karydiaAdmission.Admit(ar, false); response.Allowed != test.allowed {
+			t.Errorf("%s: expected validation response to be %v but got: %v", test.securityContext, test.allowed, response.Result)
+		}
+	}
+}
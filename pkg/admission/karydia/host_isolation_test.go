@@ -0,0 +1,140 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package karydia
+
+import (
+	"testing"
+
+	"k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+/* Mutating and Validating Webhook
+ * Rejects privileged containers and the usage of host namespaces and ports.
+ * kubectl annotate ns default karydia.gardener.cloud/hostIsolation=restricted
+ */
+func TestPodHostIsolationPlain(t *testing.T) {
+	var patches Patches
+	var validationErrors []string
+
+	pod := corev1.Pod{}
+	pod.Spec.InitContainers = []corev1.Container{{Name: "init", Image: "busybox"}}
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "nginx"}}
+
+	setting := Setting{value: "restricted", src: "namespace"}
+
+	patches = mutatePodHostIsolation(pod, setting, patches)
+	if len(patches.operations) != 3 {
+		t.Error("expected 3 patches but got:", patches.operations)
+	}
+	mutatedPod, err := patchPod(pod, patches)
+	if err != nil {
+		t.Error("failed to apply patches:", err)
+	}
+	for _, container := range append(mutatedPod.Spec.InitContainers, mutatedPod.Spec.Containers...) {
+		if container.SecurityContext == nil || container.SecurityContext.Privileged == nil || *container.SecurityContext.Privileged {
+			t.Errorf("expected container '%s' to be unprivileged", container.Name)
+		}
+	}
+	// Zero validation errors expected for mutated and initial pod
+	validationErrors = validatePodHostIsolation(mutatedPod, nil, setting, validationErrors)
+	if len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+	validationErrors = validatePodHostIsolation(pod, nil, setting, validationErrors)
+	if len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+}
+
+func TestPodHostIsolationViolations(t *testing.T) {
+	var patches Patches
+	var validationErrors []string
+
+	privileged := true
+	pod := corev1.Pod{}
+	pod.Spec.HostNetwork = true
+	pod.Spec.HostPID = true
+	pod.Spec.HostIPC = true
+	pod.Spec.Containers = []corev1.Container{
+		{
+			Name:            "nginx",
+			Image:           "nginx",
+			SecurityContext: &corev1.SecurityContext{Privileged: &privileged},
+			Ports:           []corev1.ContainerPort{{ContainerPort: 80, HostPort: 8080}, {ContainerPort: 443}},
+		},
+	}
+	ephemeralContainers := []corev1.Container{{Name: "debug", Image: "busybox", SecurityContext: &corev1.SecurityContext{Privileged: &privileged}}}
+
+	setting := Setting{value: "restricted", src: "config"}
+
+	patches = mutatePodHostIsolation(pod, setting, patches)
+	if len(patches.operations) != 0 {
+		t.Error("expected 0 patches but got:", patches.operations)
+	}
+	validationErrors = validatePodHostIsolation(pod, ephemeralContainers, setting, validationErrors)
+	if len(validationErrors) != 6 {
+		t.Error("expected 6 validationErrors but got:", validationErrors)
+	}
+}
+
+func TestPodHostIsolationWithSecurityContext(t *testing.T) {
+	var patches Patches
+
+	pod := corev1.Pod{}
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "nginx"}}
+
+	patches = mutatePodSecurityContext(pod, Setting{value: "nobody", src: "config"}, &nobodyProfile, patches)
+	patches = mutatePodHostIsolation(pod, Setting{value: "restricted", src: "config"}, patches)
+
+	mutatedPod, err := patchPod(pod, patches)
+	if err != nil {
+		t.Error("failed to apply patches:", err)
+	}
+	secCtx := mutatedPod.Spec.Containers[0].SecurityContext
+	if secCtx == nil || secCtx.Privileged == nil || secCtx.AllowPrivilegeEscalation == nil {
+		t.Error("expected container security context to define privileged and allowPrivilegeEscalation but got:", secCtx)
+	}
+}
+
+func TestPodHostIsolationUpdate(t *testing.T) {
+	namespace := &corev1.Namespace{}
+	namespace.Name = "special"
+	namespace.Annotations = map[string]string{"karydia.gardener.cloud/hostIsolation": "restricted"}
+
+	karydiaAdmission, err := New(&Config{KubeClientset: k8sfake.NewSimpleClientset(namespace)})
+	if err != nil {
+		t.Fatal("Failed to load karydia admission:", err)
+	}
+
+	// host namespaces and security contexts are immutable, so pods created
+	// before the setting applied are not changed or rejected
+	pod := &corev1.Pod{}
+	pod.Spec.HostNetwork = true
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "nginx"}}
+
+	if response := karydiaAdmission.mutatePod(pod, seccompProfiles{}, namespace, v1beta1.Update); len(response.Patch) != 0 && string(response.Patch) != "null" {
+		t.Error("expected 0 patches but got:", string(response.Patch))
+	}
+	if response := karydiaAdmission.validatePod(pod, nil, seccompProfiles{}, namespace, v1beta1.Update); !response.Allowed {
+		t.Error("expected update to be allowed but got:", response.Result)
+	}
+	if response := karydiaAdmission.validatePod(pod, nil, seccompProfiles{}, namespace, v1beta1.Create); response.Allowed {
+		t.Error("expected create to be rejected")
+	}
+}
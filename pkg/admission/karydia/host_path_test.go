@@ -0,0 +1,174 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package karydia
+
+import (
+	"testing"
+
+	"github.com/karydia/karydia/pkg/apis/karydia/v1alpha1"
+
+	"k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func hostPathPod(hostPath string, readOnly bool) corev1.Pod {
+	pod := corev1.Pod{}
+	pod.Spec.Volumes = []corev1.Volume{
+		{
+			Name:         "host",
+			VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: hostPath}},
+		},
+	}
+	pod.Spec.Containers = []corev1.Container{
+		{
+			Name:         "nginx",
+			Image:        "nginx",
+			VolumeMounts: []corev1.VolumeMount{{Name: "host", MountPath: "/host", ReadOnly: readOnly}},
+		},
+	}
+	return pod
+}
+
+/* Validating Webhook
+ * Rejects hostPath volumes which are not allowed.
+ * kubectl annotate ns default karydia.gardener.cloud/hostPathVolumes="/var/log:ro;/data"
+ */
+func TestPodHostPathVolumes(t *testing.T) {
+	setting := Setting{value: "/var/log:ro;/data", src: "namespace"}
+
+	tests := []struct {
+		hostPath string
+		readOnly bool
+		errors   int
+	}{
+		{"/data", false, 0},
+		{"/data/app", false, 0},
+		{"/data/../data/app/", false, 0},
+		{"/database", false, 1},
+		{"/var/log", true, 0},
+		{"/var/log/pods", true, 0},
+		{"/var/log", false, 1},
+		{"/etc", true, 1},
+		{"/", true, 1},
+		{"/proc", true, 1},
+		{"/proc/1/root", true, 1},
+		{"/var/run/docker.sock", true, 1},
+		{"/var/run", true, 1},
+		{"/run", true, 1},
+	}
+	for _, tt := range tests {
+		validationErrors := validatePodHostPathVolumes(hostPathPod(tt.hostPath, tt.readOnly), nil, setting, nil)
+		if len(validationErrors) != tt.errors {
+			t.Errorf("host path '%s' (read-only %v): expected %d validationErrors but got: %v", tt.hostPath, tt.readOnly, tt.errors, validationErrors)
+		}
+	}
+}
+
+func TestPodHostPathVolumesDeniedPaths(t *testing.T) {
+	setting := Setting{value: "/", src: "config"}
+
+	for _, hostPath := range []string{"/", "/proc/sys", "/var/run/docker.sock", "/var/run", "/run", "/var"} {
+		validationErrors := validatePodHostPathVolumes(hostPathPod(hostPath, true), nil, setting, nil)
+		if len(validationErrors) != 1 {
+			t.Errorf("host path '%s': expected 1 validationError but got: %v", hostPath, validationErrors)
+		}
+	}
+	validationErrors := validatePodHostPathVolumes(hostPathPod("/etc", false), nil, setting, nil)
+	if len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+}
+
+func TestPodHostPathVolumesDenyAndNone(t *testing.T) {
+	pod := hostPathPod("/data", false)
+
+	validationErrors := validatePodHostPathVolumes(pod, nil, Setting{value: "deny", src: "config"}, nil)
+	if len(validationErrors) != 1 {
+		t.Error("expected 1 validationError but got:", validationErrors)
+	}
+	validationErrors = validatePodHostPathVolumes(hostPathPod("/var/run/docker.sock", false), nil, Setting{value: "none", src: "config"}, nil)
+	if len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+}
+
+func TestPodHostPathVolumesEphemeralContainer(t *testing.T) {
+	pod := hostPathPod("/var/log", true)
+	ephemeralContainers := []corev1.Container{
+		{
+			Name:         "debug",
+			Image:        "busybox",
+			VolumeMounts: []corev1.VolumeMount{{Name: "host", MountPath: "/host"}},
+		},
+	}
+
+	validationErrors := validatePodHostPathVolumes(pod, ephemeralContainers, Setting{value: "/var/log:ro", src: "config"}, nil)
+	if len(validationErrors) != 1 {
+		t.Error("expected 1 validationError but got:", validationErrors)
+	}
+}
+
+func TestHostPathVolumesWeakens(t *testing.T) {
+	spec := v1alpha1.KarydiaConfigSpec{HostPathVolumes: "/var/log:ro;/data"}
+
+	tests := []struct {
+		value   string
+		weakens bool
+	}{
+		{"deny", false},
+		{"/data/app", false},
+		{"/var/log/pods:ro", false},
+		{"/var/log", true},
+		{"/etc:ro", true},
+		{"none", true},
+	}
+	for _, tt := range tests {
+		if hostPathVolumesWeakens(tt.value, spec) != tt.weakens {
+			t.Errorf("value '%s': expected weakens to be %v", tt.value, tt.weakens)
+		}
+	}
+	if hostPathVolumesWeakens("none", v1alpha1.KarydiaConfigSpec{HostPathVolumes: "none"}) {
+		t.Error("expected 'none' not to weaken disabled config")
+	}
+}
+
+func TestPodHostPathVolumesUpdate(t *testing.T) {
+	namespace := &corev1.Namespace{}
+	namespace.Name = "special"
+	namespace.Annotations = map[string]string{"karydia.gardener.cloud/hostPathVolumes": "deny"}
+
+	karydiaAdmission, err := New(&Config{KubeClientset: k8sfake.NewSimpleClientset(namespace)})
+	if err != nil {
+		t.Fatal("Failed to load karydia admission:", err)
+	}
+
+	// the volumes of a pod are immutable, so pods created before the setting
+	// applied are not rejected
+	logPod := hostPathPod("/var/log", false)
+	pod := &logPod
+
+	if response := karydiaAdmission.mutatePod(pod, seccompProfiles{}, namespace, v1beta1.Update); len(response.Patch) != 0 && string(response.Patch) != "null" {
+		t.Error("expected 0 patches but got:", string(response.Patch))
+	}
+	if response := karydiaAdmission.validatePod(pod, nil, seccompProfiles{}, namespace, v1beta1.Update); !response.Allowed {
+		t.Error("expected update to be allowed but got:", response.Result)
+	}
+	if response := karydiaAdmission.validatePod(pod, nil, seccompProfiles{}, namespace, v1beta1.Create); response.Allowed {
+		t.Error("expected create to be rejected")
+	}
+}
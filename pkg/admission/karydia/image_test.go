@@ -0,0 +1,306 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package karydia
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseImage(t *testing.T) {
+	tests := []struct {
+		image    string
+		expected imageReference
+	}{
+		{"nginx", imageReference{registry: "docker.io", repository: "library/nginx"}},
+		{"nginx:1.17", imageReference{registry: "docker.io", repository: "library/nginx", tag: "1.17"}},
+		{"karydia/karydia:latest", imageReference{registry: "docker.io", repository: "karydia/karydia", tag: "latest"}},
+		{"eu.gcr.io/gardener-project/karydia/karydia", imageReference{registry: "eu.gcr.io", repository: "gardener-project/karydia/karydia"}},
+		{"localhost:5000/nginx:1.17", imageReference{registry: "localhost:5000", repository: "nginx", tag: "1.17"}},
+		{"localhost/nginx", imageReference{registry: "localhost", repository: "nginx"}},
+		{"mirror.local/nginx@sha256:abc", imageReference{registry: "mirror.local", repository: "nginx", digest: "sha256:abc"}},
+		{"mirror.local:443/nginx:1.17@sha256:abc", imageReference{registry: "mirror.local:443", repository: "nginx", tag: "1.17", digest: "sha256:abc"}},
+	}
+	for _, test := range tests {
+		if ref := parseImage(test.image); ref != test.expected {
+			t.Errorf("expected image '%s' to be parsed as %+v but got %+v", test.image, test.expected, ref)
+		}
+	}
+}
+
+/* Validating Webhook
+ * Rejects pods with images from registries which are not allowed.
+ * kubectl annotate ns default karydia.gardener.cloud/imageRegistries="mirror.local;gcr.io/my-project"
+ */
+func TestPodImageRegistriesAllowed(t *testing.T) {
+	var validationErrors []string
+
+	pod := corev1.Pod{}
+	pod.Spec.InitContainers = []corev1.Container{{Name: "init", Image: "gcr.io/my-project/init:1.0"}}
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "mirror.local/nginx:1.17"}}
+
+	setting := Setting{value: "mirror.local;gcr.io/my-project", src: "namespace"}
+
+	validationErrors = validatePodImageRegistries(pod, nil, setting, validationErrors)
+	if len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+}
+
+func TestPodImageRegistriesNotAllowed(t *testing.T) {
+	var validationErrors []string
+
+	pod := corev1.Pod{}
+	pod.Spec.InitContainers = []corev1.Container{{Name: "init", Image: "gcr.io/other-project/init:1.0"}}
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "nginx"}, {Name: "sidecar", Image: "mirror.local/sidecar"}}
+	ephemeralContainers := []corev1.Container{{Name: "debug", Image: "mirror.local.evil.com/busybox"}}
+
+	setting := Setting{value: "mirror.local;gcr.io/my-project", src: "config"}
+
+	validationErrors = validatePodImageRegistries(pod, ephemeralContainers, setting, validationErrors)
+	if len(validationErrors) != 3 {
+		t.Error("expected 3 validationErrors but got:", validationErrors)
+	}
+}
+
+func TestPodImageRegistriesDockerHub(t *testing.T) {
+	var validationErrors []string
+
+	pod := corev1.Pod{}
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "nginx"}, {Name: "karydia", Image: "karydia/karydia"}}
+
+	setting := Setting{value: "docker.io/library", src: "config"}
+
+	validationErrors = validatePodImageRegistries(pod, nil, setting, validationErrors)
+	if len(validationErrors) != 1 {
+		t.Error("expected 1 validationErrors but got:", validationErrors)
+	}
+}
+
+type fakeDigestResolver map[string]string
+
+func (r fakeDigestResolver) Resolve(ctx context.Context, registry, repository, tag string) (string, error) {
+	digest, ok := r[registry+"/"+repository+":"+tag]
+	if !ok {
+		return "", fmt.Errorf("unknown image")
+	}
+	return digest, nil
+}
+
+/* Validating Webhook
+ * Rejects pods with images without tag or with tag 'latest'.
+ * kubectl annotate ns default karydia.gardener.cloud/imageTagPolicy=reject-mutable
+ */
+func TestPodImageTagsRejectMutable(t *testing.T) {
+	var validationErrors []string
+
+	pod := corev1.Pod{}
+	pod.Spec.InitContainers = []corev1.Container{{Name: "init", Image: "busybox"}}
+	pod.Spec.Containers = []corev1.Container{
+		{Name: "nginx", Image: "nginx:latest"},
+		{Name: "pinned", Image: "nginx@sha256:abc"},
+		{Name: "tagged", Image: "localhost:5000/nginx:1.17"},
+	}
+
+	setting := Setting{value: "reject-mutable", src: "namespace"}
+
+	validationErrors = validatePodImageTags(pod, nil, setting, validationErrors)
+	if len(validationErrors) != 2 {
+		t.Error("expected 2 validationErrors but got:", validationErrors)
+	}
+}
+
+/* Mutating and Validating Webhook
+ * Pins image tags to digests.
+ * kubectl annotate ns default karydia.gardener.cloud/imageTagPolicy=pin-digest
+ */
+func TestPodImageTagsPinDigest(t *testing.T) {
+	var patches Patches
+	var validationErrors []string
+
+	karydiaAdmission, err := New(&Config{
+		DigestResolver: fakeDigestResolver{
+			"docker.io/library/busybox:latest": "sha256:111",
+			"docker.io/library/nginx:1.17":     "sha256:222",
+		},
+	})
+	if err != nil {
+		t.Fatal("Failed to load karydia admission:", err)
+	}
+
+	pod := corev1.Pod{}
+	pod.Spec.InitContainers = []corev1.Container{{Name: "init", Image: "busybox"}}
+	pod.Spec.Containers = []corev1.Container{
+		{Name: "nginx", Image: "nginx:1.17"},
+		{Name: "pinned", Image: "nginx@sha256:abc"},
+	}
+
+	setting := Setting{value: "pin-digest", src: "namespace"}
+
+	patches = karydiaAdmission.mutatePodImageTags(pod, Setting{}, setting, patches)
+	if len(patches.operations) != 3 {
+		t.Error("expected 3 patches but got:", patches.operations)
+	}
+	mutatedPod, err := patchPod(pod, patches)
+	if err != nil {
+		t.Error("failed to apply patches:", err)
+	}
+	if image := mutatedPod.Spec.Containers[0].Image; image != "nginx:1.17@sha256:222" {
+		t.Errorf("expected image to be %v but is %v", "nginx:1.17@sha256:222", image)
+	}
+	if image := mutatedPod.Spec.InitContainers[0].Image; image != "busybox@sha256:111" {
+		t.Errorf("expected image to be %v but is %v", "busybox@sha256:111", image)
+	}
+	if src := mutatedPod.Annotations["karydia.gardener.cloud/imageTagPolicy.internal"]; src != "namespace/pin-digest" {
+		t.Errorf("expected internal annotation to be %v but is %v", "namespace/pin-digest", src)
+	}
+	// Zero validation errors expected for mutated pod
+	validationErrors = validatePodImageTags(mutatedPod, nil, setting, validationErrors)
+	if len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+	validationErrors = []string{}
+	// Two validation errors expected for initial pod
+	validationErrors = validatePodImageTags(pod, nil, setting, validationErrors)
+	if len(validationErrors) != 2 {
+		t.Error("expected 2 validationErrors but got:", validationErrors)
+	}
+}
+
+func TestPodImageTagsPinDigestUpdate(t *testing.T) {
+	namespace := &corev1.Namespace{}
+	namespace.Name = "special"
+	namespace.Annotations = map[string]string{"karydia.gardener.cloud/imageTagPolicy": "pin-digest"}
+
+	karydiaAdmission, err := New(&Config{
+		KubeClientset:  k8sfake.NewSimpleClientset(namespace),
+		DigestResolver: fakeDigestResolver{"docker.io/library/nginx:1.17": "sha256:222"},
+	})
+	if err != nil {
+		t.Fatal("Failed to load karydia admission:", err)
+	}
+
+	// changing the image restarts the container, so digests are only pinned
+	// when pods are created and updates only reject mutable tags
+	pod := &corev1.Pod{}
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "nginx:1.17"}}
+
+	if response := karydiaAdmission.mutatePod(pod, seccompProfiles{}, namespace, v1beta1.Update); len(response.Patch) != 0 && string(response.Patch) != "null" {
+		t.Error("expected 0 patches but got:", string(response.Patch))
+	}
+	if response := karydiaAdmission.validatePod(pod, nil, seccompProfiles{}, namespace, v1beta1.Update); !response.Allowed {
+		t.Error("expected update to be allowed but got:", response.Result)
+	}
+	if response := karydiaAdmission.validatePod(pod, nil, seccompProfiles{}, namespace, v1beta1.Create); response.Allowed {
+		t.Error("expected create to be rejected")
+	}
+
+	pod.Spec.Containers[0].Image = "nginx"
+	if response := karydiaAdmission.validatePod(pod, nil, seccompProfiles{}, namespace, v1beta1.Update); response.Allowed {
+		t.Error("expected update with mutable tag to be rejected")
+	}
+}
+
+func TestPodImageTagsPinDigestUnresolvable(t *testing.T) {
+	var patches Patches
+
+	karydiaAdmission, err := New(&Config{
+		DigestResolver: fakeDigestResolver{},
+	})
+	if err != nil {
+		t.Fatal("Failed to load karydia admission:", err)
+	}
+
+	pod := corev1.Pod{}
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "nginx:1.17"}}
+
+	setting := Setting{value: "pin-digest", src: "config"}
+
+	patches = karydiaAdmission.mutatePodImageTags(pod, Setting{}, setting, patches)
+	if len(patches.operations) != 0 {
+		t.Error("expected 0 patches but got:", patches.operations)
+	}
+}
+
+func TestPodImageTagsPinDigestRegistries(t *testing.T) {
+	karydiaAdmission, err := New(&Config{
+		DigestResolver: fakeDigestResolver{
+			"docker.io/library/nginx:1.17":    "sha256:222",
+			"internal.local:5000/app:1.0":     "sha256:333",
+			"gcr.io/my-project/service:2.0.0": "sha256:444",
+		},
+	})
+	if err != nil {
+		t.Fatal("Failed to load karydia admission:", err)
+	}
+
+	pod := corev1.Pod{}
+	pod.Spec.Containers = []corev1.Container{
+		{Name: "nginx", Image: "nginx:1.17"},
+		{Name: "app", Image: "internal.local:5000/app:1.0"},
+		{Name: "service", Image: "gcr.io/my-project/service:2.0.0"},
+	}
+
+	setting := Setting{value: "pin-digest", src: "config"}
+	registries := Setting{value: "docker.io;gcr.io/my-project", src: "config"}
+
+	// only images of the allowed registries are resolved
+	patches := karydiaAdmission.mutatePodImageTags(pod, registries, setting, Patches{})
+	mutatedPod, err := patchPod(pod, patches)
+	if err != nil {
+		t.Fatal("failed to apply patches:", err)
+	}
+	if image := mutatedPod.Spec.Containers[1].Image; image != "internal.local:5000/app:1.0" {
+		t.Errorf("expected image to be %v but is %v", "internal.local:5000/app:1.0", image)
+	}
+	if image := mutatedPod.Spec.Containers[2].Image; image != "gcr.io/my-project/service:2.0.0@sha256:444" {
+		t.Errorf("expected image to be %v but is %v", "gcr.io/my-project/service:2.0.0@sha256:444", image)
+	}
+}
+
+/* Mutating Webhook
+ * Pins the images of ephemeral containers added through the subresource.
+ */
+func TestEphemeralContainersPinDigest(t *testing.T) {
+	karydiaAdmission, err := New(&Config{
+		DigestResolver: fakeDigestResolver{"docker.io/library/busybox:1.31": "sha256:555"},
+	})
+	if err != nil {
+		t.Fatal("Failed to load karydia admission:", err)
+	}
+
+	ns := &corev1.Namespace{}
+	ns.Annotations = map[string]string{"karydia.gardener.cloud/imageTagPolicy": "pin-digest"}
+	pod := &corev1.Pod{}
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "nginx@sha256:abc"}}
+	ephemeralContainers := []corev1.Container{{Name: "debug", Image: "busybox:1.31"}}
+
+	response := karydiaAdmission.mutateEphemeralContainers(pod, ephemeralContainers, nil, "/spec/ephemeralContainers", ns)
+	var operations []patchOperation
+	if err := json.Unmarshal(response.Patch, &operations); err != nil {
+		t.Fatal("failed to decode patches:", err)
+	}
+	if len(operations) != 1 || operations[0].Path != "/spec/ephemeralContainers/0/image" || operations[0].Value != "busybox:1.31@sha256:555" {
+		t.Error("expected image of ephemeral container to be pinned but got:", operations)
+	}
+}
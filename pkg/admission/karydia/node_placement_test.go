@@ -0,0 +1,172 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package karydia
+
+import (
+	"testing"
+
+	"github.com/karydia/karydia/pkg/apis/karydia/v1alpha1"
+
+	"k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+var tenantNodePlacementProfile = v1alpha1.NodePlacementProfile{
+	Name:         "tenant-a",
+	NodeSelector: map[string]string{"pool": "tenant-a"},
+	NodeAffinity: []corev1.NodeSelectorRequirement{
+		{Key: "node.kubernetes.io/instance-type", Operator: corev1.NodeSelectorOpIn, Values: []string{"m5.large"}},
+	},
+	Tolerations: []corev1.Toleration{
+		{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "tenant-a", Effect: corev1.TaintEffectNoSchedule},
+		{Key: "gpu", Operator: corev1.TolerationOpExists},
+	},
+}
+
+/* Mutating and Validating Webhook
+ * Pins pods to the nodes of the node placement profile.
+ * kubectl annotate ns tenant-a karydia.gardener.cloud/nodePlacement=tenant-a
+ */
+func TestPodNodePlacement(t *testing.T) {
+	pod := corev1.Pod{}
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "nginx"}}
+
+	setting := Setting{value: "tenant-a", src: "namespace"}
+
+	validationErrors := validatePodNodePlacement(pod, &tenantNodePlacementProfile, nil)
+	if len(validationErrors) != 2 {
+		t.Error("expected 2 validationErrors but got:", validationErrors)
+	}
+
+	patches := mutatePodNodePlacement(pod, setting, &tenantNodePlacementProfile, Patches{})
+	if len(patches.operations) != 3 {
+		t.Error("expected 3 patches but got:", patches.operations)
+	}
+	mutatedPod, err := patchPod(pod, patches)
+	if err != nil {
+		t.Fatal("failed to apply patches:", err)
+	}
+	if mutatedPod.Spec.NodeSelector["pool"] != "tenant-a" {
+		t.Error("expected node selector 'pool=tenant-a' but got:", mutatedPod.Spec.NodeSelector)
+	}
+	if mutatedPod.Annotations["karydia.gardener.cloud/nodePlacement.internal"] != "namespace/tenant-a" {
+		t.Error("expected internal annotation but got:", mutatedPod.Annotations)
+	}
+	validationErrors = validatePodNodePlacement(mutatedPod, &tenantNodePlacementProfile, nil)
+	if len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+	if patches := mutatePodNodePlacement(mutatedPod, setting, &tenantNodePlacementProfile, Patches{}); len(patches.operations) != 0 {
+		t.Error("expected 0 patches but got:", patches.operations)
+	}
+}
+
+func TestPodNodePlacementMerge(t *testing.T) {
+	pod := corev1.Pod{}
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "nginx"}}
+	pod.Spec.NodeSelector = map[string]string{"pool": "other", "disk": "ssd"}
+	pod.Spec.Affinity = &corev1.Affinity{
+		NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{
+					{MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"a"}}}},
+					{MatchFields: []corev1.NodeSelectorRequirement{{Key: "metadata.name", Operator: corev1.NodeSelectorOpIn, Values: []string{"node-1"}}}},
+				},
+			},
+		},
+	}
+
+	validationErrors := validatePodNodePlacement(pod, &tenantNodePlacementProfile, nil)
+	if len(validationErrors) != 3 {
+		t.Error("expected 3 validationErrors but got:", validationErrors)
+	}
+
+	mutatedPod, err := patchPod(pod, mutatePodNodePlacement(pod, Setting{value: "tenant-a", src: "config"}, &tenantNodePlacementProfile, Patches{}))
+	if err != nil {
+		t.Fatal("failed to apply patches:", err)
+	}
+	if mutatedPod.Spec.NodeSelector["pool"] != "tenant-a" || mutatedPod.Spec.NodeSelector["disk"] != "ssd" {
+		t.Error("expected merged node selector but got:", mutatedPod.Spec.NodeSelector)
+	}
+	for i, term := range mutatedPod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+		if len(missingNodeSelectorRequirements(term, tenantNodePlacementProfile.NodeAffinity)) != 0 {
+			t.Errorf("expected node affinity in term %d but got: %v", i, term)
+		}
+	}
+	if len(mutatedPod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0].MatchExpressions) != 2 {
+		t.Error("expected existing requirements to be kept")
+	}
+	validationErrors = validatePodNodePlacement(mutatedPod, &tenantNodePlacementProfile, nil)
+	if len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+}
+
+/* Validating Webhook
+ * Rejects tolerations which are not allowed by the node placement profile.
+ */
+func TestPodNodePlacementTolerations(t *testing.T) {
+	var seconds int64 = 300
+	profile := v1alpha1.NodePlacementProfile{Name: "tenant-a", Tolerations: tenantNodePlacementProfile.Tolerations}
+
+	tests := []struct {
+		toleration corev1.Toleration
+		errors     int
+	}{
+		{corev1.Toleration{Key: "dedicated", Value: "tenant-a", Effect: corev1.TaintEffectNoSchedule}, 0},
+		{corev1.Toleration{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "tenant-b", Effect: corev1.TaintEffectNoSchedule}, 1},
+		{corev1.Toleration{Key: "dedicated", Operator: corev1.TolerationOpExists}, 1},
+		{corev1.Toleration{Key: "gpu", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoExecute}, 0},
+		{corev1.Toleration{Operator: corev1.TolerationOpExists}, 1},
+		{corev1.Toleration{Key: "node.kubernetes.io/not-ready", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoExecute, TolerationSeconds: &seconds}, 0},
+	}
+	for _, tt := range tests {
+		pod := corev1.Pod{}
+		pod.Spec.Tolerations = []corev1.Toleration{tt.toleration}
+		validationErrors := validatePodNodePlacement(pod, &profile, nil)
+		if len(validationErrors) != tt.errors {
+			t.Errorf("toleration '%s': expected %d validationErrors but got: %v", formatToleration(tt.toleration), tt.errors, validationErrors)
+		}
+	}
+}
+
+func TestPodNodePlacementUpdate(t *testing.T) {
+	namespace := &corev1.Namespace{}
+	namespace.Name = "tenant-a"
+	namespace.Annotations = map[string]string{"karydia.gardener.cloud/nodePlacement": "undefined"}
+
+	karydiaAdmission, err := New(&Config{KubeClientset: k8sfake.NewSimpleClientset(namespace)})
+	if err != nil {
+		t.Fatal("Failed to load karydia admission:", err)
+	}
+
+	// the node placement of a scheduled pod cannot be changed, so existing
+	// pods are not changed or rejected
+	pod := &corev1.Pod{}
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "nginx"}}
+
+	if response := karydiaAdmission.mutatePod(pod, seccompProfiles{}, namespace, v1beta1.Update); len(response.Patch) != 0 && string(response.Patch) != "null" {
+		t.Error("expected 0 patches but got:", string(response.Patch))
+	}
+	if response := karydiaAdmission.validatePod(pod, nil, seccompProfiles{}, namespace, v1beta1.Update); !response.Allowed {
+		t.Error("expected update to be allowed but got:", response.Result)
+	}
+	if response := karydiaAdmission.validatePod(pod, nil, seccompProfiles{}, namespace, v1beta1.Create); response.Allowed {
+		t.Error("expected create to be rejected")
+	}
+}
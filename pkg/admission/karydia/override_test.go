@@ -0,0 +1,199 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package karydia
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/karydia/karydia/pkg/apis/karydia/v1alpha1"
+	"k8s.io/api/admission/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+/* Validating Webhook
+ * Weakening karydia annotations are only accepted from users which are
+ * allowed to 'override' karydia 'settings'.
+ * kubectl annotate ns default karydia.gardener.cloud/seccompProfile=unconfined
+ */
+func newOverrideTestAdmission(t *testing.T, kubeobjects ...runtime.Object) *KarydiaAdmission {
+	kubeclient := k8sfake.NewSimpleClientset(kubeobjects...)
+
+	karydiaAdmission, err := New(&Config{
+		KubeClientset: kubeclient,
+		KarydiaConfig: &v1alpha1.KarydiaConfig{
+			Spec: v1alpha1.KarydiaConfigSpec{
+				AutomountServiceAccountToken: "change-all",
+				SeccompProfile:               "runtime/default",
+				PodSecurityContext:           "nobody",
+			},
+		},
+		Authorizer: authorizer.AuthorizerFunc(func(a authorizer.Attributes) (authorizer.Decision, string, error) {
+			if a.GetUser().GetName() == "admin" && a.GetVerb() == "override" && a.GetAPIGroup() == "karydia.gardener.cloud" && a.GetResource() == "settings" {
+				return authorizer.DecisionAllow, "", nil
+			}
+			return authorizer.DecisionNoOpinion, "", nil
+		}),
+	})
+	if err != nil {
+		t.Fatal("Failed to load karydia admission:", err)
+	}
+	return karydiaAdmission
+}
+
+func namespaceAdmissionReview(user string, namespace *corev1.Namespace, oldNamespace *corev1.Namespace) v1beta1.AdmissionReview {
+	rawNamespace, _ := json.Marshal(namespace)
+	ar := v1beta1.AdmissionReview{
+		Request: &v1beta1.AdmissionRequest{
+			Operation: "CREATE",
+			Namespace: namespace.Name,
+			Kind:      metav1.GroupVersionKind{Group: "", Version: "v1", Kind: "Namespace"},
+			Object: runtime.RawExtension{
+				Raw: rawNamespace,
+			},
+			UserInfo: authenticationv1.UserInfo{Username: user},
+		},
+	}
+	if oldNamespace != nil {
+		rawOldNamespace, _ := json.Marshal(oldNamespace)
+		ar.Request.Operation = "UPDATE"
+		ar.Request.OldObject = runtime.RawExtension{Raw: rawOldNamespace}
+	}
+	return ar
+}
+
+func TestOverrideNamespaceWeakeningAnnotation(t *testing.T) {
+	karydiaAdmission := newOverrideTestAdmission(t)
+
+	namespace := &corev1.Namespace{}
+	namespace.Name = "special"
+	namespace.Annotations = map[string]string{
+		"karydia.gardener.cloud/seccompProfile": "unconfined",
+	}
+
+	validationResponse := karydiaAdmission.Admit(namespaceAdmissionReview("developer", namespace, nil), false)
+	if validationResponse.Allowed {
+		t.Error("expected validation response to be false but is", validationResponse.Allowed)
+	}
+
+	validationResponse = karydiaAdmission.Admit(namespaceAdmissionReview("admin", namespace, nil), false)
+	if !validationResponse.Allowed {
+		t.Error("expected validation response to be true but is", validationResponse.Allowed)
+	}
+
+	mutationResponse := karydiaAdmission.Admit(namespaceAdmissionReview("developer", namespace, nil), true)
+	if !mutationResponse.Allowed {
+		t.Error("expected mutation response to be true but is", mutationResponse.Allowed)
+	}
+}
+
+func TestOverrideNamespaceNonWeakeningAnnotation(t *testing.T) {
+	karydiaAdmission := newOverrideTestAdmission(t)
+
+	namespace := &corev1.Namespace{}
+	namespace.Name = "special"
+	namespace.Annotations = map[string]string{
+		"karydia.gardener.cloud/seccompProfile":               "localhost/my-profile",
+		"karydia.gardener.cloud/automountServiceAccountToken": "change-all",
+		"karydia.gardener.cloud/podSecurityContext":           "nobody",
+	}
+
+	validationResponse := karydiaAdmission.Admit(namespaceAdmissionReview("developer", namespace, nil), false)
+	if !validationResponse.Allowed {
+		t.Error("expected validation response to be true but is", validationResponse.Allowed)
+	}
+}
+
+func TestOverrideNamespaceUnchangedAnnotation(t *testing.T) {
+	karydiaAdmission := newOverrideTestAdmission(t)
+
+	oldNamespace := &corev1.Namespace{}
+	oldNamespace.Name = "special"
+	oldNamespace.Annotations = map[string]string{
+		"karydia.gardener.cloud/automountServiceAccountToken": "change-default",
+	}
+	namespace := oldNamespace.DeepCopy()
+	namespace.Labels = map[string]string{"team": "a"}
+
+	validationResponse := karydiaAdmission.Admit(namespaceAdmissionReview("developer", namespace, oldNamespace), false)
+	if !validationResponse.Allowed {
+		t.Error("expected validation response to be true but is", validationResponse.Allowed)
+	}
+
+	namespace.Annotations["karydia.gardener.cloud/automountServiceAccountToken"] = "no-change"
+	validationResponse = karydiaAdmission.Admit(namespaceAdmissionReview("developer", namespace, oldNamespace), false)
+	if validationResponse.Allowed {
+		t.Error("expected validation response to be false but is", validationResponse.Allowed)
+	}
+}
+
+func TestOverridePodWeakeningAnnotation(t *testing.T) {
+	namespace := &corev1.Namespace{}
+	namespace.Name = "special"
+	karydiaAdmission := newOverrideTestAdmission(t, namespace)
+	automount := false
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "karydia-e2e-test-pod",
+			Namespace: "special",
+			Annotations: map[string]string{
+				"karydia.gardener.cloud/podSecurityContext":      "none",
+				"seccomp.security.alpha.kubernetes.io/pod":       "runtime/default",
+				"karydia.gardener.cloud/seccompProfile.internal": "config/runtime/default",
+			},
+		},
+		Spec: corev1.PodSpec{
+			AutomountServiceAccountToken: &automount,
+			Containers: []corev1.Container{
+				{
+					Name:  "nginx",
+					Image: "nginx",
+				},
+			},
+		},
+	}
+	rawPod, _ := json.Marshal(pod)
+
+	ar := v1beta1.AdmissionReview{
+		Request: &v1beta1.AdmissionRequest{
+			Operation: "CREATE",
+			Namespace: "special",
+			Kind:      metav1.GroupVersionKind{Group: "", Version: "v1", Kind: "Pod"},
+			Object: runtime.RawExtension{
+				Raw: rawPod,
+			},
+			UserInfo: authenticationv1.UserInfo{Username: "developer"},
+		},
+	}
+
+	validationResponse := karydiaAdmission.Admit(ar, false)
+	if validationResponse.Allowed {
+		t.Error("expected validation response to be false but is", validationResponse.Allowed)
+	}
+
+	ar.Request.UserInfo.Username = "admin"
+	validationResponse = karydiaAdmission.Admit(ar, false)
+	if !validationResponse.Allowed {
+		t.Error("expected validation response to be true but is", validationResponse.Allowed, validationResponse.Result)
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package karydia
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/karydia/karydia/pkg/apis/karydia/v1alpha1"
+
+	"k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func newPodSecurityContextProfile() v1alpha1.PodSecurityContextProfile {
+	var uid int64 = 1000
+	var gid int64 = 1001
+	var fsGroup int64 = 2000
+	nonRoot := true
+	return v1alpha1.PodSecurityContextProfile{
+		Name:               "app",
+		RunAsUser:          &uid,
+		RunAsGroup:         &gid,
+		RunAsNonRoot:       &nonRoot,
+		FSGroup:            &fsGroup,
+		SupplementalGroups: []int64{3000},
+		Sysctls:            []corev1.Sysctl{{Name: "net.ipv4.ip_local_port_range", Value: "32768 60999"}},
+	}
+}
+
+func TestGetPodSecurityContextProfile(t *testing.T) {
+	karydiaAdmission := &KarydiaAdmission{
+		karydiaConfig: &v1alpha1.KarydiaConfig{
+			Spec: v1alpha1.KarydiaConfigSpec{
+				PodSecurityContextProfiles: []v1alpha1.PodSecurityContextProfile{newPodSecurityContextProfile()},
+			},
+		},
+	}
+
+	if profile := karydiaAdmission.getPodSecurityContextProfile("app"); profile == nil || *profile.RunAsUser != 1000 {
+		t.Error("expected profile 'app' but got:", profile)
+	}
+	if profile := karydiaAdmission.getPodSecurityContextProfile("nobody"); profile == nil || *profile.RunAsUser != 65534 {
+		t.Error("expected built-in profile 'nobody' but got:", profile)
+	}
+	if profile := karydiaAdmission.getPodSecurityContextProfile("unknown"); profile != nil {
+		t.Error("expected no profile but got:", profile)
+	}
+}
+
+/* Mutating and Validating Webhook
+ * Applies a named pod security context profile of the karydia config.
+ * kubectl annotate ns default karydia.gardener.cloud/podSecurityContext=app
+ */
+func TestPodSecurityContextProfilePlain(t *testing.T) {
+	var patches Patches
+	var validationErrors []string
+
+	profile := newPodSecurityContextProfile()
+	pod := corev1.Pod{}
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "nginx"}}
+
+	setting := Setting{value: "app", src: "namespace"}
+
+	validationErrors = validatePodSecurityContext(pod, nil, &profile, validationErrors)
+	if len(validationErrors) != 2 {
+		t.Error("expected 2 validationErrors but got:", validationErrors)
+	}
+
+	patches = mutatePodSecurityContext(pod, setting, &profile, patches)
+	mutatedPod, err := patchPod(pod, patches)
+	if err != nil {
+		t.Fatal("failed to apply patches:", err)
+	}
+	secCtx := mutatedPod.Spec.SecurityContext
+	if secCtx == nil || *secCtx.RunAsUser != 1000 || *secCtx.RunAsGroup != 1001 || !*secCtx.RunAsNonRoot || *secCtx.FSGroup != 2000 || len(secCtx.SupplementalGroups) != 1 || len(secCtx.Sysctls) != 1 {
+		t.Error("expected pod security context of profile 'app' but got:", secCtx)
+	}
+	if mutatedPod.ObjectMeta.Annotations["karydia.gardener.cloud/podSecurityContext.internal"] != "namespace/app" {
+		t.Error("expected internal annotation but got:", mutatedPod.ObjectMeta.Annotations)
+	}
+
+	validationErrors = validatePodSecurityContext(mutatedPod, nil, &profile, nil)
+	if len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+}
+
+func TestPodSecurityContextProfileDefined(t *testing.T) {
+	var patches Patches
+
+	var uid int64 = 5000
+	var fsGroup int64 = 6000
+	privilegeEscalation := false
+	profile := newPodSecurityContextProfile()
+	pod := corev1.Pod{}
+	pod.Spec.SecurityContext = &corev1.PodSecurityContext{RunAsUser: &uid, FSGroup: &fsGroup}
+	pod.Spec.Containers = []corev1.Container{
+		{
+			Name:            "nginx",
+			Image:           "nginx",
+			SecurityContext: &corev1.SecurityContext{AllowPrivilegeEscalation: &privilegeEscalation},
+		},
+	}
+
+	patches = mutatePodSecurityContext(pod, Setting{value: "app", src: "config"}, &profile, patches)
+	if len(patches.operations) != 4 {
+		t.Error("expected 4 patches but got:", patches.operations)
+	}
+	mutatedPod, err := patchPod(pod, patches)
+	if err != nil {
+		t.Fatal("failed to apply patches:", err)
+	}
+	secCtx := mutatedPod.Spec.SecurityContext
+	if *secCtx.RunAsUser != 5000 || secCtx.RunAsGroup != nil || *secCtx.FSGroup != 6000 || secCtx.RunAsNonRoot == nil {
+		t.Error("expected defined fields to be kept but got:", secCtx)
+	}
+}
+
+func TestPodSecurityContextProfileUnknown(t *testing.T) {
+	namespace := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "special",
+			Annotations: map[string]string{"karydia.gardener.cloud/podSecurityContext": "unknown"},
+		},
+	}
+	karydiaAdmission, err := New(&Config{})
+	if err != nil {
+		t.Fatal("Failed to load karydia admission:", err)
+	}
+
+	pod := &corev1.Pod{}
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "nginx"}}
+
+	mutationResponse := karydiaAdmission.mutatePod(pod, seccompProfiles{}, namespace, v1beta1.Create)
+	if !mutationResponse.Allowed {
+		t.Error("expected mutation response to be true but is", mutationResponse.Allowed)
+	}
+	var patches []patchOperation
+	if err := json.Unmarshal(mutationResponse.Patch, &patches); err != nil || len(patches) != 0 {
+		t.Error("expected no patches but got:", string(mutationResponse.Patch))
+	}
+	validationResponse := karydiaAdmission.validatePod(pod, nil, seccompProfiles{}, namespace, v1beta1.Create)
+	if validationResponse.Allowed {
+		t.Error("expected validation response to be false but is", validationResponse.Allowed)
+	}
+}
+
+func TestPodSecurityContextWeakens(t *testing.T) {
+	var root int64
+	rootNonRoot := false
+	app := newPodSecurityContextProfile()
+	spec := v1alpha1.KarydiaConfigSpec{
+		PodSecurityContext: "app",
+		PodSecurityContextProfiles: []v1alpha1.PodSecurityContextProfile{
+			app,
+			{Name: "root", RunAsUser: &root, RunAsGroup: app.RunAsGroup, RunAsNonRoot: app.RunAsNonRoot},
+			{Name: "root-allowed", RunAsUser: app.RunAsUser, RunAsGroup: app.RunAsGroup, RunAsNonRoot: &rootNonRoot},
+			{Name: "sysctls", RunAsUser: app.RunAsUser, RunAsGroup: app.RunAsGroup, RunAsNonRoot: app.RunAsNonRoot, Sysctls: []corev1.Sysctl{{Name: "kernel.msgmax", Value: "65536"}}},
+			{Name: "other-user", RunAsUser: app.FSGroup, RunAsGroup: app.FSGroup, RunAsNonRoot: app.RunAsNonRoot},
+		},
+	}
+
+	tests := []struct {
+		value   string
+		weakens bool
+	}{
+		{"app", false},
+		{"other-user", false},
+		{"undefined", false},
+		{"root", true},
+		{"root-allowed", true},
+		{"sysctls", true},
+		{"nobody", true},
+		{"none", true},
+	}
+	for _, tt := range tests {
+		if podSecurityContextWeakens(tt.value, spec) != tt.weakens {
+			t.Errorf("value '%s': expected weakens to be %v", tt.value, tt.weakens)
+		}
+	}
+	if podSecurityContextWeakens("none", v1alpha1.KarydiaConfigSpec{PodSecurityContext: "none"}) {
+		t.Error("expected 'none' not to weaken disabled config")
+	}
+}
+
+func TestPodSecurityContextProfileUpdate(t *testing.T) {
+	namespace := &corev1.Namespace{}
+	namespace.Name = "special"
+	namespace.Annotations = map[string]string{"karydia.gardener.cloud/podSecurityContext": "nobody"}
+
+	karydiaAdmission, err := New(&Config{KubeClientset: k8sfake.NewSimpleClientset(namespace)})
+	if err != nil {
+		t.Fatal("Failed to load karydia admission:", err)
+	}
+
+	// the security context of a pod is immutable, so pods created before
+	// the setting applied are not changed or rejected
+	pod := &corev1.Pod{}
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "nginx"}}
+
+	if response := karydiaAdmission.mutatePod(pod, seccompProfiles{}, namespace, v1beta1.Update); len(response.Patch) != 0 && string(response.Patch) != "null" {
+		t.Error("expected 0 patches but got:", string(response.Patch))
+	}
+	if response := karydiaAdmission.validatePod(pod, nil, seccompProfiles{}, namespace, v1beta1.Update); !response.Allowed {
+		t.Error("expected update to be allowed but got:", response.Result)
+	}
+	if response := karydiaAdmission.validatePod(pod, nil, seccompProfiles{}, namespace, v1beta1.Create); response.Allowed {
+		t.Error("expected create to be rejected")
+	}
+}
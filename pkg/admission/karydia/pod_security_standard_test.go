@@ -0,0 +1,212 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package karydia
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func violatedControls(validationErrors []string) map[string]bool {
+	controls := make(map[string]bool)
+	for _, validationError := range validationErrors {
+		if i := strings.Index(validationError, "control '"); i >= 0 {
+			control := validationError[i+len("control '"):]
+			controls[control[:strings.Index(control, "'")]] = true
+		}
+	}
+	return controls
+}
+
+func TestPodSecurityStandardBaseline(t *testing.T) {
+	privileged := true
+	procMount := corev1.UnmaskedProcMount
+	pod := corev1.Pod{}
+	pod.ObjectMeta.Annotations = map[string]string{
+		"seccomp.security.alpha.kubernetes.io/pod":             "unconfined",
+		"container.apparmor.security.beta.kubernetes.io/nginx": "unconfined",
+	}
+	pod.Spec.HostNetwork = true
+	pod.Spec.SecurityContext = &corev1.PodSecurityContext{
+		Sysctls:        []corev1.Sysctl{{Name: "kernel.msgmax", Value: "65536"}},
+		SELinuxOptions: &corev1.SELinuxOptions{Type: "spc_t"},
+	}
+	pod.Spec.Volumes = []corev1.Volume{{Name: "host", VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/etc"}}}}
+	pod.Spec.Containers = []corev1.Container{
+		{
+			Name:  "nginx",
+			Image: "nginx",
+			Ports: []corev1.ContainerPort{{ContainerPort: 80, HostPort: 80}},
+			SecurityContext: &corev1.SecurityContext{
+				Privileged:   &privileged,
+				ProcMount:    &procMount,
+				Capabilities: &corev1.Capabilities{Add: []corev1.Capability{"NET_RAW", "SYS_ADMIN"}},
+			},
+		},
+	}
+
+	validationErrors := validatePodSecurityStandard(pod, nil, seccompProfiles{}, Setting{value: "baseline", src: "namespace"}, nil)
+	controls := violatedControls(validationErrors)
+	for _, control := range []string{"Host Namespaces", "HostPath Volumes", "Seccomp", "SELinux", "Sysctls", "Privileged Containers", "Capabilities", "Host Ports", "AppArmor", "/proc Mount Type"} {
+		if !controls[control] {
+			t.Errorf("expected control '%s' to be violated but got: %v", control, validationErrors)
+		}
+	}
+	if len(validationErrors) != 11 {
+		t.Error("expected 11 validationErrors but got:", validationErrors)
+	}
+	if controls["Privilege Escalation"] || controls["Volume Types"] {
+		t.Error("expected restricted controls not to be checked but got:", validationErrors)
+	}
+
+	validationErrors = validatePodSecurityStandard(pod, nil, seccompProfiles{}, Setting{value: "none", src: "namespace"}, nil)
+	if len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+}
+
+func TestPodSecurityStandardRestricted(t *testing.T) {
+	var root int64
+	pod := corev1.Pod{}
+	pod.Spec.SecurityContext = &corev1.PodSecurityContext{RunAsUser: &root}
+	pod.Spec.Volumes = []corev1.Volume{
+		{Name: "data", VolumeSource: corev1.VolumeSource{NFS: &corev1.NFSVolumeSource{Server: "nfs", Path: "/data"}}},
+		{Name: "config", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{}}},
+	}
+	pod.Spec.Containers = []corev1.Container{
+		{
+			Name:  "nginx",
+			Image: "nginx",
+			SecurityContext: &corev1.SecurityContext{
+				Capabilities: &corev1.Capabilities{Add: []corev1.Capability{"CHOWN"}},
+			},
+		},
+	}
+
+	validationErrors := validatePodSecurityStandard(pod, nil, seccompProfiles{}, Setting{value: "restricted", src: "config"}, nil)
+	controls := violatedControls(validationErrors)
+	for _, control := range []string{"Privilege Escalation", "Running as Non-root", "Running as Non-root user", "Seccomp", "Capabilities", "Volume Types"} {
+		if !controls[control] {
+			t.Errorf("expected control '%s' to be violated but got: %v", control, validationErrors)
+		}
+	}
+	if len(validationErrors) != 7 {
+		t.Error("expected 7 validationErrors but got:", validationErrors)
+	}
+}
+
+/* Mutating and Validating Webhook
+ * Applies the defaults of the restricted pod security standard.
+ * kubectl annotate ns default karydia.gardener.cloud/podSecurityStandard=restricted
+ */
+func TestPodSecurityStandardRestrictedDefaults(t *testing.T) {
+	namespace := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "special",
+			Annotations: map[string]string{
+				"karydia.gardener.cloud/podSecurityStandard": "restricted",
+				"karydia.gardener.cloud/podSecurityContext":  "nobody",
+				"karydia.gardener.cloud/seccompProfile":      "unconfined",
+			},
+		},
+	}
+	karydiaAdmission, err := New(&Config{})
+	if err != nil {
+		t.Fatal("Failed to load karydia admission:", err)
+	}
+
+	pod := &corev1.Pod{}
+	pod.Spec.InitContainers = []corev1.Container{{Name: "init", Image: "busybox"}}
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "nginx"}}
+
+	validationResponse := karydiaAdmission.validatePod(pod, nil, seccompProfiles{}, namespace, v1beta1.Create)
+	if validationResponse.Allowed {
+		t.Error("expected validation response to be false but is", validationResponse.Allowed)
+	}
+
+	mutationResponse := karydiaAdmission.mutatePod(pod, seccompProfiles{}, namespace, v1beta1.Create)
+	if !mutationResponse.Allowed {
+		t.Error("expected mutation response to be true but is", mutationResponse.Allowed)
+	}
+	mutatedPod, err := patchPodRaw(*pod, mutationResponse.Patch)
+	if err != nil {
+		t.Fatal("failed to apply patches:", err)
+	}
+	if mutatedPod.ObjectMeta.Annotations["seccomp.security.alpha.kubernetes.io/pod"] != "runtime/default" {
+		t.Error("expected seccomp profile 'runtime/default' but got:", mutatedPod.ObjectMeta.Annotations)
+	}
+	if mutatedPod.ObjectMeta.Annotations["karydia.gardener.cloud/podSecurityStandard.internal"] != "namespace/restricted" {
+		t.Error("expected internal annotation but got:", mutatedPod.ObjectMeta.Annotations)
+	}
+
+	validationResponse = karydiaAdmission.validatePod(&mutatedPod, nil, seccompProfiles{}, namespace, v1beta1.Create)
+	if !validationResponse.Allowed {
+		t.Error("expected validation response to be true but is", validationResponse.Allowed, validationResponse.Result)
+	}
+}
+
+func TestPodSecurityStandardDuplicateDefaults(t *testing.T) {
+	var patches Patches
+
+	pod := corev1.Pod{}
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "nginx"}}
+
+	patches = mutatePodSecurityContext(pod, Setting{value: "nobody", src: "config"}, &nobodyProfile, patches)
+	patches = mutatePodCapabilities(pod, Setting{value: "drop-all", src: "config"}, patches)
+	patches = mutatePodSecurityStandard(pod, Setting{value: "restricted", src: "config"}, patches)
+
+	// pod security context, container security context, runAsNonRoot,
+	// capabilities and three annotations
+	if len(patches.operations) != 7 {
+		t.Error("expected 7 patches but got:", patches.operations)
+	}
+	if _, err := patchPod(pod, patches); err != nil {
+		t.Error("failed to apply patches:", err)
+	}
+}
+
+func TestPodSecurityStandardUpdate(t *testing.T) {
+	namespace := &corev1.Namespace{}
+	namespace.Name = "special"
+	namespace.Annotations = map[string]string{"karydia.gardener.cloud/podSecurityStandard": "restricted"}
+
+	karydiaAdmission, err := New(&Config{KubeClientset: k8sfake.NewSimpleClientset(namespace)})
+	if err != nil {
+		t.Fatal("Failed to load karydia admission:", err)
+	}
+
+	// the fields checked by the pod security standards are immutable, so
+	// pods created before the setting applied are not changed or rejected
+	pod := &corev1.Pod{}
+	pod.Spec.HostNetwork = true
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "nginx"}}
+
+	if response := karydiaAdmission.mutatePod(pod, seccompProfiles{}, namespace, v1beta1.Update); len(response.Patch) != 0 && string(response.Patch) != "null" {
+		t.Error("expected 0 patches but got:", string(response.Patch))
+	}
+	if response := karydiaAdmission.validatePod(pod, nil, seccompProfiles{}, namespace, v1beta1.Update); !response.Allowed {
+		t.Error("expected update to be allowed but got:", response.Result)
+	}
+	if response := karydiaAdmission.validatePod(pod, nil, seccompProfiles{}, namespace, v1beta1.Create); response.Allowed {
+		t.Error("expected create to be rejected")
+	}
+}
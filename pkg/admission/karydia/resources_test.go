@@ -0,0 +1,205 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package karydia
+
+import (
+	"testing"
+
+	"github.com/karydia/karydia/pkg/apis/karydia/v1alpha1"
+
+	"k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+var smallResourceProfile = v1alpha1.ResourceProfile{
+	Name: "small",
+	Requests: corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse("100m"),
+		corev1.ResourceMemory: resource.MustParse("128Mi"),
+	},
+	Limits: corev1.ResourceList{
+		corev1.ResourceCPU:              resource.MustParse("500m"),
+		corev1.ResourceMemory:           resource.MustParse("256Mi"),
+		corev1.ResourceEphemeralStorage: resource.MustParse("1Gi"),
+	},
+}
+
+/* Mutating and Validating Webhook
+ * Applies the requests and limits of the profile to containers without them.
+ * kubectl annotate ns default karydia.gardener.cloud/resources=small
+ */
+func TestPodResourcesProfile(t *testing.T) {
+	pod := corev1.Pod{}
+	pod.Spec.InitContainers = []corev1.Container{{Name: "init", Image: "busybox"}}
+	pod.Spec.Containers = []corev1.Container{
+		{Name: "nginx", Image: "nginx"},
+		{
+			Name:  "sidecar",
+			Image: "busybox",
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("512Mi")},
+				Limits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("50m")},
+			},
+		},
+	}
+
+	setting := Setting{value: "small", src: "namespace"}
+
+	validationErrors := validatePodResources(pod, &smallResourceProfile, nil)
+	if len(validationErrors) != 8 {
+		t.Error("expected 8 validationErrors but got:", validationErrors)
+	}
+
+	patches := mutatePodResources(pod, setting, &smallResourceProfile, Patches{})
+	mutatedPod, err := patchPod(pod, patches)
+	if err != nil {
+		t.Fatal("failed to apply patches:", err)
+	}
+	for _, container := range append(mutatedPod.Spec.InitContainers, mutatedPod.Spec.Containers[0]) {
+		if len(container.Resources.Requests) != 2 || len(container.Resources.Limits) != 3 {
+			t.Errorf("expected resources of the profile for container '%s' but got: %v", container.Name, container.Resources)
+		}
+	}
+
+	sidecar := mutatedPod.Spec.Containers[1].Resources
+	// the limit is used as request for cpu, the explicit memory request is kept
+	if _, ok := sidecar.Requests[corev1.ResourceCPU]; ok {
+		t.Error("expected no cpu request but got:", sidecar.Requests)
+	}
+	if request := sidecar.Requests[corev1.ResourceMemory]; request.String() != "512Mi" {
+		t.Error("expected memory request '512Mi' but got:", request.String())
+	}
+	if limit := sidecar.Limits[corev1.ResourceCPU]; limit.String() != "50m" {
+		t.Error("expected cpu limit '50m' but got:", limit.String())
+	}
+	// the limit must not be lower than the request
+	if limit := sidecar.Limits[corev1.ResourceMemory]; limit.String() != "512Mi" {
+		t.Error("expected memory limit '512Mi' but got:", limit.String())
+	}
+	if limit := sidecar.Limits[corev1.ResourceEphemeralStorage]; limit.String() != "1Gi" {
+		t.Error("expected ephemeral-storage limit '1Gi' but got:", limit.String())
+	}
+	if mutatedPod.Annotations["karydia.gardener.cloud/resources.internal"] != "namespace/small" {
+		t.Error("expected internal annotation but got:", mutatedPod.Annotations)
+	}
+
+	validationErrors = validatePodResources(mutatedPod, &smallResourceProfile, nil)
+	if len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+
+	if patches := mutatePodResources(mutatedPod, setting, &smallResourceProfile, Patches{}); len(patches.operations) != 0 {
+		t.Error("expected 0 patches but got:", patches.operations)
+	}
+}
+
+/* Validating Webhook
+ * Rejects containers without cpu and memory limits.
+ * kubectl annotate ns default karydia.gardener.cloud/resources=validate
+ */
+func TestPodResourcesValidate(t *testing.T) {
+	pod := corev1.Pod{}
+	pod.Spec.Containers = []corev1.Container{
+		{
+			Name:  "nginx",
+			Image: "nginx",
+			Resources: corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+			},
+		},
+	}
+
+	validationErrors := validatePodResources(pod, nil, nil)
+	if len(validationErrors) != 1 {
+		t.Error("expected 1 validationError but got:", validationErrors)
+	}
+
+	pod.Spec.Containers[0].Resources.Limits[corev1.ResourceMemory] = resource.MustParse("1Gi")
+	validationErrors = validatePodResources(pod, nil, nil)
+	if len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+}
+
+func TestPodResourcesUpdate(t *testing.T) {
+	namespace := &corev1.Namespace{}
+	namespace.Name = "special"
+	namespace.Annotations = map[string]string{"karydia.gardener.cloud/resources": "validate"}
+
+	karydiaAdmission, err := New(&Config{KubeClientset: k8sfake.NewSimpleClientset(namespace)})
+	if err != nil {
+		t.Fatal("Failed to load karydia admission:", err)
+	}
+
+	// resources of containers are immutable, so existing pods are not
+	// rejected
+	pod := &corev1.Pod{}
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "nginx"}}
+
+	if response := karydiaAdmission.validatePod(pod, nil, seccompProfiles{}, namespace, v1beta1.Update); !response.Allowed {
+		t.Error("expected update to be allowed but got:", response.Result)
+	}
+	if response := karydiaAdmission.validatePod(pod, nil, seccompProfiles{}, namespace, v1beta1.Create); response.Allowed {
+		t.Error("expected create to be rejected")
+	}
+}
+
+func TestResourcesWeakens(t *testing.T) {
+	large := v1alpha1.ResourceProfile{
+		Name: "large",
+		Limits: corev1.ResourceList{
+			corev1.ResourceCPU:              resource.MustParse("4"),
+			corev1.ResourceMemory:           resource.MustParse("8Gi"),
+			corev1.ResourceEphemeralStorage: resource.MustParse("10Gi"),
+		},
+	}
+	tiny := v1alpha1.ResourceProfile{
+		Name: "tiny",
+		Limits: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("100m"),
+			corev1.ResourceMemory: resource.MustParse("64Mi"),
+		},
+	}
+	spec := v1alpha1.KarydiaConfigSpec{Resources: "small", ResourceProfiles: []v1alpha1.ResourceProfile{smallResourceProfile, large, tiny}}
+
+	tests := []struct {
+		value   string
+		weakens bool
+	}{
+		{"small", false},
+		{"large", true},
+		{"tiny", true},
+		{"validate", true},
+		{"undefined", true},
+		{"none", true},
+	}
+	for _, tt := range tests {
+		if resourcesWeakens(tt.value, spec) != tt.weakens {
+			t.Errorf("value '%s': expected weakens to be %v", tt.value, tt.weakens)
+		}
+	}
+
+	spec.Resources = "validate"
+	if resourcesWeakens("tiny", spec) {
+		t.Error("expected 'tiny' not to weaken 'validate'")
+	}
+	if resourcesWeakens("none", v1alpha1.KarydiaConfigSpec{Resources: "none"}) {
+		t.Error("expected 'none' not to weaken disabled config")
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package karydia
+
+import (
+	"testing"
+
+	"github.com/karydia/karydia/pkg/apis/karydia/v1alpha1"
+
+	"k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+/* Mutating and Validating Webhook
+ * Sets the required runtime class of pods and rejects other runtime classes.
+ * kubectl annotate ns tenant karydia.gardener.cloud/runtimeClass=gvisor
+ */
+func TestPodRuntimeClass(t *testing.T) {
+	pod := corev1.Pod{}
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "nginx"}}
+
+	setting := Setting{value: "gvisor", src: "namespace"}
+
+	validationErrors := validatePodRuntimeClass(pod, setting, nil)
+	if len(validationErrors) != 1 {
+		t.Error("expected 1 validationError but got:", validationErrors)
+	}
+
+	patches := mutatePodRuntimeClass(pod, setting, Patches{})
+	if len(patches.operations) != 2 {
+		t.Error("expected 2 patches but got:", patches.operations)
+	}
+	mutatedPod, err := patchPod(pod, patches)
+	if err != nil {
+		t.Error("failed to apply patches:", err)
+	}
+	if mutatedPod.Spec.RuntimeClassName == nil || *mutatedPod.Spec.RuntimeClassName != "gvisor" {
+		t.Error("expected runtime class 'gvisor' but got:", mutatedPod.Spec.RuntimeClassName)
+	}
+	if mutatedPod.Annotations["karydia.gardener.cloud/runtimeClass.internal"] != "namespace/gvisor" {
+		t.Error("expected internal annotation but got:", mutatedPod.Annotations)
+	}
+	validationErrors = validatePodRuntimeClass(mutatedPod, setting, nil)
+	if len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+
+	// a different runtime class is not changed but rejected
+	runc := "runc"
+	pod.Spec.RuntimeClassName = &runc
+	if patches := mutatePodRuntimeClass(pod, setting, Patches{}); len(patches.operations) != 0 {
+		t.Error("expected 0 patches but got:", patches.operations)
+	}
+	validationErrors = validatePodRuntimeClass(pod, setting, nil)
+	if len(validationErrors) != 1 {
+		t.Error("expected 1 validationError but got:", validationErrors)
+	}
+
+	setting = Setting{value: "none", src: "namespace"}
+	if validationErrors := validatePodRuntimeClass(pod, setting, nil); len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+}
+
+func TestRuntimeClassSettingIgnoresPodAnnotation(t *testing.T) {
+	karydiaAdmission := &KarydiaAdmission{
+		karydiaConfig: &v1alpha1.KarydiaConfig{
+			Spec: v1alpha1.KarydiaConfigSpec{RuntimeClass: "tenant-*=gvisor"},
+		},
+	}
+	ns := &corev1.Namespace{}
+	ns.Name = "tenant-a"
+
+	setting := karydiaAdmission.getRuntimeClassSetting(ns)
+	if setting.value != "gvisor" || setting.src != "config" {
+		t.Error("expected runtime class 'gvisor' from config but got:", setting)
+	}
+
+	ns.Annotations = map[string]string{"karydia.gardener.cloud/runtimeClass": "kata"}
+	setting = karydiaAdmission.getRuntimeClassSetting(ns)
+	if setting.value != "kata" || setting.src != "namespace" {
+		t.Error("expected runtime class 'kata' from namespace but got:", setting)
+	}
+}
+
+func TestPodRuntimeClassUpdate(t *testing.T) {
+	namespace := &corev1.Namespace{}
+	namespace.Name = "special"
+	namespace.Annotations = map[string]string{"karydia.gardener.cloud/runtimeClass": "gvisor"}
+
+	karydiaAdmission, err := New(&Config{KubeClientset: k8sfake.NewSimpleClientset(namespace)})
+	if err != nil {
+		t.Fatal("Failed to load karydia admission:", err)
+	}
+
+	// the runtime class of a pod is immutable, so existing pods are not
+	// changed or rejected
+	pod := &corev1.Pod{}
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "nginx"}}
+
+	if response := karydiaAdmission.mutatePod(pod, seccompProfiles{}, namespace, v1beta1.Update); len(response.Patch) != 0 && string(response.Patch) != "null" {
+		t.Error("expected 0 patches but got:", string(response.Patch))
+	}
+	if response := karydiaAdmission.validatePod(pod, nil, seccompProfiles{}, namespace, v1beta1.Update); !response.Allowed {
+		t.Error("expected update to be allowed but got:", response.Result)
+	}
+	if response := karydiaAdmission.validatePod(pod, nil, seccompProfiles{}, namespace, v1beta1.Create); response.Allowed {
+		t.Error("expected create to be rejected")
+	}
+}
+
+func TestRuntimeClassWeakens(t *testing.T) {
+	spec := v1alpha1.KarydiaConfigSpec{RuntimeClass: "tenant-*=gvisor;untrusted=kata;trusted=none"}
+
+	tests := []struct {
+		value   string
+		weakens bool
+	}{
+		{"gvisor", false},
+		{"kata", false},
+		{"runc", true},
+		{"none", true},
+	}
+	for _, tt := range tests {
+		if namespaceEntriesWeakens(tt.value, spec.RuntimeClass) != tt.weakens {
+			t.Errorf("value '%s': expected weakens to be %v", tt.value, tt.weakens)
+		}
+	}
+	if namespaceEntriesWeakens("none", "") {
+		t.Error("expected 'none' not to weaken empty config")
+	}
+}
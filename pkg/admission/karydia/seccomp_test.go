@@ -17,9 +17,18 @@
 package karydia
 
 import (
+	"encoding/json"
 	"testing"
 
+	"github.com/karydia/karydia/pkg/apis/karydia/v1alpha1"
+	listers "github.com/karydia/karydia/pkg/client/listers/karydia/v1alpha1"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"k8s.io/api/admission/v1beta1"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
 )
 
 /* Mutating and Validating Webhook
@@ -36,7 +45,7 @@ func TestPodSeccompDefaultProfileWithAnnotation(t *testing.T) {
 
 	setting := Setting{value: "runtime/default", src: "namespace"}
 
-	patches = mutatePodSeccompProfile(pod, setting, patches)
+	patches = mutatePodSeccompProfile(pod, seccompProfiles{}, setting, false, patches)
 	if len(patches.operations) != 0 {
 		t.Error("expected 0 patches but got:", patches.operations)
 	}
@@ -45,13 +54,13 @@ func TestPodSeccompDefaultProfileWithAnnotation(t *testing.T) {
 		t.Error("failed to apply patches:", err)
 	}
 	// Zero validation errors expected for mutated pod
-	validationErrors = validatePodSeccompProfile(mutatedPod, setting, validationErrors)
+	validationErrors = validatePodSeccompProfile(mutatedPod, seccompProfiles{}, setting, validationErrors)
 	if len(validationErrors) != 0 {
 		t.Error("expected 0 validationErrors but got:", validationErrors)
 	}
 	validationErrors = []string{}
 	// Zero validation error expected for initial pod
-	validationErrors = validatePodSeccompProfile(pod, setting, validationErrors)
+	validationErrors = validatePodSeccompProfile(pod, seccompProfiles{}, setting, validationErrors)
 	if len(validationErrors) != 0 {
 		t.Error("expected 0 validationErrors but got:", validationErrors)
 	}
@@ -64,7 +73,7 @@ func TestPodSeccompDefaultProfileNoAnnotation(t *testing.T) {
 
 	setting := Setting{value: "runtime/default", src: "namespace"}
 
-	patches = mutatePodSeccompProfile(pod, setting, patches)
+	patches = mutatePodSeccompProfile(pod, seccompProfiles{}, setting, false, patches)
 	if len(patches.operations) != 2 {
 		t.Error("expected 2 patches but got:", patches.operations)
 	}
@@ -78,13 +87,13 @@ func TestPodSeccompDefaultProfileNoAnnotation(t *testing.T) {
 
 	t.Log(mutatedPod)
 	// Zero validation errors expected for mutated pod
-	validationErrors = validatePodSeccompProfile(mutatedPod, setting, validationErrors)
+	validationErrors = validatePodSeccompProfile(mutatedPod, seccompProfiles{}, setting, validationErrors)
 	if len(validationErrors) != 0 {
 		t.Error("expected 0 validationErrors but got:", validationErrors)
 	}
 	validationErrors = []string{}
 	// One validation error expected for initial pod
-	validationErrors = validatePodSeccompProfile(pod, setting, validationErrors)
+	validationErrors = validatePodSeccompProfile(pod, seccompProfiles{}, setting, validationErrors)
 	if len(validationErrors) != 1 {
 		t.Error("expected 1 validationErrors but got:", validationErrors)
 	}
@@ -100,7 +109,7 @@ func TestPodSeccompDefaultProfileOtherAnnotation(t *testing.T) {
 	pod.Annotations = make(map[string]string)
 	pod.Annotations["seccomp.security.alpha.kubernetes.io/pod"] = "runtime/other"
 
-	patches = mutatePodSeccompProfile(pod, setting, patches)
+	patches = mutatePodSeccompProfile(pod, seccompProfiles{}, setting, false, patches)
 	if len(patches.operations) != 0 {
 		t.Error("expected 0 patches but got:", patches.operations)
 	}
@@ -109,14 +118,257 @@ func TestPodSeccompDefaultProfileOtherAnnotation(t *testing.T) {
 		t.Error("failed to apply patches:", err)
 	}
 	// No validation error expected for mutated pod
-	validationErrors = validatePodSeccompProfile(mutatedPod, setting, validationErrors)
+	validationErrors = validatePodSeccompProfile(mutatedPod, seccompProfiles{}, setting, validationErrors)
 	if len(validationErrors) != 0 {
 		t.Error("expected 0 validationErrors but got:", validationErrors)
 	}
 	validationErrors = []string{}
 	// No validation error expected for initial pod
-	validationErrors = validatePodSeccompProfile(pod, setting, validationErrors)
+	validationErrors = validatePodSeccompProfile(pod, seccompProfiles{}, setting, validationErrors)
+	if len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+}
+
+func TestPodSeccompProfileUpdate(t *testing.T) {
+	namespace := &corev1.Namespace{}
+	namespace.Name = "special"
+	namespace.Annotations = map[string]string{"karydia.gardener.cloud/seccompProfile": "runtime/default"}
+
+	karydiaAdmission, err := New(&Config{KubeClientset: k8sfake.NewSimpleClientset(namespace), SeccompProfileField: true})
+	if err != nil {
+		t.Fatal("Failed to load karydia admission:", err)
+	}
+
+	// the seccomp profile of a pod is immutable, so pods created before the
+	// setting applied are not changed or rejected
+	pod := &corev1.Pod{}
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "nginx"}}
+
+	if response := karydiaAdmission.mutatePod(pod, seccompProfiles{}, namespace, v1beta1.Update); len(response.Patch) != 0 && string(response.Patch) != "null" {
+		t.Error("expected 0 patches but got:", string(response.Patch))
+	}
+	if response := karydiaAdmission.validatePod(pod, nil, seccompProfiles{}, namespace, v1beta1.Update); !response.Allowed {
+		t.Error("expected update to be allowed but got:", response.Result)
+	}
+	if response := karydiaAdmission.validatePod(pod, nil, seccompProfiles{}, namespace, v1beta1.Create); response.Allowed {
+		t.Error("expected create to be rejected")
+	}
+}
+
+func TestDecodeSeccompProfiles(t *testing.T) {
+	raw := []byte(`{"spec":{"securityContext":{"seccompProfile":{"type":"Localhost","localhostProfile":"my-profile"}},"initContainers":[{"name":"init","securityContext":{"seccompProfile":{"type":"Unconfined"}}}],"containers":[{"name":"nginx","securityContext":{"seccompProfile":{"type":"RuntimeDefault"}}},{"name":"sidecar"}]}}`)
+
+	profiles, err := decodeSeccompProfiles(raw)
+	if err != nil {
+		t.Fatal("failed to decode seccomp profiles:", err)
+	}
+	if profiles.pod != "localhost/my-profile" {
+		t.Error("expected pod profile 'localhost/my-profile' but got:", profiles.pod)
+	}
+	if profiles.containers["init"] != "unconfined" || profiles.containers["nginx"] != "runtime/default" || len(profiles.containers) != 2 {
+		t.Error("expected container profiles but got:", profiles.containers)
+	}
+
+	pod := corev1.Pod{}
+	if profile := profiles.containerProfile(pod, "sidecar"); profile != "localhost/my-profile" {
+		t.Error("expected container to inherit pod profile but got:", profile)
+	}
+}
+
+/* Mutating and Validating Webhook
+ * Applies the seccomp profile as securityContext.seccompProfile field (Kubernetes >= 1.19).
+ * kubectl annotate ns default karydia.gardener.cloud/seccompProfile=localhost/my-profile
+ */
+func TestPodSeccompProfileField(t *testing.T) {
+	var patches Patches
+	var validationErrors []string
+
+	pod := corev1.Pod{}
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "nginx"}}
+
+	setting := Setting{value: "localhost/my-profile", src: "namespace"}
+
+	patches = mutatePodSeccompProfile(pod, seccompProfiles{}, setting, true, patches)
+	patches = mutatePodSecurityContext(pod, Setting{value: "nobody", src: "config"}, &nobodyProfile, patches)
+	if _, ok := pod.ObjectMeta.Annotations["seccomp.security.alpha.kubernetes.io/pod"]; ok {
+		t.Error("expected no seccomp annotation")
+	}
+
+	mutatedPodJSON, err := json.Marshal(pod)
+	if err != nil {
+		t.Fatal("failed to encode pod:", err)
+	}
+	patchObj, err := jsonpatch.DecodePatch(patches.toBytes())
+	if err != nil {
+		t.Fatal("failed to decode patches:", err)
+	}
+	if mutatedPodJSON, err = patchObj.Apply(mutatedPodJSON); err != nil {
+		t.Fatal("failed to apply patches:", err)
+	}
+	profiles, err := decodeSeccompProfiles(mutatedPodJSON)
+	if err != nil {
+		t.Fatal("failed to decode seccomp profiles:", err)
+	}
+	if profiles.pod != "localhost/my-profile" {
+		t.Error("expected pod profile 'localhost/my-profile' but got:", profiles.pod)
+	}
+	mutatedPod, err := decodePod(mutatedPodJSON)
+	if err != nil {
+		t.Fatal("failed to decode pod:", err)
+	}
+	if mutatedPod.Spec.SecurityContext == nil || mutatedPod.Spec.SecurityContext.RunAsUser == nil {
+		t.Error("expected pod security context to be merged but got:", mutatedPod.Spec.SecurityContext)
+	}
+
+	validationErrors = validatePodSeccompProfile(*mutatedPod, profiles, setting, validationErrors)
+	if len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+
+	patches = mutatePodSeccompProfile(*mutatedPod, profiles, setting, true, Patches{})
+	if len(patches.operations) != 0 {
+		t.Error("expected 0 patches but got:", patches.operations)
+	}
+}
+
+func TestPodSeccompContainerProfiles(t *testing.T) {
+	var validationErrors []string
+
+	pod := corev1.Pod{}
+	pod.Annotations = map[string]string{
+		"container.seccomp.security.alpha.kubernetes.io/init": "runtime/default",
+	}
+	pod.Spec.InitContainers = []corev1.Container{{Name: "init", Image: "busybox"}}
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "nginx"}}
+
+	setting := Setting{value: "runtime/default", src: "config"}
+
+	validationErrors = validatePodSeccompProfile(pod, seccompProfiles{}, setting, validationErrors)
+	if len(validationErrors) != 1 {
+		t.Error("expected 1 validationError but got:", validationErrors)
+	}
+	profiles := seccompProfiles{containers: map[string]string{"nginx": "localhost/my-profile"}}
+	validationErrors = validatePodSeccompProfile(pod, profiles, setting, nil)
+	if len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+}
+
+/* Validating Webhook
+ * Rejects seccomp profiles which are not allowed.
+ * kubectl annotate ns default karydia.gardener.cloud/allowedSeccompProfiles="runtime/default;localhost/*"
+ */
+func TestPodAllowedSeccompProfiles(t *testing.T) {
+	pod := corev1.Pod{}
+	pod.Annotations = map[string]string{
+		"seccomp.security.alpha.kubernetes.io/pod":             "localhost/my-profile",
+		"container.seccomp.security.alpha.kubernetes.io/nginx": "unconfined",
+	}
+	pod.Spec.InitContainers = []corev1.Container{{Name: "init", Image: "busybox"}}
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "nginx"}}
+	ephemeralContainers := []corev1.Container{{Name: "debug", Image: "busybox"}}
+	profiles := seccompProfiles{containers: map[string]string{"init": "runtime/default", "debug": "docker/default"}}
+
+	setting := Setting{value: "runtime/default;localhost/*", src: "namespace"}
+
+	validationErrors := validatePodAllowedSeccompProfiles(pod, ephemeralContainers, profiles, setting, nil)
+	if len(validationErrors) != 2 {
+		t.Error("expected 2 validationErrors but got:", validationErrors)
+	}
+
+	setting = Setting{value: "runtime/default", src: "namespace"}
+	validationErrors = validatePodAllowedSeccompProfiles(pod, ephemeralContainers, profiles, setting, nil)
+	if len(validationErrors) != 3 {
+		t.Error("expected 3 validationErrors but got:", validationErrors)
+	}
+}
+
+/* Validating Webhook
+ * Rejects 'localhost/karydia/' seccomp profiles which are not declared as KarydiaSeccompProfile
+ * and, with --require-declared-seccomp-profiles, all other 'localhost/' profiles.
+ */
+func TestPodLocalhostSeccompProfiles(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	indexer.Add(&v1alpha1.KarydiaSeccompProfile{ObjectMeta: metav1.ObjectMeta{Name: "declared"}})
+	lister := listers.NewKarydiaSeccompProfileLister(indexer)
+
+	pod := corev1.Pod{}
+	pod.Annotations = map[string]string{
+		"seccomp.security.alpha.kubernetes.io/pod":             "localhost/karydia/declared",
+		"container.seccomp.security.alpha.kubernetes.io/nginx": "runtime/default",
+	}
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "nginx"}, {Name: "sidecar", Image: "busybox"}}
+	ephemeralContainers := []corev1.Container{{Name: "debug", Image: "busybox"}}
+
+	validationErrors := validatePodLocalhostSeccompProfiles(pod, ephemeralContainers, seccompProfiles{}, lister, true, nil)
 	if len(validationErrors) != 0 {
 		t.Error("expected 0 validationErrors but got:", validationErrors)
 	}
+
+	profiles := seccompProfiles{containers: map[string]string{"sidecar": "localhost/karydia/undeclared", "debug": "localhost/my-profile.json"}}
+	validationErrors = validatePodLocalhostSeccompProfiles(pod, ephemeralContainers, profiles, lister, false, nil)
+	if len(validationErrors) != 1 {
+		t.Error("expected 1 validationErrors but got:", validationErrors)
+	}
+	validationErrors = validatePodLocalhostSeccompProfiles(pod, ephemeralContainers, profiles, lister, true, nil)
+	if len(validationErrors) != 2 {
+		t.Error("expected 2 validationErrors but got:", validationErrors)
+	}
+}
+
+func TestPodLocalhostSeccompProfilesNotSynced(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	synced := false
+	karydiaAdmission, err := New(&Config{
+		KubeClientset:         k8sfake.NewSimpleClientset(),
+		SeccompProfileLister:  listers.NewKarydiaSeccompProfileLister(indexer),
+		SeccompProfilesSynced: func() bool { return synced },
+	})
+	if err != nil {
+		t.Fatal("Failed to load karydia admission:", err)
+	}
+
+	namespace := &corev1.Namespace{}
+	namespace.Name = "special"
+	pod := &corev1.Pod{}
+	pod.Annotations = map[string]string{"seccomp.security.alpha.kubernetes.io/pod": "localhost/karydia/undeclared"}
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "nginx"}}
+
+	// the webhook must not block pods until the KarydiaSeccompProfile CRD is
+	// installed and the cache is synced
+	if response := karydiaAdmission.validatePod(pod, nil, seccompProfiles{}, namespace, v1beta1.Create); !response.Allowed {
+		t.Error("expected validation response to be true but got:", response.Result)
+	}
+	synced = true
+	if response := karydiaAdmission.validatePod(pod, nil, seccompProfiles{}, namespace, v1beta1.Create); response.Allowed {
+		t.Error("expected validation response to be false")
+	}
+}
+
+func TestPodAllowedSeccompProfilesUpdate(t *testing.T) {
+	namespace := &corev1.Namespace{}
+	namespace.Name = "special"
+	namespace.Annotations = map[string]string{"karydia.gardener.cloud/allowedSeccompProfiles": "runtime/default"}
+
+	karydiaAdmission, err := New(&Config{KubeClientset: k8sfake.NewSimpleClientset(namespace)})
+	if err != nil {
+		t.Fatal("Failed to load karydia admission:", err)
+	}
+
+	// the seccomp profiles of a pod are immutable, so pods created before
+	// the setting applied are not rejected
+	pod := &corev1.Pod{}
+	pod.Annotations = map[string]string{"seccomp.security.alpha.kubernetes.io/pod": "unconfined"}
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "nginx"}}
+
+	if response := karydiaAdmission.mutatePod(pod, seccompProfiles{}, namespace, v1beta1.Update); len(response.Patch) != 0 && string(response.Patch) != "null" {
+		t.Error("expected 0 patches but got:", string(response.Patch))
+	}
+	if response := karydiaAdmission.validatePod(pod, nil, seccompProfiles{}, namespace, v1beta1.Update); !response.Allowed {
+		t.Error("expected update to be allowed but got:", response.Result)
+	}
+	if response := karydiaAdmission.validatePod(pod, nil, seccompProfiles{}, namespace, v1beta1.Create); response.Allowed {
+		t.Error("expected create to be rejected")
+	}
 }
@@ -0,0 +1,140 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package karydia
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/karydia/karydia/pkg/apis/karydia/v1alpha1"
+	"k8s.io/api/admission/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+/* Validating Webhook
+ * Service account token secrets may only be created by the token controller,
+ * configured users and groups and users allowed to override the setting.
+ * kubectl annotate ns default karydia.gardener.cloud/serviceAccountTokenSecrets=restricted
+ */
+func newSecretTestAdmission(t *testing.T, kubeobjects ...runtime.Object) *KarydiaAdmission {
+	kubeclient := k8sfake.NewSimpleClientset(kubeobjects...)
+
+	karydiaAdmission, err := New(&Config{
+		KubeClientset: kubeclient,
+		KarydiaConfig: &v1alpha1.KarydiaConfig{
+			Spec: v1alpha1.KarydiaConfigSpec{
+				ServiceAccountTokenSecrets:        "restricted",
+				ServiceAccountTokenSecretCreators: "system:serviceaccount:ci:token-minter;token-admins",
+			},
+		},
+		Authorizer: authorizer.AuthorizerFunc(func(a authorizer.Attributes) (authorizer.Decision, string, error) {
+			if a.GetUser().GetName() == "admin" && a.GetVerb() == "override" && a.GetResource() == "settings" && a.GetName() == "serviceAccountTokenSecrets" {
+				return authorizer.DecisionAllow, "", nil
+			}
+			return authorizer.DecisionNoOpinion, "", nil
+		}),
+	})
+	if err != nil {
+		t.Fatal("Failed to load karydia admission:", err)
+	}
+	return karydiaAdmission
+}
+
+func secretAdmissionReview(userInfo authenticationv1.UserInfo, secret *corev1.Secret) v1beta1.AdmissionReview {
+	rawSecret, _ := json.Marshal(secret)
+	return v1beta1.AdmissionReview{
+		Request: &v1beta1.AdmissionRequest{
+			Operation: "CREATE",
+			Namespace: secret.Namespace,
+			Kind:      metav1.GroupVersionKind{Group: "", Version: "v1", Kind: "Secret"},
+			Object: runtime.RawExtension{
+				Raw: rawSecret,
+			},
+			UserInfo: userInfo,
+		},
+	}
+}
+
+func TestSecretServiceAccountToken(t *testing.T) {
+	namespace := &corev1.Namespace{}
+	namespace.Name = "default"
+	karydiaAdmission := newSecretTestAdmission(t, namespace)
+
+	secret := &corev1.Secret{}
+	secret.Name = "default-token-manual"
+	secret.Namespace = "default"
+	secret.Type = corev1.SecretTypeServiceAccountToken
+	secret.Annotations = map[string]string{"kubernetes.io/service-account.name": "default"}
+
+	for _, tc := range []struct {
+		userInfo authenticationv1.UserInfo
+		allowed  bool
+	}{
+		{authenticationv1.UserInfo{Username: "developer"}, false},
+		{authenticationv1.UserInfo{Username: "system:serviceaccount:default:default", Groups: []string{"system:serviceaccounts"}}, false},
+		{authenticationv1.UserInfo{Username: "system:kube-controller-manager"}, true},
+		{authenticationv1.UserInfo{Username: "system:serviceaccount:ci:token-minter"}, true},
+		{authenticationv1.UserInfo{Username: "jane", Groups: []string{"token-admins"}}, true},
+		{authenticationv1.UserInfo{Username: "admin"}, true},
+	} {
+		validationResponse := karydiaAdmission.Admit(secretAdmissionReview(tc.userInfo, secret), false)
+		if validationResponse.Allowed != tc.allowed {
+			t.Errorf("expected validation response for user '%s' to be %v but is %v", tc.userInfo.Username, tc.allowed, validationResponse.Allowed)
+		}
+		mutationResponse := karydiaAdmission.Admit(secretAdmissionReview(tc.userInfo, secret), true)
+		if !mutationResponse.Allowed {
+			t.Error("expected mutation response to be true but is", mutationResponse.Allowed)
+		}
+	}
+
+	// other secrets are not restricted
+	secret.Type = corev1.SecretTypeOpaque
+	validationResponse := karydiaAdmission.Admit(secretAdmissionReview(authenticationv1.UserInfo{Username: "developer"}, secret), false)
+	if !validationResponse.Allowed {
+		t.Error("expected validation response to be true but is", validationResponse.Allowed)
+	}
+}
+
+func TestSecretServiceAccountTokenNamespaceAnnotation(t *testing.T) {
+	namespace := &corev1.Namespace{}
+	namespace.Name = "default"
+	namespace.Annotations = map[string]string{"karydia.gardener.cloud/serviceAccountTokenSecrets": "none"}
+	karydiaAdmission := newSecretTestAdmission(t, namespace)
+
+	secret := &corev1.Secret{}
+	secret.Name = "default-token-manual"
+	secret.Namespace = "default"
+	secret.Type = corev1.SecretTypeServiceAccountToken
+	// the annotation of the secret itself is ignored
+	secret.Annotations = map[string]string{"karydia.gardener.cloud/serviceAccountTokenSecrets": "restricted"}
+
+	validationResponse := karydiaAdmission.Admit(secretAdmissionReview(authenticationv1.UserInfo{Username: "developer"}, secret), false)
+	if !validationResponse.Allowed {
+		t.Error("expected validation response to be true but is", validationResponse.Allowed)
+	}
+
+	karydiaAdmission.karydiaConfig.Spec.Enforcement = true
+	validationResponse = karydiaAdmission.Admit(secretAdmissionReview(authenticationv1.UserInfo{Username: "developer"}, secret), false)
+	if validationResponse.Allowed {
+		t.Error("expected validation response to be false but is", validationResponse.Allowed)
+	}
+}
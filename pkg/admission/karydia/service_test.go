@@ -0,0 +1,243 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package karydia
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/karydia/karydia/pkg/apis/karydia/v1alpha1"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	corev1 "k8s.io/api/core/v1"
+)
+
+/* Validating Webhook
+ * Rejects services of types which are not allowed.
+ * kubectl annotate ns default karydia.gardener.cloud/serviceTypes="ClusterIP;LoadBalancer"
+ */
+func TestServiceTypes(t *testing.T) {
+	setting := Setting{value: "ClusterIP;LoadBalancer", src: "namespace"}
+
+	svc := corev1.Service{}
+	if validationErrors := validateServiceType(svc, nil, setting, nil); len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+
+	// load balancers must not allocate node ports if 'NodePort' is not allowed
+	svc.Spec.Type = corev1.ServiceTypeLoadBalancer
+	if validationErrors := validateServiceType(svc, nil, setting, nil); len(validationErrors) != 1 {
+		t.Error("expected 1 validationErrors but got:", validationErrors)
+	}
+	allocateNodePorts := true
+	if validationErrors := validateServiceType(svc, &allocateNodePorts, setting, nil); len(validationErrors) != 1 {
+		t.Error("expected 1 validationErrors but got:", validationErrors)
+	}
+	allocateNodePorts = false
+	if validationErrors := validateServiceType(svc, &allocateNodePorts, setting, nil); len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+	if validationErrors := validateServiceType(svc, nil, Setting{value: "LoadBalancer;NodePort", src: "namespace"}, nil); len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+
+	svc.Spec.Type = corev1.ServiceTypeNodePort
+	if validationErrors := validateServiceType(svc, nil, setting, nil); len(validationErrors) != 1 {
+		t.Error("expected 1 validationErrors but got:", validationErrors)
+	}
+}
+
+func TestDecodeAllocateLoadBalancerNodePorts(t *testing.T) {
+	allocateNodePorts, err := decodeAllocateLoadBalancerNodePorts([]byte(`{"spec":{"type":"LoadBalancer","allocateLoadBalancerNodePorts":false}}`))
+	if err != nil {
+		t.Fatal("failed to decode service:", err)
+	}
+	if allocateNodePorts == nil || *allocateNodePorts {
+		t.Error("expected allocateLoadBalancerNodePorts to be false but got:", allocateNodePorts)
+	}
+
+	allocateNodePorts, err = decodeAllocateLoadBalancerNodePorts([]byte(`{"spec":{"type":"LoadBalancer"}}`))
+	if err != nil {
+		t.Fatal("failed to decode service:", err)
+	}
+	if allocateNodePorts != nil {
+		t.Error("expected allocateLoadBalancerNodePorts to be undefined but got:", *allocateNodePorts)
+	}
+}
+
+/* Validating Webhook
+ * Rejects services with external IPs (CVE-2020-8554).
+ * kubectl annotate ns default karydia.gardener.cloud/serviceExternalIPs=deny
+ */
+func TestServiceExternalIPs(t *testing.T) {
+	svc := corev1.Service{}
+	svc.Spec.ExternalIPs = []string{"10.0.0.1"}
+
+	if validationErrors := validateServiceExternalIPs(svc, nil, Setting{value: "deny", src: "config"}, nil); len(validationErrors) != 1 {
+		t.Error("expected 1 validationErrors but got:", validationErrors)
+	}
+	if validationErrors := validateServiceExternalIPs(svc, nil, Setting{value: "none", src: "config"}, nil); len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+
+	svc.Spec.ExternalIPs = nil
+	if validationErrors := validateServiceExternalIPs(svc, nil, Setting{value: "deny", src: "config"}, nil); len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+
+	// external IPs of existing services are accepted on updates, new ones
+	// are rejected
+	svc.Spec.ExternalIPs = []string{"10.0.0.1", "10.0.0.2"}
+	if validationErrors := validateServiceExternalIPs(svc, []string{"10.0.0.1", "10.0.0.2"}, Setting{value: "deny", src: "config"}, nil); len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+	if validationErrors := validateServiceExternalIPs(svc, []string{"10.0.0.1"}, Setting{value: "deny", src: "config"}, nil); len(validationErrors) != 1 {
+		t.Error("expected 1 validationErrors but got:", validationErrors)
+	}
+}
+
+/* Mutating and Validating Webhook
+ * Forces internal load balancers of the cloud provider.
+ * kubectl annotate ns default karydia.gardener.cloud/internalLoadBalancer=AWS
+ */
+func TestServiceInternalLoadBalancer(t *testing.T) {
+	setting := Setting{value: "AWS", src: "namespace"}
+
+	svc := corev1.Service{}
+	svc.Spec.Type = corev1.ServiceTypeLoadBalancer
+
+	validationErrors := validateServiceInternalLoadBalancer(svc, setting, nil)
+	if len(validationErrors) != 1 {
+		t.Error("expected 1 validationErrors but got:", validationErrors)
+	}
+
+	patches := mutateServiceInternalLoadBalancer(svc, setting, Patches{})
+	mutatedSvc, err := patchService(svc, patches)
+	if err != nil {
+		t.Fatal("failed to apply patches:", err)
+	}
+	if mutatedSvc.Annotations["service.beta.kubernetes.io/aws-load-balancer-internal"] != "true" {
+		t.Error("expected internal load balancer annotation but got:", mutatedSvc.Annotations)
+	}
+	if mutatedSvc.Annotations["karydia.gardener.cloud/internalLoadBalancer.internal"] != "namespace/AWS" {
+		t.Error("expected internal annotation but got:", mutatedSvc.Annotations)
+	}
+	validationErrors = validateServiceInternalLoadBalancer(mutatedSvc, setting, nil)
+	if len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+	if patches := mutateServiceInternalLoadBalancer(mutatedSvc, setting, Patches{}); len(patches.operations) != 0 {
+		t.Error("expected 0 patches but got:", patches.operations)
+	}
+
+	svc.Annotations = map[string]string{"service.beta.kubernetes.io/aws-load-balancer-internal": "false"}
+	if patches := mutateServiceInternalLoadBalancer(svc, setting, Patches{}); len(patches.operations) != 0 {
+		t.Error("expected 0 patches but got:", patches.operations)
+	}
+	if validationErrors := validateServiceInternalLoadBalancer(svc, setting, nil); len(validationErrors) != 1 {
+		t.Error("expected 1 validationErrors but got:", validationErrors)
+	}
+
+	clusterIPSvc := corev1.Service{}
+	if patches := mutateServiceInternalLoadBalancer(clusterIPSvc, setting, Patches{}); len(patches.operations) != 0 {
+		t.Error("expected 0 patches but got:", patches.operations)
+	}
+	if validationErrors := validateServiceInternalLoadBalancer(clusterIPSvc, setting, nil); len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+
+	if validationErrors := validateServiceInternalLoadBalancer(svc, Setting{value: "unknown", src: "config"}, nil); len(validationErrors) != 1 {
+		t.Error("expected 1 validationErrors but got:", validationErrors)
+	}
+	// an unknown cloud provider does not affect services of other types
+	if validationErrors := validateServiceInternalLoadBalancer(clusterIPSvc, Setting{value: "unknown", src: "config"}, nil); len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+}
+
+func TestNamespaceInternalLoadBalancer(t *testing.T) {
+	tests := []struct {
+		value            string
+		validationErrors int
+	}{
+		{"AWS", 0},
+		{"none", 0},
+		{"unknown", 1},
+	}
+	for _, test := range tests {
+		ns := corev1.Namespace{}
+		ns.Annotations = map[string]string{"karydia.gardener.cloud/internalLoadBalancer": test.value}
+		if validationErrors := validateNamespaceInternalLoadBalancer(ns, nil); len(validationErrors) != test.validationErrors {
+			t.Errorf("%s: expected %d validationErrors but got: %v", test.value, test.validationErrors, validationErrors)
+		}
+	}
+}
+
+func TestServiceWeakeningAnnotations(t *testing.T) {
+	spec := v1alpha1.KarydiaConfigSpec{
+		ServiceTypes:         "ClusterIP;LoadBalancer",
+		ServiceExternalIPs:   "deny",
+		InternalLoadBalancer: "AWS",
+	}
+
+	tests := []struct {
+		annotation string
+		value      string
+		weakens    bool
+	}{
+		{"karydia.gardener.cloud/serviceTypes", "ClusterIP", false},
+		{"karydia.gardener.cloud/serviceTypes", "ClusterIP;NodePort", true},
+		{"karydia.gardener.cloud/serviceTypes", "none", true},
+		{"karydia.gardener.cloud/serviceExternalIPs", "deny", false},
+		{"karydia.gardener.cloud/serviceExternalIPs", "none", true},
+		{"karydia.gardener.cloud/internalLoadBalancer", "AWS", false},
+		{"karydia.gardener.cloud/internalLoadBalancer", "none", true},
+	}
+
+	for _, test := range tests {
+		for _, w := range weakeningAnnotations {
+			if w.annotation != test.annotation {
+				continue
+			}
+			if weakens := w.weakens(test.value, spec); weakens != test.weakens {
+				t.Errorf("expected %s=%s to weaken the config: %v", test.annotation, test.value, test.weakens)
+			}
+		}
+	}
+}
+
+func patchService(svc corev1.Service, patches Patches) (corev1.Service, error) {
+	var svcJSON []byte
+	svcJSON, err := json.Marshal(&svc)
+	if err != nil {
+		return svc, err
+	}
+
+	patchObj, err := jsonpatch.DecodePatch(patches.toBytes())
+	if err != nil {
+		return svc, err
+	}
+	svcPatchedJSON, err := patchObj.Apply(svcJSON)
+	if err != nil {
+		return svc, err
+	}
+
+	var svcPatched corev1.Service
+	json.Unmarshal(svcPatchedJSON, &svcPatched)
+
+	return svcPatched, nil
+}
@@ -20,8 +20,12 @@ import (
 	"encoding/json"
 	"testing"
 
+	"github.com/karydia/karydia/pkg/apis/karydia/v1alpha1"
+
 	jsonpatch "github.com/evanphx/json-patch"
+	"k8s.io/api/admission/v1beta1"
 	corev1 "k8s.io/api/core/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
 )
 
 /* Mutating and Validating Webhook
@@ -341,6 +345,252 @@ func TestServiceAccountRandomAnnotationSpecificServiceAccountMountUndefined(t *t
 }
 
 /* Helper functions */
+/* Mutating and Validating Webhook
+ * Disables the automount of the service account token for pods of the
+ * default service account and removes the already added token volume.
+ * kubectl annotate ns default karydia.gardener.cloud/automountServiceAccountToken=change-default
+ */
+func TestPodChangeDefaultServiceAccountMountUndefined(t *testing.T) {
+	tokenMount := corev1.VolumeMount{Name: "default-token-abcde", MountPath: "/var/run/secrets/kubernetes.io/serviceaccount", ReadOnly: true}
+	pod := corev1.Pod{}
+	pod.Spec.Volumes = []corev1.Volume{
+		{Name: "data", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+		{Name: "default-token-abcde", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "default-token-abcde"}}},
+	}
+	pod.Spec.InitContainers = []corev1.Container{{Name: "init", Image: "busybox", VolumeMounts: []corev1.VolumeMount{tokenMount}}}
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "nginx", VolumeMounts: []corev1.VolumeMount{{Name: "data", MountPath: "/data"}, tokenMount}}}
+
+	setting := Setting{value: "change-default", src: "namespace"}
+
+	validationErrors := validatePodServiceAccountTokenMount(pod, corev1.ServiceAccount{}, setting, nil)
+	if len(validationErrors) != 1 {
+		t.Error("expected 1 validationError but got:", validationErrors)
+	}
+
+	patches := mutatePodServiceAccountTokenMount(pod, corev1.ServiceAccount{}, setting, Patches{})
+	if len(patches.operations) != 5 {
+		t.Error("expected 5 patches but got:", patches.operations)
+	}
+	mutatedPod, err := patchPod(pod, patches)
+	if err != nil {
+		t.Error("failed to apply patches:", err)
+	}
+	if mutatedPod.Spec.AutomountServiceAccountToken == nil || *mutatedPod.Spec.AutomountServiceAccountToken {
+		t.Error("expected automountServiceAccountToken to be false")
+	}
+	if len(mutatedPod.Spec.Volumes) != 1 || len(mutatedPod.Spec.InitContainers[0].VolumeMounts) != 0 || len(mutatedPod.Spec.Containers[0].VolumeMounts) != 1 {
+		t.Error("expected token volume to be removed but got:", mutatedPod.Spec)
+	}
+	if mutatedPod.Annotations["karydia.gardener.cloud/automountServiceAccountToken.internal"] != "namespace/change-default" {
+		t.Error("expected internal annotation but got:", mutatedPod.Annotations)
+	}
+
+	validationErrors = validatePodServiceAccountTokenMount(mutatedPod, corev1.ServiceAccount{}, setting, nil)
+	if len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+}
+
+func TestPodChangeDefaultSpecificServiceAccount(t *testing.T) {
+	pod := corev1.Pod{}
+	pod.Spec.ServiceAccountName = "specific"
+
+	setting := Setting{value: "change-default", src: "config"}
+
+	if patches := mutatePodServiceAccountTokenMount(pod, corev1.ServiceAccount{}, setting, Patches{}); len(patches.operations) != 0 {
+		t.Error("expected 0 patches but got:", patches.operations)
+	}
+	if validationErrors := validatePodServiceAccountTokenMount(pod, corev1.ServiceAccount{}, setting, nil); len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+
+	setting = Setting{value: "change-all", src: "config"}
+	if patches := mutatePodServiceAccountTokenMount(pod, corev1.ServiceAccount{}, setting, Patches{}); len(patches.operations) != 2 {
+		t.Error("expected 2 patches but got:", patches.operations)
+	}
+}
+
+/* Mutating and Validating Webhook
+ * Leaves pods untouched whose service account defines automountServiceAccountToken.
+ * kubectl annotate ns default karydia.gardener.cloud/automountServiceAccountToken=change-all
+ */
+func TestPodChangeAllServiceAccountMountDefined(t *testing.T) {
+	automount := true
+	sAcc := corev1.ServiceAccount{AutomountServiceAccountToken: &automount}
+	pod := corev1.Pod{}
+	pod.Spec.ServiceAccountName = "controller"
+	pod.Spec.Volumes = []corev1.Volume{
+		{Name: "controller-token-abcde", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "controller-token-abcde"}}},
+	}
+
+	setting := Setting{value: "change-all", src: "namespace"}
+
+	if patches := mutatePodServiceAccountTokenMount(pod, sAcc, setting, Patches{}); len(patches.operations) != 0 {
+		t.Error("expected 0 patches but got:", patches.operations)
+	}
+	if validationErrors := validatePodServiceAccountTokenMount(pod, sAcc, setting, nil); len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+	pod.Spec.AutomountServiceAccountToken = &automount
+	if validationErrors := validatePodServiceAccountTokenMount(pod, sAcc, setting, nil); len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+
+	automount = false
+	pod.Spec.AutomountServiceAccountToken = nil
+	pod.Spec.Volumes = nil
+	if patches := mutatePodServiceAccountTokenMount(pod, sAcc, setting, Patches{}); len(patches.operations) != 0 {
+		t.Error("expected 0 patches but got:", patches.operations)
+	}
+	if validationErrors := validatePodServiceAccountTokenMount(pod, sAcc, setting, nil); len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+	podAutomount := true
+	pod.Spec.AutomountServiceAccountToken = &podAutomount
+	if validationErrors := validatePodServiceAccountTokenMount(pod, sAcc, setting, nil); len(validationErrors) != 1 {
+		t.Error("expected 1 validationError but got:", validationErrors)
+	}
+}
+
+/* Validating Webhook
+ * Rejects explicit opt-in unless the setting is 'no-change'.
+ * kubectl annotate pod nginx karydia.gardener.cloud/automountServiceAccountToken=no-change
+ */
+func TestPodChangeAllServiceAccountMountTrue(t *testing.T) {
+	automount := true
+	pod := corev1.Pod{}
+	pod.Spec.AutomountServiceAccountToken = &automount
+
+	setting := Setting{value: "change-all", src: "namespace"}
+
+	if patches := mutatePodServiceAccountTokenMount(pod, corev1.ServiceAccount{}, setting, Patches{}); len(patches.operations) != 0 {
+		t.Error("expected 0 patches but got:", patches.operations)
+	}
+	if validationErrors := validatePodServiceAccountTokenMount(pod, corev1.ServiceAccount{}, setting, nil); len(validationErrors) != 1 {
+		t.Error("expected 1 validationError but got:", validationErrors)
+	}
+
+	setting = Setting{value: "no-change", src: "pod"}
+	if validationErrors := validatePodServiceAccountTokenMount(pod, corev1.ServiceAccount{}, setting, nil); len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+}
+
+/* Mutating and Validating Webhook
+ * Replaces the legacy token secret volume of pods with a projected, bound
+ * service account token.
+ * kubectl annotate ns default karydia.gardener.cloud/serviceAccountTokenProjection=projected
+ */
+func TestPodServiceAccountTokenProjection(t *testing.T) {
+	var mode int32 = 0644
+	automount := true
+	tokenMount := corev1.VolumeMount{Name: "app-token-abcde", MountPath: "/var/run/secrets/kubernetes.io/serviceaccount", ReadOnly: true}
+	pod := corev1.Pod{}
+	pod.Spec.ServiceAccountName = "app"
+	pod.Spec.AutomountServiceAccountToken = &automount
+	pod.Spec.Volumes = []corev1.Volume{
+		{Name: "data", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+		{Name: "app-token-abcde", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "app-token-abcde", DefaultMode: &mode}}},
+	}
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "nginx", VolumeMounts: []corev1.VolumeMount{tokenMount}}}
+
+	spec := v1alpha1.KarydiaConfigSpec{ServiceAccountTokenAudience: "vault"}
+	setting := Setting{value: "projected", src: "namespace"}
+
+	validationErrors := validatePodServiceAccountTokenProjection(pod, setting, nil)
+	if len(validationErrors) != 1 {
+		t.Error("expected 1 validationError but got:", validationErrors)
+	}
+
+	patches := mutatePodServiceAccountTokenProjection(pod, spec, setting, Patches{})
+	if len(patches.operations) != 2 {
+		t.Error("expected 2 patches but got:", patches.operations)
+	}
+	mutatedPod, err := patchPod(pod, patches)
+	if err != nil {
+		t.Error("failed to apply patches:", err)
+	}
+	volume := mutatedPod.Spec.Volumes[1]
+	if volume.Name != "app-token-abcde" || volume.Secret != nil || volume.Projected == nil || len(volume.Projected.Sources) != 2 {
+		t.Fatal("expected projected token volume but got:", volume)
+	}
+	if *volume.Projected.DefaultMode != mode {
+		t.Error("expected default mode to be kept but got:", *volume.Projected.DefaultMode)
+	}
+	token := volume.Projected.Sources[0].ServiceAccountToken
+	if token == nil || token.Audience != "vault" || *token.ExpirationSeconds != defaultServiceAccountTokenExpirationSeconds || token.Path != "token" {
+		t.Error("expected bound service account token but got:", volume.Projected.Sources[0])
+	}
+	if secret := volume.Projected.Sources[1].Secret; secret == nil || secret.Name != "app-token-abcde" || len(secret.Items) != 2 {
+		t.Error("expected 'ca.crt' and 'namespace' from the token secret but got:", volume.Projected.Sources[1])
+	}
+	if mutatedPod.Annotations["karydia.gardener.cloud/serviceAccountTokenProjection.internal"] != "namespace/projected" {
+		t.Error("expected internal annotation but got:", mutatedPod.Annotations)
+	}
+
+	validationErrors = validatePodServiceAccountTokenProjection(mutatedPod, setting, nil)
+	if len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+
+	// too short lifetimes are raised to the minimum of the API server
+	spec.ServiceAccountTokenExpirationSeconds = 60
+	mutatedPod, err = patchPod(pod, mutatePodServiceAccountTokenProjection(pod, spec, setting, Patches{}))
+	if err != nil {
+		t.Error("failed to apply patches:", err)
+	}
+	if expirationSeconds := *mutatedPod.Spec.Volumes[1].Projected.Sources[0].ServiceAccountToken.ExpirationSeconds; expirationSeconds != minServiceAccountTokenExpirationSeconds {
+		t.Error("expected minimum expiration but got:", expirationSeconds)
+	}
+
+	setting = Setting{value: "none", src: "pod"}
+	if patches := mutatePodServiceAccountTokenProjection(pod, spec, setting, Patches{}); len(patches.operations) != 0 {
+		t.Error("expected 0 patches but got:", patches.operations)
+	}
+	if validationErrors := validatePodServiceAccountTokenProjection(pod, setting, nil); len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+
+	// the volume of other service accounts and projected volumes are kept
+	pod.Spec.ServiceAccountName = "other"
+	setting = Setting{value: "projected", src: "config"}
+	if patches := mutatePodServiceAccountTokenProjection(pod, spec, setting, Patches{}); len(patches.operations) != 0 {
+		t.Error("expected 0 patches but got:", patches.operations)
+	}
+}
+
+/* Mutating and Validating Webhook
+ * Pods created before the token projection was enabled can still be updated,
+ * as the volumes of a pod are immutable.
+ */
+func TestPodServiceAccountTokenProjectionUpdate(t *testing.T) {
+	namespace := &corev1.Namespace{}
+	namespace.Name = "special"
+	namespace.Annotations = map[string]string{"karydia.gardener.cloud/serviceAccountTokenProjection": "projected"}
+
+	karydiaAdmission, err := New(&Config{KubeClientset: k8sfake.NewSimpleClientset(namespace)})
+	if err != nil {
+		t.Fatal("Failed to load karydia admission:", err)
+	}
+
+	pod := &corev1.Pod{}
+	pod.Spec.ServiceAccountName = "app"
+	pod.Spec.Volumes = []corev1.Volume{
+		{Name: "app-token-abcde", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "app-token-abcde"}}},
+	}
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "nginx"}}
+
+	if response := karydiaAdmission.mutatePod(pod, seccompProfiles{}, namespace, v1beta1.Update); len(response.Patch) != 0 && string(response.Patch) != "null" {
+		t.Error("expected 0 patches but got:", string(response.Patch))
+	}
+	if response := karydiaAdmission.validatePod(pod, nil, seccompProfiles{}, namespace, v1beta1.Update); !response.Allowed {
+		t.Error("expected update to be allowed but got:", response.Result)
+	}
+	if response := karydiaAdmission.validatePod(pod, nil, seccompProfiles{}, namespace, v1beta1.Create); response.Allowed {
+		t.Error("expected create to be rejected")
+	}
+}
+
 func patchPod(pod corev1.Pod, patches Patches) (corev1.Pod, error) {
 	var podJSON []byte
 	podJSON, err := json.Marshal(&pod)
@@ -384,3 +634,31 @@ func patchServiceAccount(sAcc corev1.ServiceAccount, patches Patches) (corev1.Se
 
 	return sAccPatched, nil
 }
+
+/* Mutating and Validating Webhook
+ * Pods created before the automount setting was enabled can still be updated,
+ * as automountServiceAccountToken of a pod is immutable.
+ */
+func TestPodChangeDefaultServiceAccountMountUpdate(t *testing.T) {
+	namespace := &corev1.Namespace{}
+	namespace.Name = "special"
+	namespace.Annotations = map[string]string{"karydia.gardener.cloud/automountServiceAccountToken": "change-default"}
+
+	karydiaAdmission, err := New(&Config{KubeClientset: k8sfake.NewSimpleClientset(namespace)})
+	if err != nil {
+		t.Fatal("Failed to load karydia admission:", err)
+	}
+
+	pod := &corev1.Pod{}
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "nginx"}}
+
+	if response := karydiaAdmission.mutatePod(pod, seccompProfiles{}, namespace, v1beta1.Update); len(response.Patch) != 0 && string(response.Patch) != "null" {
+		t.Error("expected 0 patches but got:", string(response.Patch))
+	}
+	if response := karydiaAdmission.validatePod(pod, nil, seccompProfiles{}, namespace, v1beta1.Update); !response.Allowed {
+		t.Error("expected update to be allowed but got:", response.Result)
+	}
+	if response := karydiaAdmission.validatePod(pod, nil, seccompProfiles{}, namespace, v1beta1.Create); response.Allowed {
+		t.Error("expected create to be rejected")
+	}
+}
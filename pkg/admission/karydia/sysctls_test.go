@@ -0,0 +1,142 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package karydia
+
+import (
+	"testing"
+
+	"github.com/karydia/karydia/pkg/apis/karydia/v1alpha1"
+
+	"k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func sysctlPod(names ...string) corev1.Pod {
+	pod := corev1.Pod{}
+	pod.Spec.SecurityContext = &corev1.PodSecurityContext{}
+	for _, name := range names {
+		pod.Spec.SecurityContext.Sysctls = append(pod.Spec.SecurityContext.Sysctls, corev1.Sysctl{Name: name, Value: "1"})
+	}
+	pod.Spec.Containers = []corev1.Container{{Name: "nginx", Image: "nginx"}}
+	return pod
+}
+
+/* Validating Webhook
+ * Rejects unsafe sysctls which are not allowed and non-default /proc mounts.
+ * kubectl annotate ns default karydia.gardener.cloud/sysctls="net.core.somaxconn;net.ipv4.tcp_*"
+ */
+func TestPodSysctls(t *testing.T) {
+	tests := []struct {
+		setting string
+		sysctl  string
+		errors  int
+	}{
+		{"safe", "net.ipv4.ip_local_port_range", 0},
+		{"safe", "net/ipv4/tcp_syncookies", 0},
+		{"safe", "kernel.msgmax", 1},
+		{"safe", "net.core.somaxconn", 1},
+		{"net.core.somaxconn;net.ipv4.tcp_*", "net.core.somaxconn", 0},
+		{"net.core.somaxconn;net.ipv4.tcp_*", "net.ipv4.tcp_keepalive_time", 0},
+		{"net.core.somaxconn;net.ipv4.tcp_*", "net.ipv4.ip_local_port_range", 0},
+		{"net.core.somaxconn;net.ipv4.tcp_*", "net.ipv4.ip_forward", 1},
+		{"net.core.somaxconn;net.ipv4.tcp_*", "kernel.msgmax", 1},
+		{"none", "kernel.msgmax", 0},
+	}
+	for _, tt := range tests {
+		validationErrors := validatePodSysctls(sysctlPod(tt.sysctl), nil, Setting{value: tt.setting, src: "namespace"}, nil)
+		if len(validationErrors) != tt.errors {
+			t.Errorf("setting '%s', sysctl '%s': expected %d validationErrors but got: %v", tt.setting, tt.sysctl, tt.errors, validationErrors)
+		}
+	}
+
+	validationErrors := validatePodSysctls(sysctlPod("kernel.msgmax", "kernel.sem", "kernel.shm_rmid_forced"), nil, Setting{value: "safe", src: "config"}, nil)
+	if len(validationErrors) != 2 {
+		t.Error("expected 2 validationErrors but got:", validationErrors)
+	}
+}
+
+func TestPodProcMount(t *testing.T) {
+	unmasked := corev1.UnmaskedProcMount
+	defaultProcMount := corev1.DefaultProcMount
+	setting := Setting{value: "safe", src: "config"}
+
+	pod := sysctlPod()
+	pod.Spec.Containers[0].SecurityContext = &corev1.SecurityContext{ProcMount: &defaultProcMount}
+	if validationErrors := validatePodSysctls(pod, nil, setting, nil); len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+
+	pod.Spec.InitContainers = []corev1.Container{{Name: "init", Image: "busybox", SecurityContext: &corev1.SecurityContext{ProcMount: &unmasked}}}
+	ephemeralContainers := []corev1.Container{{Name: "debug", Image: "busybox", SecurityContext: &corev1.SecurityContext{ProcMount: &unmasked}}}
+	if validationErrors := validatePodSysctls(pod, ephemeralContainers, setting, nil); len(validationErrors) != 2 {
+		t.Error("expected 2 validationErrors but got:", validationErrors)
+	}
+	if validationErrors := validatePodSysctls(pod, ephemeralContainers, Setting{value: "none", src: "pod"}, nil); len(validationErrors) != 0 {
+		t.Error("expected 0 validationErrors but got:", validationErrors)
+	}
+}
+
+func TestSysctlsWeakens(t *testing.T) {
+	spec := v1alpha1.KarydiaConfigSpec{Sysctls: "net.ipv4.tcp_*"}
+
+	tests := []struct {
+		value   string
+		weakens bool
+	}{
+		{"safe", false},
+		{"net.ipv4.tcp_keepalive_time", false},
+		{"net.ipv4.tcp_*", false},
+		{"net.ipv4.*", true},
+		{"kernel.msgmax", true},
+		{"none", true},
+	}
+	for _, tt := range tests {
+		if sysctlsWeakens(tt.value, spec) != tt.weakens {
+			t.Errorf("value '%s': expected weakens to be %v", tt.value, tt.weakens)
+		}
+	}
+	if sysctlsWeakens("none", v1alpha1.KarydiaConfigSpec{Sysctls: "none"}) {
+		t.Error("expected 'none' not to weaken disabled config")
+	}
+}
+
+func TestPodSysctlsUpdate(t *testing.T) {
+	namespace := &corev1.Namespace{}
+	namespace.Name = "special"
+	namespace.Annotations = map[string]string{"karydia.gardener.cloud/sysctls": "safe"}
+
+	karydiaAdmission, err := New(&Config{KubeClientset: k8sfake.NewSimpleClientset(namespace)})
+	if err != nil {
+		t.Fatal("Failed to load karydia admission:", err)
+	}
+
+	// the security context of a pod is immutable, so pods created before
+	// the setting applied are not rejected
+	unsafePod := sysctlPod("kernel.msgmax")
+	pod := &unsafePod
+
+	if response := karydiaAdmission.mutatePod(pod, seccompProfiles{}, namespace, v1beta1.Update); len(response.Patch) != 0 && string(response.Patch) != "null" {
+		t.Error("expected 0 patches but got:", string(response.Patch))
+	}
+	if response := karydiaAdmission.validatePod(pod, nil, seccompProfiles{}, namespace, v1beta1.Update); !response.Allowed {
+		t.Error("expected update to be allowed but got:", response.Result)
+	}
+	if response := karydiaAdmission.validatePod(pod, nil, seccompProfiles{}, namespace, v1beta1.Create); response.Allowed {
+		t.Error("expected create to be rejected")
+	}
+}
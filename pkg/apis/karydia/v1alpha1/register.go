@@ -49,6 +49,8 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 		&KarydiaConfigList{},
 		&KarydiaNetworkPolicy{},
 		&KarydiaNetworkPolicyList{},
+		&KarydiaSeccompProfile{},
+		&KarydiaSeccompProfileList{},
 	)
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
 	return nil
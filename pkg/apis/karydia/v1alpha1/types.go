@@ -17,6 +17,7 @@
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -42,14 +43,147 @@ type KarydiaConfigSpec struct {
 	// of service account tokens by default
 	AutomountServiceAccountToken string `json:"automountServiceAccountToken"`
 
+	// ServiceAccountTokenProjection can be used to replace the legacy
+	// service account token volume of pods with a projected, bound token
+	ServiceAccountTokenProjection string `json:"serviceAccountTokenProjection"`
+
+	// ServiceAccountTokenAudience is the audience of projected service
+	// account tokens (defaults to the audience of the API server)
+	ServiceAccountTokenAudience string `json:"serviceAccountTokenAudience"`
+
+	// ServiceAccountTokenExpirationSeconds is the requested lifetime of
+	// projected service account tokens
+	ServiceAccountTokenExpirationSeconds int64 `json:"serviceAccountTokenExpirationSeconds"`
+
+	// ServiceAccountTokenSecrets can be used to restrict the creation of
+	// long-lived service account token secrets
+	ServiceAccountTokenSecrets string `json:"serviceAccountTokenSecrets"`
+
+	// ServiceAccountTokenSecretCreators lists the users and groups which
+	// may create service account token secrets (';'-separated list)
+	ServiceAccountTokenSecretCreators string `json:"serviceAccountTokenSecretCreators"`
+
 	// SeccompProfile can be used to set a default seccomp profile
 	SeccompProfile string `json:"seccompProfile"`
 
+	// AllowedSeccompProfiles can be used to restrict the seccomp profiles
+	// of pods and containers (';'-separated list, e.g. 'localhost/*')
+	AllowedSeccompProfiles string `json:"allowedSeccompProfiles"`
+
+	// AppArmorProfile can be used to set a default AppArmor profile for
+	// containers
+	AppArmorProfile string `json:"appArmorProfile"`
+
+	// AllowedAppArmorProfiles can be used to restrict the AppArmor profiles
+	// of containers (';'-separated list, e.g. 'localhost/*')
+	AllowedAppArmorProfiles string `json:"allowedAppArmorProfiles"`
+
 	// NetworkPolicies can be used to set default network policies
 	NetworkPolicies string `json:"networkPolicies"`
 
 	// PodSecurityContext can be used to set a pod security context
 	PodSecurityContext string `json:"podSecurityContext"`
+
+	// PodSecurityContextProfiles can be used to define named pod security
+	// contexts which can be referenced by PodSecurityContext
+	PodSecurityContextProfiles []PodSecurityContextProfile `json:"podSecurityContextProfiles,omitempty"`
+
+	// ImageRegistries can be used to restrict the registries pod images
+	// are pulled from (';'-separated list)
+	ImageRegistries string `json:"imageRegistries"`
+
+	// ImageTagPolicy can be used to reject mutable image tags or to pin
+	// image tags to digests
+	ImageTagPolicy string `json:"imageTagPolicy"`
+
+	// PodSecurityStandard can be used to enforce a Kubernetes Pod Security
+	// Standards level ('baseline' or 'restricted')
+	PodSecurityStandard string `json:"podSecurityStandard"`
+
+	// ContainerSecurityContext can be used to default or enforce a read-only
+	// root filesystem and non-root users for containers
+	ContainerSecurityContext string `json:"containerSecurityContext"`
+
+	// Capabilities can be used to drop all Linux capabilities of containers
+	// by default and to restrict the capabilities which may be added
+	Capabilities string `json:"capabilities"`
+
+	// HostIsolation can be used to restrict privileged containers and the
+	// usage of host namespaces and ports
+	HostIsolation string `json:"hostIsolation"`
+
+	// HostPathVolumes can be used to restrict the host paths pods are
+	// allowed to mount (';'-separated list of path prefixes)
+	HostPathVolumes string `json:"hostPathVolumes"`
+
+	// Sysctls can be used to restrict the sysctls of pods to the safe
+	// sysctls and additionally allowed ones (';'-separated list) and to
+	// reject non-default /proc mount types
+	Sysctls string `json:"sysctls"`
+
+	// RuntimeClass can be used to require a runtime class for the pods of
+	// namespaces (';'-separated list of '<namespace>=<runtime class>')
+	RuntimeClass string `json:"runtimeClass"`
+
+	// Resources can be used to default the resource requests and limits of
+	// containers with a profile or to reject containers without limits
+	Resources string `json:"resources"`
+
+	// ResourceProfiles can be used to define named resource requests and
+	// limits which can be referenced by Resources
+	ResourceProfiles []ResourceProfile `json:"resourceProfiles,omitempty"`
+
+	// NodePlacement can be used to pin the pods of namespaces to nodes with
+	// a profile (';'-separated list of '<namespace>=<profile>')
+	NodePlacement string `json:"nodePlacement"`
+
+	// NodePlacementProfiles can be used to define named node selectors,
+	// node affinities and allowed tolerations which can be referenced by
+	// NodePlacement
+	NodePlacementProfiles []NodePlacementProfile `json:"nodePlacementProfiles,omitempty"`
+
+	// ServiceTypes can be used to restrict the types of services
+	// (';'-separated list, e.g. 'ClusterIP;LoadBalancer')
+	ServiceTypes string `json:"serviceTypes"`
+
+	// ServiceExternalIPs can be used to deny external IPs of services
+	ServiceExternalIPs string `json:"serviceExternalIPs"`
+
+	// InternalLoadBalancer can be used to force internal load balancers of
+	// the given cloud provider for services
+	InternalLoadBalancer string `json:"internalLoadBalancer"`
+}
+
+type PodSecurityContextProfile struct {
+	// Name is used to reference the profile
+	Name string `json:"name"`
+
+	RunAsUser          *int64          `json:"runAsUser,omitempty"`
+	RunAsGroup         *int64          `json:"runAsGroup,omitempty"`
+	RunAsNonRoot       *bool           `json:"runAsNonRoot,omitempty"`
+	FSGroup            *int64          `json:"fsGroup,omitempty"`
+	SupplementalGroups []int64         `json:"supplementalGroups,omitempty"`
+	Sysctls            []corev1.Sysctl `json:"sysctls,omitempty"`
+}
+
+type ResourceProfile struct {
+	// Name is used to reference the profile
+	Name string `json:"name"`
+
+	Requests corev1.ResourceList `json:"requests,omitempty"`
+	Limits   corev1.ResourceList `json:"limits,omitempty"`
+}
+
+type NodePlacementProfile struct {
+	// Name is used to reference the profile
+	Name string `json:"name"`
+
+	// NodeSelector is merged into the node selector of pods
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// NodeAffinity is added to all required node affinity terms of pods
+	NodeAffinity []corev1.NodeSelectorRequirement `json:"nodeAffinity,omitempty"`
+	// Tolerations are the tolerations pods are allowed to specify
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
 }
 
 type KarydiaConfigStatus struct {
@@ -84,3 +218,42 @@ type KarydiaNetworkPolicyList struct {
 
 	Items []KarydiaNetworkPolicy `json:"items"`
 }
+
+// +genclient
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+type KarydiaSeccompProfile struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   KarydiaSeccompProfileSpec   `json:"spec"`
+	Status KarydiaSeccompProfileStatus `json:"status,omitempty"`
+}
+
+type KarydiaSeccompProfileSpec struct {
+	// Profile is the seccomp profile in the JSON format of the container
+	// runtime, e.g. '{"defaultAction": "SCMP_ACT_ERRNO", ...}'
+	Profile string `json:"profile"`
+}
+
+type KarydiaSeccompProfileStatus struct {
+	// Nodes holds the sync status of the profile per node
+	Nodes []KarydiaSeccompProfileNodeStatus `json:"nodes,omitempty"`
+}
+
+type KarydiaSeccompProfileNodeStatus struct {
+	Node         string      `json:"node"`
+	Synced       bool        `json:"synced"`
+	Message      string      `json:"message,omitempty"`
+	LastSyncTime metav1.Time `json:"lastSyncTime,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+type KarydiaSeccompProfileList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []KarydiaSeccompProfile `json:"items"`
+}
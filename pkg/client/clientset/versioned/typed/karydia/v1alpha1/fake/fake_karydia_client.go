@@ -36,6 +36,10 @@ func (c *FakeKarydiaV1alpha1) KarydiaNetworkPolicies() v1alpha1.KarydiaNetworkPo
 	return &FakeKarydiaNetworkPolicies{c}
 }
 
+func (c *FakeKarydiaV1alpha1) KarydiaSeccompProfiles() v1alpha1.KarydiaSeccompProfileInterface {
+	return &FakeKarydiaSeccompProfiles{c}
+}
+
 // RESTClient returns a RESTClient that is used to communicate
 // with API server by this client implementation.
 func (c *FakeKarydiaV1alpha1) RESTClient() rest.Interface {
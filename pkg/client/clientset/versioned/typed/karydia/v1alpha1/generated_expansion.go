@@ -21,3 +21,5 @@ package v1alpha1
 type KarydiaConfigExpansion interface{}
 
 type KarydiaNetworkPolicyExpansion interface{}
+
+type KarydiaSeccompProfileExpansion interface{}
@@ -28,6 +28,7 @@ type KarydiaV1alpha1Interface interface {
 	RESTClient() rest.Interface
 	KarydiaConfigsGetter
 	KarydiaNetworkPoliciesGetter
+	KarydiaSeccompProfilesGetter
 }
 
 // KarydiaV1alpha1Client is used to interact with features provided by the karydia.gardener.cloud group.
@@ -43,6 +44,10 @@ func (c *KarydiaV1alpha1Client) KarydiaNetworkPolicies() KarydiaNetworkPolicyInt
 	return newKarydiaNetworkPolicies(c)
 }
 
+func (c *KarydiaV1alpha1Client) KarydiaSeccompProfiles() KarydiaSeccompProfileInterface {
+	return newKarydiaSeccompProfiles(c)
+}
+
 // NewForConfig creates a new KarydiaV1alpha1Client for the given config.
 func NewForConfig(c *rest.Config) (*KarydiaV1alpha1Client, error) {
 	config := *c
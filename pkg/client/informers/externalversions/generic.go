@@ -57,6 +57,8 @@ func (f *sharedInformerFactory) ForResource(resource schema.GroupVersionResource
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Karydia().V1alpha1().KarydiaConfigs().Informer()}, nil
 	case v1alpha1.SchemeGroupVersion.WithResource("karydianetworkpolicies"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Karydia().V1alpha1().KarydiaNetworkPolicies().Informer()}, nil
+	case v1alpha1.SchemeGroupVersion.WithResource("karydiaseccompprofiles"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Karydia().V1alpha1().KarydiaSeccompProfiles().Informer()}, nil
 
 	}
 
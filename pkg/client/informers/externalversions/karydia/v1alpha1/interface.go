@@ -28,6 +28,8 @@ type Interface interface {
 	KarydiaConfigs() KarydiaConfigInformer
 	// KarydiaNetworkPolicies returns a KarydiaNetworkPolicyInformer.
 	KarydiaNetworkPolicies() KarydiaNetworkPolicyInformer
+	// KarydiaSeccompProfiles returns a KarydiaSeccompProfileInformer.
+	KarydiaSeccompProfiles() KarydiaSeccompProfileInformer
 }
 
 type version struct {
@@ -50,3 +52,8 @@ func (v *version) KarydiaConfigs() KarydiaConfigInformer {
 func (v *version) KarydiaNetworkPolicies() KarydiaNetworkPolicyInformer {
 	return &karydiaNetworkPolicyInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
 }
+
+// KarydiaSeccompProfiles returns a KarydiaSeccompProfileInformer.
+func (v *version) KarydiaSeccompProfiles() KarydiaSeccompProfileInformer {
+	return &karydiaSeccompProfileInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
+}
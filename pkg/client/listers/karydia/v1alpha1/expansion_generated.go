@@ -25,3 +25,7 @@ type KarydiaConfigListerExpansion interface{}
 // KarydiaNetworkPolicyListerExpansion allows custom methods to be added to
 // KarydiaNetworkPolicyLister.
 type KarydiaNetworkPolicyListerExpansion interface{}
+
+// KarydiaSeccompProfileListerExpansion allows custom methods to be added to
+// KarydiaSeccompProfileLister.
+type KarydiaSeccompProfileListerExpansion interface{}
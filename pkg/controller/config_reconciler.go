@@ -259,9 +259,40 @@ func (reconciler *ConfigReconciler) UpdateConfig(karydiaConfig v1alpha1.KarydiaC
 	reconciler.log.Infoln("KarydiaConfig Name:", karydiaConfig.Name)
 	reconciler.log.Infoln("KarydiaConfig Enforcement:", karydiaConfig.Spec.Enforcement)
 	reconciler.log.Infoln("KarydiaConfig AutomountServiceAccountToken:", karydiaConfig.Spec.AutomountServiceAccountToken)
+	reconciler.log.Infoln("KarydiaConfig ServiceAccountTokenProjection:", karydiaConfig.Spec.ServiceAccountTokenProjection)
+	reconciler.log.Infoln("KarydiaConfig ServiceAccountTokenAudience:", karydiaConfig.Spec.ServiceAccountTokenAudience)
+	reconciler.log.Infoln("KarydiaConfig ServiceAccountTokenExpirationSeconds:", karydiaConfig.Spec.ServiceAccountTokenExpirationSeconds)
+	reconciler.log.Infoln("KarydiaConfig ServiceAccountTokenSecrets:", karydiaConfig.Spec.ServiceAccountTokenSecrets)
+	reconciler.log.Infoln("KarydiaConfig ServiceAccountTokenSecretCreators:", karydiaConfig.Spec.ServiceAccountTokenSecretCreators)
 	reconciler.log.Infoln("KarydiaConfig SeccompProfile:", karydiaConfig.Spec.SeccompProfile)
+	reconciler.log.Infoln("KarydiaConfig AllowedSeccompProfiles:", karydiaConfig.Spec.AllowedSeccompProfiles)
+	reconciler.log.Infoln("KarydiaConfig AppArmorProfile:", karydiaConfig.Spec.AppArmorProfile)
+	reconciler.log.Infoln("KarydiaConfig AllowedAppArmorProfiles:", karydiaConfig.Spec.AllowedAppArmorProfiles)
 	reconciler.log.Infoln("KarydiaConfig NetworkPolicies:", karydiaConfig.Spec.NetworkPolicies)
 	reconciler.log.Infoln("KarydiaConfig PodSecurityContext:", karydiaConfig.Spec.PodSecurityContext)
+	for _, profile := range karydiaConfig.Spec.PodSecurityContextProfiles {
+		reconciler.log.Infoln("KarydiaConfig PodSecurityContextProfile:", profile.Name)
+	}
+	reconciler.log.Infoln("KarydiaConfig ImageRegistries:", karydiaConfig.Spec.ImageRegistries)
+	reconciler.log.Infoln("KarydiaConfig ImageTagPolicy:", karydiaConfig.Spec.ImageTagPolicy)
+	reconciler.log.Infoln("KarydiaConfig PodSecurityStandard:", karydiaConfig.Spec.PodSecurityStandard)
+	reconciler.log.Infoln("KarydiaConfig ContainerSecurityContext:", karydiaConfig.Spec.ContainerSecurityContext)
+	reconciler.log.Infoln("KarydiaConfig Capabilities:", karydiaConfig.Spec.Capabilities)
+	reconciler.log.Infoln("KarydiaConfig HostIsolation:", karydiaConfig.Spec.HostIsolation)
+	reconciler.log.Infoln("KarydiaConfig HostPathVolumes:", karydiaConfig.Spec.HostPathVolumes)
+	reconciler.log.Infoln("KarydiaConfig Sysctls:", karydiaConfig.Spec.Sysctls)
+	reconciler.log.Infoln("KarydiaConfig RuntimeClass:", karydiaConfig.Spec.RuntimeClass)
+	reconciler.log.Infoln("KarydiaConfig Resources:", karydiaConfig.Spec.Resources)
+	for _, profile := range karydiaConfig.Spec.ResourceProfiles {
+		reconciler.log.Infoln("KarydiaConfig ResourceProfile:", profile.Name)
+	}
+	reconciler.log.Infoln("KarydiaConfig NodePlacement:", karydiaConfig.Spec.NodePlacement)
+	for _, profile := range karydiaConfig.Spec.NodePlacementProfiles {
+		reconciler.log.Infoln("KarydiaConfig NodePlacementProfile:", profile.Name)
+	}
+	reconciler.log.Infoln("KarydiaConfig ServiceTypes:", karydiaConfig.Spec.ServiceTypes)
+	reconciler.log.Infoln("KarydiaConfig ServiceExternalIPs:", karydiaConfig.Spec.ServiceExternalIPs)
+	reconciler.log.Infoln("KarydiaConfig InternalLoadBalancer:", karydiaConfig.Spec.InternalLoadBalancer)
 	return nil
 }
 
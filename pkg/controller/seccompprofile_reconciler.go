@@ -0,0 +1,269 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/karydia/karydia/pkg/apis/karydia/v1alpha1"
+	"github.com/karydia/karydia/pkg/client/clientset/versioned"
+	v1alpha12 "github.com/karydia/karydia/pkg/client/informers/externalversions/karydia/v1alpha1"
+	v1alpha13 "github.com/karydia/karydia/pkg/client/listers/karydia/v1alpha1"
+	"github.com/karydia/karydia/pkg/logger"
+	"github.com/karydia/karydia/pkg/util/seccomp"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// SeccompProfileReconciler runs on every node and writes the profiles of all
+// KarydiaSeccompProfile resources into the profile directory of the node, so
+// they can be referenced as 'localhost/karydia/<name>'. Profiles of deleted
+// resources are removed. The sync status of each node is reported in the
+// status of the resource.
+type SeccompProfileReconciler struct {
+	log      *logger.Logger
+	nodeName string
+	dir      string
+
+	// clientset for own API group
+	clientset versioned.Interface
+	lister    v1alpha13.KarydiaSeccompProfileLister
+	synced    cache.InformerSynced
+	workqueue workqueue.RateLimitingInterface
+}
+
+func NewSeccompProfileReconciler(
+	nodeName string,
+	rootDir string,
+	karydiaClientset versioned.Interface,
+	seccompProfileInformer v1alpha12.KarydiaSeccompProfileInformer,
+) *SeccompProfileReconciler {
+	reconciler := &SeccompProfileReconciler{
+		log:       logger.NewComponentLogger(logger.GetCallersFilename()),
+		nodeName:  nodeName,
+		dir:       filepath.Join(rootDir, seccomp.ProfileDir),
+		clientset: karydiaClientset,
+		lister:    seccompProfileInformer.Lister(),
+		synced:    seccompProfileInformer.Informer().HasSynced,
+		workqueue: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "SeccompProfiles"),
+	}
+
+	reconciler.log.Infoln("Setting up event handler")
+	seccompProfileInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: reconciler.enqueueSeccompProfile,
+		UpdateFunc: func(old, new interface{}) {
+			newProfile := new.(*v1alpha1.KarydiaSeccompProfile)
+			oldProfile := old.(*v1alpha1.KarydiaSeccompProfile)
+			if newProfile.ResourceVersion == oldProfile.ResourceVersion {
+				return
+			}
+			reconciler.enqueueSeccompProfile(new)
+		},
+		DeleteFunc: reconciler.enqueueSeccompProfile,
+	})
+
+	return reconciler
+}
+
+func (reconciler *SeccompProfileReconciler) Run(threadiness int, stopCh <-chan struct{}) error {
+	defer reconciler.log.HandleCrash()
+	defer reconciler.workqueue.ShutDown()
+
+	reconciler.log.Infoln("Starting karydia seccomp profile reconciler")
+
+	if err := os.MkdirAll(reconciler.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create profile directory: %v", err)
+	}
+
+	reconciler.log.Infoln("Waiting for informer cache to sync")
+	if ok := cache.WaitForCacheSync(stopCh, reconciler.synced); !ok {
+		return fmt.Errorf("failed to wait for cache to sync")
+	}
+
+	// profiles of resources deleted while the reconciler was not running
+	// are not covered by delete events
+	if err := reconciler.removeOrphanedProfiles(); err != nil {
+		reconciler.log.Errorln("failed to remove orphaned profiles:", err)
+	}
+
+	reconciler.log.Infoln("Starting workers")
+	for i := 0; i < threadiness; i++ {
+		go wait.Until(reconciler.runSeccompProfileWorker, time.Second, stopCh)
+	}
+
+	reconciler.log.Infoln("Started workers")
+	<-stopCh
+	reconciler.log.Infoln("Shutting down workers")
+
+	return nil
+}
+
+func (reconciler *SeccompProfileReconciler) runSeccompProfileWorker() {
+	for reconciler.processNextSeccompProfileWorkItem() {
+	}
+}
+
+func (reconciler *SeccompProfileReconciler) processNextSeccompProfileWorkItem() bool {
+	obj, shutdown := reconciler.workqueue.Get()
+
+	if shutdown {
+		return false
+	}
+
+	err := func(obj interface{}) error {
+		defer reconciler.workqueue.Done(obj)
+		var key string
+		var ok bool
+
+		if key, ok = obj.(string); !ok {
+			reconciler.workqueue.Forget(obj)
+			reconciler.log.Errorf("expected string in workqueue but got %#v", obj)
+			return nil
+		}
+
+		if err := reconciler.syncSeccompProfileHandler(key); err != nil {
+			reconciler.workqueue.AddRateLimited(key)
+			return fmt.Errorf("error syncing '%s': %s, requeuing", key, err.Error())
+		}
+
+		reconciler.workqueue.Forget(obj)
+		return nil
+	}(obj)
+
+	if err != nil {
+		reconciler.log.Errorln(err)
+		return true
+	}
+
+	return true
+}
+
+func (reconciler *SeccompProfileReconciler) syncSeccompProfileHandler(key string) error {
+	_, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		reconciler.log.Errorln("invalid resource key:", key)
+		return nil
+	}
+
+	path := filepath.Join(reconciler.dir, name)
+	profile, err := reconciler.lister.Get(name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			reconciler.log.Infof("seccomp profile '%s' no longer exists, removing '%s'", name, path)
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			return nil
+		}
+		return err
+	}
+
+	if _, err := seccomp.Parse([]byte(profile.Spec.Profile)); err != nil {
+		reconciler.log.Warnf("seccomp profile '%s' is invalid: %v", name, err)
+		return reconciler.updateNodeStatus(name, false, fmt.Sprintf("invalid profile: %v", err))
+	}
+
+	data := []byte(profile.Spec.Profile)
+	if current, err := ioutil.ReadFile(path); err != nil || !bytes.Equal(current, data) {
+		if err := seccomp.WriteFileAtomic(path, data, 0644); err != nil {
+			reconciler.log.Errorf("failed to write seccomp profile '%s': %v", path, err)
+			if err := reconciler.updateNodeStatus(name, false, fmt.Sprintf("failed to write profile: %v", err)); err != nil {
+				reconciler.log.Errorln("failed to update status:", err)
+			}
+			return err
+		}
+		reconciler.log.Infof("Wrote seccomp profile '%s'", path)
+	}
+
+	return reconciler.updateNodeStatus(name, true, "")
+}
+
+// updateNodeStatus sets the sync status of the node in the status of the
+// profile. The status is only updated if it changed, as every update
+// triggers another sync.
+func (reconciler *SeccompProfileReconciler) updateNodeStatus(name string, synced bool, message string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		profile, err := reconciler.clientset.KarydiaV1alpha1().KarydiaSeccompProfiles().Get(name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		nodeStatus := v1alpha1.KarydiaSeccompProfileNodeStatus{
+			Node:         reconciler.nodeName,
+			Synced:       synced,
+			Message:      message,
+			LastSyncTime: metav1.Now(),
+		}
+		found := false
+		for i, s := range profile.Status.Nodes {
+			if s.Node != reconciler.nodeName {
+				continue
+			}
+			if s.Synced == synced && s.Message == message {
+				return nil
+			}
+			profile.Status.Nodes[i] = nodeStatus
+			found = true
+		}
+		if !found {
+			profile.Status.Nodes = append(profile.Status.Nodes, nodeStatus)
+		}
+		_, err = reconciler.clientset.KarydiaV1alpha1().KarydiaSeccompProfiles().UpdateStatus(profile)
+		return err
+	})
+}
+
+// removeOrphanedProfiles removes all profiles from the profile directory which
+// do not belong to a KarydiaSeccompProfile
+func (reconciler *SeccompProfileReconciler) removeOrphanedProfiles() error {
+	files, err := ioutil.ReadDir(reconciler.dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		if _, err := reconciler.lister.Get(file.Name()); errors.IsNotFound(err) {
+			path := filepath.Join(reconciler.dir, file.Name())
+			reconciler.log.Infof("Removing orphaned seccomp profile '%s'", path)
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (reconciler *SeccompProfileReconciler) enqueueSeccompProfile(obj interface{}) {
+	var key string
+	var err error
+	if key, err = cache.DeletionHandlingMetaNamespaceKeyFunc(obj); err != nil {
+		reconciler.log.Errorln(err)
+		return
+	}
+	reconciler.workqueue.Add(key)
+}
@@ -0,0 +1,116 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/karydia/karydia/pkg/apis/karydia/v1alpha1"
+	"github.com/karydia/karydia/pkg/client/clientset/versioned/fake"
+	"github.com/karydia/karydia/pkg/client/informers/externalversions"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const testSeccompProfile = `{"defaultAction": "SCMP_ACT_ERRNO", "syscalls": [{"names": ["read", "write"], "action": "SCMP_ACT_ALLOW"}]}`
+
+func newTestSeccompProfile(name, profile string) *v1alpha1.KarydiaSeccompProfile {
+	return &v1alpha1.KarydiaSeccompProfile{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       v1alpha1.KarydiaSeccompProfileSpec{Profile: profile},
+	}
+}
+
+func newTestSeccompProfileReconciler(t *testing.T, profiles ...*v1alpha1.KarydiaSeccompProfile) (*SeccompProfileReconciler, *fake.Clientset, string) {
+	rootDir, err := ioutil.TempDir("", "seccomp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientset := fake.NewSimpleClientset()
+	informer := externalversions.NewSharedInformerFactory(clientset, noResyncPeriodFunc()).Karydia().V1alpha1().KarydiaSeccompProfiles()
+	for _, profile := range profiles {
+		clientset.KarydiaV1alpha1().KarydiaSeccompProfiles().Create(profile)
+		informer.Informer().GetIndexer().Add(profile)
+	}
+	reconciler := NewSeccompProfileReconciler("node-1", rootDir, clientset, informer)
+	if err := os.MkdirAll(reconciler.dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	return reconciler, clientset, rootDir
+}
+
+func TestSeccompProfileReconcilerWritesProfile(t *testing.T) {
+	assert := assert.New(t)
+	reconciler, clientset, rootDir := newTestSeccompProfileReconciler(t, newTestSeccompProfile("my-profile", testSeccompProfile))
+	defer os.RemoveAll(rootDir)
+
+	assert.NoError(reconciler.syncSeccompProfileHandler("my-profile"))
+
+	data, err := ioutil.ReadFile(filepath.Join(rootDir, "karydia", "my-profile"))
+	assert.NoError(err)
+	assert.Equal(testSeccompProfile, string(data))
+
+	profile, err := clientset.KarydiaV1alpha1().KarydiaSeccompProfiles().Get("my-profile", metav1.GetOptions{})
+	assert.NoError(err)
+	if assert.Len(profile.Status.Nodes, 1) {
+		assert.Equal("node-1", profile.Status.Nodes[0].Node)
+		assert.True(profile.Status.Nodes[0].Synced)
+	}
+}
+
+func TestSeccompProfileReconcilerRejectsInvalidProfile(t *testing.T) {
+	assert := assert.New(t)
+	reconciler, clientset, rootDir := newTestSeccompProfileReconciler(t, newTestSeccompProfile("invalid", `{"defaultAction": "SCMP_ACT_MAYBE"}`))
+	defer os.RemoveAll(rootDir)
+
+	assert.NoError(reconciler.syncSeccompProfileHandler("invalid"))
+
+	_, err := os.Stat(filepath.Join(rootDir, "karydia", "invalid"))
+	assert.True(os.IsNotExist(err))
+
+	profile, err := clientset.KarydiaV1alpha1().KarydiaSeccompProfiles().Get("invalid", metav1.GetOptions{})
+	assert.NoError(err)
+	if assert.Len(profile.Status.Nodes, 1) {
+		assert.False(profile.Status.Nodes[0].Synced)
+		assert.Contains(profile.Status.Nodes[0].Message, "SCMP_ACT_MAYBE")
+	}
+}
+
+func TestSeccompProfileReconcilerRemovesProfiles(t *testing.T) {
+	assert := assert.New(t)
+	reconciler, _, rootDir := newTestSeccompProfileReconciler(t, newTestSeccompProfile("my-profile", testSeccompProfile))
+	defer os.RemoveAll(rootDir)
+
+	for _, name := range []string{"my-profile", "deleted", "orphaned"} {
+		assert.NoError(ioutil.WriteFile(filepath.Join(rootDir, "karydia", name), []byte(testSeccompProfile), 0644))
+	}
+
+	// delete event
+	assert.NoError(reconciler.syncSeccompProfileHandler("deleted"))
+	_, err := os.Stat(filepath.Join(rootDir, "karydia", "deleted"))
+	assert.True(os.IsNotExist(err))
+
+	// deleted while the reconciler was not running
+	assert.NoError(reconciler.removeOrphanedProfiles())
+	_, err = os.Stat(filepath.Join(rootDir, "karydia", "orphaned"))
+	assert.True(os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(rootDir, "karydia", "my-profile"))
+	assert.NoError(err)
+}
@@ -0,0 +1,313 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/karydia/karydia/pkg/apis/karydia/v1alpha1"
+	"github.com/karydia/karydia/pkg/logger"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	coreInformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	kubelistersv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const automountServiceAccountTokenAnnotation = "karydia.gardener.cloud/automountServiceAccountToken"
+
+// ServiceAccountReconciler applies the 'automountServiceAccountToken' setting
+// to existing service accounts, which the admission only does for created or
+// updated ones. Config changes trigger a re-evaluation of all service
+// accounts. In dry-run mode the service accounts are only reported.
+// Namespaces are excluded by name or by matching one of the exclude label
+// selectors.
+type ServiceAccountReconciler struct {
+	log              *logger.Logger
+	dryRun           bool
+	excludes         []string
+	excludeSelectors []labels.Selector
+
+	mutex                        sync.RWMutex
+	enforcement                  bool
+	automountServiceAccountToken string
+
+	kubeclientset           kubernetes.Interface
+	serviceAccountsLister   kubelistersv1.ServiceAccountLister
+	serviceAccountsSynced   cache.InformerSynced
+	namespacesLister        kubelistersv1.NamespaceLister
+	namespacesSynced        cache.InformerSynced
+	serviceAccountWorkqueue workqueue.RateLimitingInterface
+}
+
+func NewServiceAccountReconciler(
+	kubeclientset kubernetes.Interface,
+	serviceAccountInformer coreInformers.ServiceAccountInformer, namespaceInformer coreInformers.NamespaceInformer,
+	karydiaConfig v1alpha1.KarydiaConfig, excludes []string, excludeSelectors []labels.Selector, dryRun bool) *ServiceAccountReconciler {
+
+	reconciler := &ServiceAccountReconciler{
+		log:                          logger.NewComponentLogger(logger.GetCallersFilename()),
+		dryRun:                       dryRun,
+		excludes:                     excludes,
+		excludeSelectors:             excludeSelectors,
+		enforcement:                  karydiaConfig.Spec.Enforcement,
+		automountServiceAccountToken: karydiaConfig.Spec.AutomountServiceAccountToken,
+		kubeclientset:                kubeclientset,
+		serviceAccountsLister:        serviceAccountInformer.Lister(),
+		serviceAccountsSynced:        serviceAccountInformer.Informer().HasSynced,
+		namespacesLister:             namespaceInformer.Lister(),
+		namespacesSynced:             namespaceInformer.Informer().HasSynced,
+		serviceAccountWorkqueue:      workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ServiceAccounts"),
+	}
+
+	reconciler.log.Infoln("Setting up event handlers")
+	serviceAccountInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: reconciler.enqueueServiceAccount,
+		UpdateFunc: func(old, new interface{}) {
+			newServiceAccount := new.(*corev1.ServiceAccount)
+			oldServiceAccount := old.(*corev1.ServiceAccount)
+			if newServiceAccount.ResourceVersion == oldServiceAccount.ResourceVersion {
+				return
+			}
+			reconciler.enqueueServiceAccount(new)
+		},
+	})
+
+	namespaceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(old, new interface{}) {
+			newNamespace := new.(*corev1.Namespace)
+			oldNamespace := old.(*corev1.Namespace)
+			if newNamespace.Annotations[automountServiceAccountTokenAnnotation] == oldNamespace.Annotations[automountServiceAccountTokenAnnotation] &&
+				labels.Equals(newNamespace.Labels, oldNamespace.Labels) {
+				return
+			}
+			reconciler.enqueueNamespaceServiceAccounts(newNamespace.Name)
+		},
+	})
+
+	return reconciler
+}
+
+// UpdateConfig triggers a re-evaluation of all service accounts if the
+// 'automountServiceAccountToken' setting changed
+func (reconciler *ServiceAccountReconciler) UpdateConfig(karydiaConfig v1alpha1.KarydiaConfig) error {
+	reconciler.mutex.Lock()
+	changed := reconciler.enforcement != karydiaConfig.Spec.Enforcement || reconciler.automountServiceAccountToken != karydiaConfig.Spec.AutomountServiceAccountToken
+	reconciler.enforcement = karydiaConfig.Spec.Enforcement
+	reconciler.automountServiceAccountToken = karydiaConfig.Spec.AutomountServiceAccountToken
+	reconciler.mutex.Unlock()
+
+	if changed {
+		reconciler.enqueueNamespaceServiceAccounts("")
+	}
+	return nil
+}
+
+func (reconciler *ServiceAccountReconciler) Run(threadiness int, stopCh <-chan struct{}) error {
+	defer reconciler.log.HandleCrash()
+	defer reconciler.serviceAccountWorkqueue.ShutDown()
+
+	reconciler.log.Infoln("Starting karydia service account reconciler")
+	reconciler.log.Infoln("Waiting for informer caches to sync")
+	if ok := cache.WaitForCacheSync(stopCh, reconciler.serviceAccountsSynced, reconciler.namespacesSynced); !ok {
+		return fmt.Errorf("failed to wait for caches to sync")
+	}
+
+	reconciler.log.Infoln("Starting workers")
+	for i := 0; i < threadiness; i++ {
+		go wait.Until(reconciler.runServiceAccountWorker, time.Second, stopCh)
+	}
+
+	reconciler.log.Infoln("Started workers")
+	<-stopCh
+	reconciler.log.Infoln("Shutting down workers")
+
+	return nil
+}
+
+func (reconciler *ServiceAccountReconciler) runServiceAccountWorker() {
+	for reconciler.processNextServiceAccountWorkItem() {
+	}
+}
+
+func (reconciler *ServiceAccountReconciler) processNextServiceAccountWorkItem() bool {
+	obj, shutdown := reconciler.serviceAccountWorkqueue.Get()
+
+	if shutdown {
+		return false
+	}
+
+	err := func(obj interface{}) error {
+		defer reconciler.serviceAccountWorkqueue.Done(obj)
+		var key string
+		var ok bool
+
+		if key, ok = obj.(string); !ok {
+			reconciler.serviceAccountWorkqueue.Forget(obj)
+			reconciler.log.Errorf("expected string in workqueue but got %#v", obj)
+			return nil
+		}
+
+		if err := reconciler.syncServiceAccountHandler(key); err != nil {
+			reconciler.serviceAccountWorkqueue.AddRateLimited(key)
+			return fmt.Errorf("error syncing '%s': %s, requeuing", key, err.Error())
+		}
+
+		reconciler.serviceAccountWorkqueue.Forget(obj)
+		return nil
+	}(obj)
+
+	if err != nil {
+		reconciler.log.Errorln(err)
+		return true
+	}
+
+	return true
+}
+
+func (reconciler *ServiceAccountReconciler) syncServiceAccountHandler(key string) error {
+	namespaceName, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		reconciler.log.Errorln("invalid resource key:", key)
+		return nil
+	}
+
+	if stringInSlice(namespaceName, reconciler.excludes) {
+		return nil
+	}
+
+	sAcc, err := reconciler.serviceAccountsLister.ServiceAccounts(namespaceName).Get(name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	namespace, err := reconciler.namespacesLister.Get(namespaceName)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if reconciler.namespaceExcluded(namespace) {
+		return nil
+	}
+
+	setting := reconciler.getAutomountServiceAccountTokenSetting(sAcc, namespace)
+	if !automountServiceAccountTokenRemediationNeeded(sAcc, setting) {
+		return nil
+	}
+
+	if reconciler.dryRun {
+		reconciler.log.Infof("Dry-run: would set automountServiceAccountToken of service account '%s' in namespace '%s' to false (%s/%s)", name, namespaceName, setting.src, setting.value)
+		return nil
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				automountServiceAccountTokenAnnotation + ".internal": setting.src + "/" + setting.value,
+			},
+		},
+		"automountServiceAccountToken": false,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := reconciler.kubeclientset.CoreV1().ServiceAccounts(namespaceName).Patch(name, types.MergePatchType, patch); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	reconciler.log.Infof("Set automountServiceAccountToken of service account '%s' in namespace '%s' to false (%s/%s)", name, namespaceName, setting.src, setting.value)
+	return nil
+}
+
+// namespaceExcluded reports whether the labels of the namespace match one of
+// the exclude label selectors, e.g. the 'exclusionNamespaceLabels' of the chart
+func (reconciler *ServiceAccountReconciler) namespaceExcluded(namespace *corev1.Namespace) bool {
+	for _, selector := range reconciler.excludeSelectors {
+		if selector.Matches(labels.Set(namespace.Labels)) {
+			return true
+		}
+	}
+	return false
+}
+
+// getAutomountServiceAccountTokenSetting resolves the setting the same way as
+// the admission: annotation of the service account, annotation of the
+// namespace, karydia config
+func (reconciler *ServiceAccountReconciler) getAutomountServiceAccountTokenSetting(sAcc *corev1.ServiceAccount, namespace *corev1.Namespace) Setting {
+	reconciler.mutex.RLock()
+	defer reconciler.mutex.RUnlock()
+	if namespace.Name == "kube-system" || !reconciler.enforcement {
+		if value, ok := sAcc.Annotations[automountServiceAccountTokenAnnotation]; ok {
+			return Setting{value: value, src: "serviceaccount"}
+		}
+		if value, ok := namespace.Annotations[automountServiceAccountTokenAnnotation]; ok {
+			return Setting{value: value, src: "namespace"}
+		}
+	}
+	return Setting{value: reconciler.automountServiceAccountToken, src: "config"}
+}
+
+func automountServiceAccountTokenRemediationNeeded(sAcc *corev1.ServiceAccount, setting Setting) bool {
+	if sAcc.AutomountServiceAccountToken != nil {
+		return false
+	}
+	switch setting.value {
+	case "change-default":
+		return sAcc.Name == "default"
+	case "change-all":
+		return true
+	}
+	return false
+}
+
+// enqueueNamespaceServiceAccounts enqueues all service accounts of the
+// namespace, or of all namespaces if the name is empty
+func (reconciler *ServiceAccountReconciler) enqueueNamespaceServiceAccounts(namespace string) {
+	serviceAccounts, err := reconciler.serviceAccountsLister.ServiceAccounts(namespace).List(labels.Everything())
+	if err != nil {
+		reconciler.log.Errorln("failed to list service accounts:", err)
+		return
+	}
+	for _, sAcc := range serviceAccounts {
+		reconciler.enqueueServiceAccount(sAcc)
+	}
+}
+
+func (reconciler *ServiceAccountReconciler) enqueueServiceAccount(obj interface{}) {
+	var key string
+	var err error
+	if key, err = cache.MetaNamespaceKeyFunc(obj); err != nil {
+		reconciler.log.Errorln(err)
+		return
+	}
+	reconciler.serviceAccountWorkqueue.Add(key)
+}
@@ -0,0 +1,210 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"testing"
+
+	"github.com/karydia/karydia/pkg/apis/karydia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+
+	coreV1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubeinformers "k8s.io/client-go/informers"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	core "k8s.io/client-go/testing"
+)
+
+func newServiceAccountReconciler(t *testing.T, setting string, enforcement bool, dryRun bool, objects ...runtime.Object) (*ServiceAccountReconciler, *k8sfake.Clientset) {
+	kubeclient := k8sfake.NewSimpleClientset(objects...)
+	kubeInformerFactory := kubeinformers.NewSharedInformerFactory(kubeclient, noResyncPeriodFunc())
+
+	config := v1alpha1.KarydiaConfig{
+		Spec: v1alpha1.KarydiaConfigSpec{
+			Enforcement:                  enforcement,
+			AutomountServiceAccountToken: setting,
+		},
+	}
+	reconciler := NewServiceAccountReconciler(kubeclient, kubeInformerFactory.Core().V1().ServiceAccounts(), kubeInformerFactory.Core().V1().Namespaces(), config, []string{"kube-system"}, []labels.Selector{labels.SelectorFromSet(labels.Set{"karydia.gardener.cloud/excludeFromKarydia": "true"})}, dryRun)
+	reconciler.serviceAccountsSynced = alwaysReady
+	reconciler.namespacesSynced = alwaysReady
+
+	for _, obj := range objects {
+		var err error
+		switch o := obj.(type) {
+		case *coreV1.ServiceAccount:
+			err = kubeInformerFactory.Core().V1().ServiceAccounts().Informer().GetIndexer().Add(o)
+		case *coreV1.Namespace:
+			err = kubeInformerFactory.Core().V1().Namespaces().Informer().GetIndexer().Add(o)
+		}
+		if err != nil {
+			t.Fatalf("failed to add object to indexer: %v", err)
+		}
+	}
+
+	return reconciler, kubeclient
+}
+
+func newServiceAccount(namespace, name string, automount *bool, annotations map[string]string) *coreV1.ServiceAccount {
+	return &coreV1.ServiceAccount{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:        name,
+			Namespace:   namespace,
+			Annotations: annotations,
+		},
+		AutomountServiceAccountToken: automount,
+	}
+}
+
+func newNamespace(name string, annotations map[string]string) *coreV1.Namespace {
+	return &coreV1.Namespace{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:        name,
+			Annotations: annotations,
+		},
+	}
+}
+
+func patchedServiceAccounts(kubeclient *k8sfake.Clientset) []string {
+	var patched []string
+	for _, action := range kubeclient.Actions() {
+		if patch, ok := action.(core.PatchAction); ok && patch.GetResource().Resource == "serviceaccounts" {
+			patched = append(patched, patch.GetNamespace()+"/"+patch.GetName())
+		}
+	}
+	return patched
+}
+
+func TestServiceAccountReconcilerChangeDefault(t *testing.T) {
+	var vTrue = true
+	reconciler, kubeclient := newServiceAccountReconciler(t, "change-default", true, false,
+		newNamespace("default", nil),
+		newNamespace("kube-system", nil),
+		newServiceAccount("default", "default", nil, nil),
+		newServiceAccount("default", "app", nil, nil),
+		newServiceAccount("kube-system", "default", nil, nil),
+	)
+
+	for _, key := range []string{"default/default", "default/app", "kube-system/default"} {
+		if err := reconciler.syncServiceAccountHandler(key); err != nil {
+			t.Fatalf("failed to sync '%s': %v", key, err)
+		}
+	}
+	assert.Equal(t, []string{"default/default"}, patchedServiceAccounts(kubeclient))
+
+	sAcc, err := kubeclient.CoreV1().ServiceAccounts("default").Get("default", meta_v1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, false, *sAcc.AutomountServiceAccountToken)
+	assert.Equal(t, "config/change-default", sAcc.Annotations["karydia.gardener.cloud/automountServiceAccountToken.internal"])
+
+	// explicitly defined values are never changed
+	reconciler, kubeclient = newServiceAccountReconciler(t, "change-all", true, false,
+		newNamespace("default", nil),
+		newServiceAccount("default", "default", &vTrue, nil),
+	)
+	if err := reconciler.syncServiceAccountHandler("default/default"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, patchedServiceAccounts(kubeclient))
+}
+
+func TestServiceAccountReconcilerChangeAll(t *testing.T) {
+	reconciler, kubeclient := newServiceAccountReconciler(t, "change-all", false, false,
+		newNamespace("default", nil),
+		newNamespace("annotated", map[string]string{"karydia.gardener.cloud/automountServiceAccountToken": "no-change"}),
+		newServiceAccount("default", "app", nil, nil),
+		newServiceAccount("default", "opt-out", nil, map[string]string{"karydia.gardener.cloud/automountServiceAccountToken": "no-change"}),
+		newServiceAccount("annotated", "app", nil, nil),
+		newServiceAccount("annotated", "opt-in", nil, map[string]string{"karydia.gardener.cloud/automountServiceAccountToken": "change-all"}),
+	)
+
+	for _, key := range []string{"default/app", "default/opt-out", "annotated/app", "annotated/opt-in"} {
+		if err := reconciler.syncServiceAccountHandler(key); err != nil {
+			t.Fatalf("failed to sync '%s': %v", key, err)
+		}
+	}
+	assert.Equal(t, []string{"default/app", "annotated/opt-in"}, patchedServiceAccounts(kubeclient))
+
+	sAcc, err := kubeclient.CoreV1().ServiceAccounts("annotated").Get("opt-in", meta_v1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "serviceaccount/change-all", sAcc.Annotations["karydia.gardener.cloud/automountServiceAccountToken.internal"])
+}
+
+func TestServiceAccountReconcilerExcludeLabels(t *testing.T) {
+	excluded := newNamespace("karydia", nil)
+	excluded.Labels = map[string]string{"karydia.gardener.cloud/excludeFromKarydia": "true"}
+	included := newNamespace("tenant", nil)
+	included.Labels = map[string]string{"karydia.gardener.cloud/excludeFromKarydia": "false"}
+
+	reconciler, kubeclient := newServiceAccountReconciler(t, "change-all", true, false,
+		excluded,
+		included,
+		newServiceAccount("karydia", "karydia", nil, nil),
+		newServiceAccount("tenant", "app", nil, nil),
+	)
+
+	for _, key := range []string{"karydia/karydia", "tenant/app"} {
+		if err := reconciler.syncServiceAccountHandler(key); err != nil {
+			t.Fatalf("failed to sync '%s': %v", key, err)
+		}
+	}
+	assert.Equal(t, []string{"tenant/app"}, patchedServiceAccounts(kubeclient))
+}
+
+func TestServiceAccountReconcilerDryRun(t *testing.T) {
+	reconciler, kubeclient := newServiceAccountReconciler(t, "change-all", true, true,
+		newNamespace("default", nil),
+		newServiceAccount("default", "default", nil, nil),
+	)
+
+	if err := reconciler.syncServiceAccountHandler("default/default"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, patchedServiceAccounts(kubeclient))
+}
+
+func TestServiceAccountReconcilerUpdateConfig(t *testing.T) {
+	reconciler, _ := newServiceAccountReconciler(t, "no-change", true, false,
+		newNamespace("default", nil),
+		newServiceAccount("default", "default", nil, nil),
+		newServiceAccount("default", "app", nil, nil),
+	)
+
+	config := v1alpha1.KarydiaConfig{
+		Spec: v1alpha1.KarydiaConfigSpec{
+			Enforcement:                  true,
+			AutomountServiceAccountToken: "no-change",
+		},
+	}
+	if err := reconciler.UpdateConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 0, reconciler.serviceAccountWorkqueue.Len(), "unchanged config must not trigger a re-evaluation")
+
+	config.Spec.AutomountServiceAccountToken = "change-all"
+	if err := reconciler.UpdateConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, reconciler.serviceAccountWorkqueue.Len())
+	assert.Equal(t, "change-all", reconciler.getAutomountServiceAccountTokenSetting(newServiceAccount("default", "app", nil, nil), newNamespace("default", nil)).value)
+}
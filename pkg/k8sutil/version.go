@@ -0,0 +1,44 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sutil
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/client-go/discovery"
+)
+
+// ServerVersionAtLeast reports whether the version of the API server is at
+// least major.minor. Provider specific suffixes of the minor version, e.g.
+// '19+', are ignored.
+func ServerVersionAtLeast(client discovery.ServerVersionInterface, major, minor int) (bool, error) {
+	info, err := client.ServerVersion()
+	if err != nil {
+		return false, fmt.Errorf("error getting server version: %v", err)
+	}
+	serverMajor, err := strconv.Atoi(info.Major)
+	if err != nil {
+		return false, fmt.Errorf("error parsing server major version '%s': %v", info.Major, err)
+	}
+	serverMinor, err := strconv.Atoi(strings.TrimRight(info.Minor, "+"))
+	if err != nil {
+		return false, fmt.Errorf("error parsing server minor version '%s': %v", info.Minor, err)
+	}
+	return serverMajor > major || serverMajor == major && serverMinor >= minor, nil
+}
@@ -0,0 +1,326 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package digest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resolver resolves a tagged image to the digest of its manifest, e.g.
+// ('docker.io', 'library/nginx', '1.17') to 'sha256:...'
+type Resolver interface {
+	Resolve(ctx context.Context, registry, repository, tag string) (string, error)
+}
+
+// FileResolver resolves digests from a JSON file which maps tagged images
+// to digests, e.g. {"docker.io/library/nginx:1.17": "sha256:..."}. The file
+// is reloaded if it changes. It is meant for offline clusters and tests.
+type FileResolver struct {
+	path string
+
+	mutex   sync.Mutex
+	modTime time.Time
+	digests map[string]string
+}
+
+func NewFileResolver(path string) (*FileResolver, error) {
+	resolver := &FileResolver{path: path}
+	if err := resolver.load(); err != nil {
+		return nil, err
+	}
+	return resolver, nil
+}
+
+func (r *FileResolver) Resolve(ctx context.Context, registry, repository, tag string) (string, error) {
+	if err := r.load(); err != nil {
+		return "", err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	image := registry + "/" + repository + ":" + tag
+	digest, ok := r.digests[image]
+	if !ok {
+		return "", fmt.Errorf("no digest found for image '%s' in '%s'", image, r.path)
+	}
+	return digest, nil
+}
+
+func (r *FileResolver) load() error {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return fmt.Errorf("failed to read digest file: %v", err)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.digests != nil && info.ModTime().Equal(r.modTime) {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(r.path)
+	if err != nil {
+		return fmt.Errorf("failed to read digest file: %v", err)
+	}
+	digests := make(map[string]string)
+	if err := json.Unmarshal(data, &digests); err != nil {
+		return fmt.Errorf("failed to parse digest file '%s': %v", r.path, err)
+	}
+	r.digests = digests
+	r.modTime = info.ModTime()
+	return nil
+}
+
+// dockerHubRegistry is the registry API endpoint of 'docker.io'
+const dockerHubRegistry = "registry-1.docker.io"
+
+// manifestMediaTypes are accepted when requesting a manifest, manifest lists
+// first so that the digest is independent of the node's platform
+var manifestMediaTypes = []string{
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+}
+
+// maxCachedDigests bounds the number of digests cached by the RegistryResolver
+const maxCachedDigests = 1000
+
+// RegistryResolver resolves digests with the Docker Registry HTTP API V2.
+// Only anonymous (token) authentication is supported. Resolved digests are
+// cached for the given TTL, up to maxCachedDigests digests.
+type RegistryResolver struct {
+	Client *http.Client
+	TTL    time.Duration
+	// Registries are the only registries which are queried, as the
+	// registries are named by the admitted pods. A registry can be
+	// restricted to a repository prefix, e.g. 'gcr.io/my-project'.
+	Registries []string
+
+	mutex sync.Mutex
+	cache map[string]cachedDigest
+}
+
+type cachedDigest struct {
+	digest  string
+	expires time.Time
+}
+
+func NewRegistryResolver(timeout, ttl time.Duration, registries []string) *RegistryResolver {
+	return &RegistryResolver{
+		Client: &http.Client{
+			Timeout: timeout,
+			// redirects could point to any host
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		TTL:        ttl,
+		Registries: registries,
+	}
+}
+
+// registryAllowed reports whether the repository is located in one of the
+// registries of the resolver
+func (r *RegistryResolver) registryAllowed(registry, repository string) bool {
+	name := registry + "/" + repository
+	for _, allowed := range r.Registries {
+		allowed = strings.TrimSuffix(allowed, "/")
+		if name == allowed || strings.HasPrefix(name, allowed+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *RegistryResolver) Resolve(ctx context.Context, registry, repository, tag string) (string, error) {
+	image := registry + "/" + repository + ":" + tag
+	if !r.registryAllowed(registry, repository) {
+		return "", fmt.Errorf("registry of image '%s' is not allowed for digest resolution", image)
+	}
+
+	r.mutex.Lock()
+	cached, ok := r.cache[image]
+	r.mutex.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.digest, nil
+	}
+
+	if registry == "docker.io" {
+		registry = dockerHubRegistry
+	}
+	manifestURL := fmt.Sprintf("https://%s/v2/%s/manifests/%s", registry, repository, tag)
+
+	resp, err := r.requestManifest(ctx, manifestURL, "")
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		token, err := r.requestToken(ctx, registry, resp.Header.Get("Www-Authenticate"))
+		resp.Body.Close()
+		if err != nil {
+			return "", fmt.Errorf("failed to authenticate for image '%s': %v", image, err)
+		}
+		if resp, err = r.requestManifest(ctx, manifestURL, token); err != nil {
+			return "", err
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get manifest of image '%s': %s", image, resp.Status)
+	}
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", fmt.Errorf("registry did not return a digest for image '%s'", image)
+	}
+
+	r.mutex.Lock()
+	if r.cache == nil {
+		r.cache = make(map[string]cachedDigest)
+	}
+	r.evictCachedDigests(time.Now())
+	r.cache[image] = cachedDigest{digest: digest, expires: time.Now().Add(r.TTL)}
+	r.mutex.Unlock()
+
+	return digest, nil
+}
+
+// evictCachedDigests removes the expired digests from the full cache and, if
+// still full, arbitrary other digests. The caller must hold the mutex.
+func (r *RegistryResolver) evictCachedDigests(now time.Time) {
+	if len(r.cache) < maxCachedDigests {
+		return
+	}
+	for image, cached := range r.cache {
+		if !now.Before(cached.expires) {
+			delete(r.cache, image)
+		}
+	}
+	for image := range r.cache {
+		if len(r.cache) < maxCachedDigests {
+			break
+		}
+		delete(r.cache, image)
+	}
+}
+
+func (r *RegistryResolver) requestManifest(ctx context.Context, manifestURL, token string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodHead, manifestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return r.Client.Do(req)
+}
+
+var challengeParamRegexp = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// requestToken requests an anonymous bearer token as described by the
+// 'WWW-Authenticate' challenge of the registry. The realm must be an https
+// URL within the domain of the registry.
+func (r *RegistryResolver) requestToken(ctx context.Context, registry, challenge string) (string, error) {
+	if !strings.HasPrefix(challenge, "Bearer ") {
+		return "", fmt.Errorf("unsupported authentication challenge '%s'", challenge)
+	}
+	params := make(map[string]string)
+	for _, match := range challengeParamRegexp.FindAllStringSubmatch(challenge, -1) {
+		params[match[1]] = match[2]
+	}
+	realm, ok := params["realm"]
+	if !ok {
+		return "", fmt.Errorf("authentication challenge without realm")
+	}
+	realmURL, err := url.Parse(realm)
+	if err != nil || realmURL.Scheme != "https" || !sameDomain(realmURL.Hostname(), hostname(registry)) {
+		return "", fmt.Errorf("realm '%s' is not an https URL of the registry domain", realm)
+	}
+	query := url.Values{}
+	if service, ok := params["service"]; ok {
+		query.Set("service", service)
+	}
+	if scope, ok := params["scope"]; ok {
+		query.Set("scope", scope)
+	}
+
+	realmURL.RawQuery = query.Encode()
+	req, err := http.NewRequest(http.MethodGet, realmURL.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := r.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request failed: %s", resp.Status)
+	}
+
+	var tokenResponse struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil {
+		return "", err
+	}
+	if tokenResponse.Token != "" {
+		return tokenResponse.Token, nil
+	}
+	return tokenResponse.AccessToken, nil
+}
+
+// hostname returns the host of a registry without port
+func hostname(registry string) string {
+	if host, _, err := net.SplitHostPort(registry); err == nil {
+		return host
+	}
+	return registry
+}
+
+// sameDomain reports whether both hosts are equal or share the same domain
+// of the last two labels, e.g. 'auth.docker.io' and 'registry-1.docker.io'
+func sameDomain(a, b string) bool {
+	if a == b {
+		return true
+	}
+	if net.ParseIP(a) != nil || net.ParseIP(b) != nil {
+		return false
+	}
+	domain := func(host string) string {
+		labels := strings.Split(host, ".")
+		if len(labels) < 2 {
+			return ""
+		}
+		return strings.Join(labels[len(labels)-2:], ".")
+	}
+	return domain(a) != "" && domain(a) == domain(b)
+}
@@ -0,0 +1,212 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package digest
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileResolver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "karydia-digest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "digests.json")
+	if err := ioutil.WriteFile(path, []byte(`{"docker.io/library/nginx:1.17": "sha256:abc"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	resolver, err := NewFileResolver(path)
+	if err != nil {
+		t.Fatal("failed to create file resolver:", err)
+	}
+
+	digest, err := resolver.Resolve(context.Background(), "docker.io", "library/nginx", "1.17")
+	if err != nil || digest != "sha256:abc" {
+		t.Errorf("expected digest to be %v but is %v (%v)", "sha256:abc", digest, err)
+	}
+	if _, err := resolver.Resolve(context.Background(), "docker.io", "library/nginx", "1.16"); err == nil {
+		t.Error("expected error for unknown image")
+	}
+
+	// the file is reloaded on change
+	if err := ioutil.WriteFile(path, []byte(`{"docker.io/library/nginx:1.16": "sha256:def"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	digest, err = resolver.Resolve(context.Background(), "docker.io", "library/nginx", "1.16")
+	if err != nil || digest != "sha256:def" {
+		t.Errorf("expected digest to be %v but is %v (%v)", "sha256:def", digest, err)
+	}
+}
+
+func TestFileResolverInvalidFile(t *testing.T) {
+	if _, err := NewFileResolver("/does/not/exist.json"); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
+func TestRegistryResolver(t *testing.T) {
+	requests := 0
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			if r.URL.Query().Get("scope") != "repository:team/app:pull" {
+				http.Error(w, "invalid scope", http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `{"token": "secret"}`)
+		case "/v2/team/app/manifests/1.0":
+			requests++
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				w.Header().Set("Www-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry",scope="repository:team/app:pull"`, server.URL))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if !strings.Contains(r.Header.Get("Accept"), "application/vnd.docker.distribution.manifest.list.v2+json") {
+				http.Error(w, "unexpected accept header", http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Docker-Content-Digest", "sha256:abc")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	registry := strings.TrimPrefix(server.URL, "https://")
+	resolver := NewRegistryResolver(time.Second, time.Minute, []string{registry})
+	resolver.Client = server.Client()
+
+	digest, err := resolver.Resolve(context.Background(), registry, "team/app", "1.0")
+	if err != nil || digest != "sha256:abc" {
+		t.Errorf("expected digest to be %v but is %v (%v)", "sha256:abc", digest, err)
+	}
+
+	// the digest is cached
+	if _, err := resolver.Resolve(context.Background(), registry, "team/app", "1.0"); err != nil {
+		t.Error("failed to resolve cached digest:", err)
+	}
+	if requests != 2 {
+		t.Error("expected 2 manifest requests but got", requests)
+	}
+
+	if _, err := resolver.Resolve(context.Background(), registry, "team/app", "2.0"); err == nil {
+		t.Error("expected error for unknown image")
+	}
+}
+
+func TestRegistryResolverRestrictions(t *testing.T) {
+	tokenRequests := 0
+	var server *httptest.Server
+	var realm string
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			tokenRequests++
+			fmt.Fprint(w, `{"token": "secret"}`)
+		default:
+			w.Header().Set("Www-Authenticate", fmt.Sprintf(`Bearer realm="%s",service="registry"`, realm))
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	registry := strings.TrimPrefix(server.URL, "https://")
+	resolver := NewRegistryResolver(time.Second, time.Minute, []string{registry + "/team"})
+	resolver.Client = server.Client()
+
+	// registries which are not allowed are not queried
+	if _, err := resolver.Resolve(context.Background(), "internal.local", "team/app", "1.0"); err == nil {
+		t.Error("expected error for registry which is not allowed")
+	}
+	if _, err := resolver.Resolve(context.Background(), registry, "other/app", "1.0"); err == nil {
+		t.Error("expected error for repository which is not allowed")
+	}
+
+	// realms must be https URLs of the registry domain
+	for _, realm = range []string{"http://" + registry + "/token", "https://169.254.169.254/token", "https://internal.local/token"} {
+		if _, err := resolver.Resolve(context.Background(), registry, "team/app", "1.0"); err == nil {
+			t.Error("expected error for realm", realm)
+		}
+	}
+	if tokenRequests != 0 {
+		t.Error("expected 0 token requests but got", tokenRequests)
+	}
+}
+
+func TestSameDomain(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected bool
+	}{
+		{"auth.docker.io", "registry-1.docker.io", true},
+		{"gcr.io", "gcr.io", true},
+		{"127.0.0.1", "127.0.0.1", true},
+		{"evil.io", "docker.io", false},
+		{"10.0.0.1", "0.1", false},
+		{"localhost", "registry", false},
+	}
+	for _, test := range tests {
+		if sameDomain(test.a, test.b) != test.expected {
+			t.Errorf("expected sameDomain(%s, %s) to be %v", test.a, test.b, test.expected)
+		}
+	}
+}
+
+func TestRegistryResolverCacheBound(t *testing.T) {
+	resolver := NewRegistryResolver(time.Second, time.Minute, nil)
+	resolver.cache = make(map[string]cachedDigest)
+
+	now := time.Now()
+	for i := 0; i < maxCachedDigests; i++ {
+		expires := now.Add(time.Minute)
+		if i%2 == 0 {
+			expires = now.Add(-time.Minute)
+		}
+		resolver.cache[fmt.Sprintf("registry.example.com/image:%d", i)] = cachedDigest{digest: "sha256:0", expires: expires}
+	}
+
+	// expired digests are removed first
+	resolver.evictCachedDigests(now)
+	if len(resolver.cache) != maxCachedDigests/2 {
+		t.Errorf("expected %d cached digests but got %d", maxCachedDigests/2, len(resolver.cache))
+	}
+
+	for i := 0; len(resolver.cache) < maxCachedDigests; i++ {
+		resolver.cache[fmt.Sprintf("registry.example.com/other:%d", i)] = cachedDigest{digest: "sha256:0", expires: now.Add(time.Minute)}
+	}
+	resolver.evictCachedDigests(now)
+	if len(resolver.cache) >= maxCachedDigests {
+		t.Errorf("expected less than %d cached digests but got %d", maxCachedDigests, len(resolver.cache))
+	}
+}
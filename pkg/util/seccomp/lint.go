@@ -0,0 +1,217 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package seccomp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Finding is a problem of a seccomp profile found by Lint
+type Finding struct {
+	Severity Severity
+	Message  string
+}
+
+func (f Finding) String() string {
+	return string(f.Severity) + ": " + f.Message
+}
+
+var architectures = []string{
+	"SCMP_ARCH_X86",
+	"SCMP_ARCH_X86_64",
+	"SCMP_ARCH_X32",
+	"SCMP_ARCH_ARM",
+	"SCMP_ARCH_AARCH64",
+	"SCMP_ARCH_MIPS",
+	"SCMP_ARCH_MIPS64",
+	"SCMP_ARCH_MIPS64N32",
+	"SCMP_ARCH_MIPSEL",
+	"SCMP_ARCH_MIPSEL64",
+	"SCMP_ARCH_MIPSEL64N32",
+	"SCMP_ARCH_PPC",
+	"SCMP_ARCH_PPC64",
+	"SCMP_ARCH_PPC64LE",
+	"SCMP_ARCH_S390",
+	"SCMP_ARCH_S390X",
+	"SCMP_ARCH_PARISC",
+	"SCMP_ARCH_PARISC64",
+	"SCMP_ARCH_RISCV64",
+}
+
+var operators = []string{
+	"SCMP_CMP_NE",
+	"SCMP_CMP_LT",
+	"SCMP_CMP_LE",
+	"SCMP_CMP_EQ",
+	"SCMP_CMP_GE",
+	"SCMP_CMP_GT",
+	"SCMP_CMP_MASKED_EQ",
+}
+
+// dangerousSyscalls allow to escape the container or to affect the node,
+// most of them are blocked by the default profile of the container runtime
+var dangerousSyscalls = []string{
+	"acct",
+	"add_key",
+	"bpf",
+	"clock_adjtime",
+	"clock_settime",
+	"delete_module",
+	"finit_module",
+	"init_module",
+	"ioperm",
+	"iopl",
+	"kcmp",
+	"kexec_file_load",
+	"kexec_load",
+	"keyctl",
+	"lookup_dcookie",
+	"mount",
+	"name_to_handle_at",
+	"open_by_handle_at",
+	"perf_event_open",
+	"pivot_root",
+	"process_vm_readv",
+	"process_vm_writev",
+	"ptrace",
+	"quotactl",
+	"reboot",
+	"request_key",
+	"setns",
+	"settimeofday",
+	"swapoff",
+	"swapon",
+	"umount",
+	"umount2",
+	"unshare",
+	"uselib",
+	"userfaultfd",
+	"vm86",
+	"vm86old",
+}
+
+// Lint checks the schema, architectures, actions and syscall names of a
+// seccomp profile and warns about allowed dangerous syscalls
+func Lint(data []byte) []Finding {
+	var findings []Finding
+	errorf := func(format string, a ...interface{}) {
+		findings = append(findings, Finding{Severity: SeverityError, Message: fmt.Sprintf(format, a...)})
+	}
+	warnf := func(format string, a ...interface{}) {
+		findings = append(findings, Finding{Severity: SeverityWarning, Message: fmt.Sprintf(format, a...)})
+	}
+
+	profile := &Profile{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(profile); err != nil {
+		if !strings.HasPrefix(err.Error(), "json: unknown field") {
+			errorf("invalid JSON: %v", err)
+			return findings
+		}
+		warnf("%s", strings.TrimPrefix(err.Error(), "json: "))
+		profile = &Profile{}
+		if err := json.Unmarshal(data, profile); err != nil {
+			errorf("invalid JSON: %v", err)
+			return findings
+		}
+	}
+
+	if !isAction(profile.DefaultAction) {
+		errorf("invalid defaultAction '%s'", profile.DefaultAction)
+	}
+	for _, arch := range profile.Architectures {
+		if !contains(architectures, arch) {
+			errorf("unknown architecture '%s'", arch)
+		}
+	}
+	for i, arch := range profile.ArchMap {
+		for _, a := range append([]string{arch.Architecture}, arch.SubArchitectures...) {
+			if !contains(architectures, a) {
+				errorf("archMap[%d]: unknown architecture '%s'", i, a)
+			}
+		}
+	}
+
+	// actions of the unconditional rules by syscall
+	actions := make(map[string]string)
+	for i, syscall := range profile.Syscalls {
+		names := syscall.names()
+		if len(names) == 0 {
+			errorf("syscalls[%d]: no syscall names", i)
+		}
+		if !isAction(syscall.Action) {
+			errorf("syscalls[%d]: invalid action '%s'", i, syscall.Action)
+		}
+		for _, arg := range syscall.Args {
+			if !contains(operators, arg.Op) {
+				errorf("syscalls[%d]: invalid operator '%s' of argument %d", i, arg.Op, arg.Index)
+			}
+		}
+		for _, name := range names {
+			if !syscalls[name] {
+				errorf("syscalls[%d]: unknown syscall '%s'", i, name)
+			}
+			if contains(dangerousSyscalls, name) && allows(syscall.Action) {
+				warnf("syscalls[%d]: dangerous syscall '%s' is allowed", i, name)
+			}
+			if len(syscall.Args) == 0 {
+				actions[name] = syscall.Action
+			}
+		}
+	}
+
+	if allows(profile.DefaultAction) {
+		warnf("defaultAction '%s' allows all syscalls which are not explicitly restricted", profile.DefaultAction)
+		var allowed []string
+		for _, name := range dangerousSyscalls {
+			if _, ok := actions[name]; !ok {
+				allowed = append(allowed, name)
+			}
+		}
+		if len(allowed) > 0 {
+			sort.Strings(allowed)
+			warnf("defaultAction '%s' allows the dangerous syscalls '%s'", profile.DefaultAction, strings.Join(allowed, "', '"))
+		}
+	}
+	return findings
+}
+
+// allows reports whether the action lets the syscall pass
+func allows(action string) bool {
+	return action == "SCMP_ACT_ALLOW" || action == "SCMP_ACT_LOG"
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
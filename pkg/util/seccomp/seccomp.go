@@ -0,0 +1,169 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package seccomp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// DefaultRootDir is the directory the kubelet loads 'localhost/' seccomp
+	// profiles from
+	DefaultRootDir = "/var/lib/kubelet/seccomp"
+	// ProfileDir is the subdirectory of the root directory holding the
+	// profiles of KarydiaSeccompProfile resources
+	ProfileDir = "karydia"
+
+	localhostPrefix = "localhost/"
+)
+
+var actions = []string{
+	"SCMP_ACT_KILL",
+	"SCMP_ACT_KILL_PROCESS",
+	"SCMP_ACT_KILL_THREAD",
+	"SCMP_ACT_TRAP",
+	"SCMP_ACT_ERRNO",
+	"SCMP_ACT_TRACE",
+	"SCMP_ACT_ALLOW",
+	"SCMP_ACT_LOG",
+	"SCMP_ACT_NOTIFY",
+}
+
+// Profile is a seccomp profile in the JSON format of the container runtime
+type Profile struct {
+	DefaultAction    string         `json:"defaultAction"`
+	DefaultErrnoRet  *uint          `json:"defaultErrnoRet,omitempty"`
+	Architectures    []string       `json:"architectures,omitempty"`
+	ArchMap          []Architecture `json:"archMap,omitempty"`
+	Flags            []string       `json:"flags,omitempty"`
+	ListenerPath     string         `json:"listenerPath,omitempty"`
+	ListenerMetadata string         `json:"listenerMetadata,omitempty"`
+	Syscalls         []Syscall      `json:"syscalls,omitempty"`
+}
+
+type Architecture struct {
+	Architecture     string   `json:"architecture"`
+	SubArchitectures []string `json:"subArchitectures,omitempty"`
+}
+
+type Syscall struct {
+	Name     string          `json:"name,omitempty"`
+	Names    []string        `json:"names,omitempty"`
+	Action   string          `json:"action"`
+	ErrnoRet *uint           `json:"errnoRet,omitempty"`
+	Args     []Arg           `json:"args"`
+	Comment  string          `json:"comment,omitempty"`
+	Includes json.RawMessage `json:"includes,omitempty"`
+	Excludes json.RawMessage `json:"excludes,omitempty"`
+}
+
+type Arg struct {
+	Index    uint   `json:"index"`
+	Value    uint64 `json:"value"`
+	ValueTwo uint64 `json:"valueTwo"`
+	Op       string `json:"op"`
+}
+
+// names returns the names of the syscalls the rule applies to
+func (syscall Syscall) names() []string {
+	if syscall.Name != "" {
+		return append([]string{syscall.Name}, syscall.Names...)
+	}
+	return syscall.Names
+}
+
+// LocalhostProfile returns the profile reference of the KarydiaSeccompProfile
+// with the given name, e.g. 'localhost/karydia/my-profile'
+func LocalhostProfile(name string) string {
+	return localhostPrefix + ProfileDir + "/" + name
+}
+
+// ProfileName returns the name of the KarydiaSeccompProfile referenced by the
+// given 'localhost/' profile. It reports false if the profile does not
+// reference a KarydiaSeccompProfile.
+func ProfileName(profile string) (string, bool) {
+	name := strings.TrimPrefix(profile, localhostPrefix+ProfileDir+"/")
+	if name == profile || name == "" || strings.Contains(name, "/") {
+		return "", false
+	}
+	return name, true
+}
+
+// IsLocalhostProfile reports whether the profile is loaded from the node
+func IsLocalhostProfile(profile string) bool {
+	return strings.HasPrefix(profile, localhostPrefix)
+}
+
+// Parse decodes and validates a seccomp profile
+func Parse(data []byte) (*Profile, error) {
+	profile := &Profile{}
+	if err := json.Unmarshal(data, profile); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	if !isAction(profile.DefaultAction) {
+		return nil, fmt.Errorf("invalid defaultAction '%s'", profile.DefaultAction)
+	}
+	for i, syscall := range profile.Syscalls {
+		if len(syscall.names()) == 0 {
+			return nil, fmt.Errorf("syscalls[%d]: no syscall names", i)
+		}
+		if !isAction(syscall.Action) {
+			return nil, fmt.Errorf("syscalls[%d]: invalid action '%s'", i, syscall.Action)
+		}
+	}
+	return profile, nil
+}
+
+func isAction(action string) bool {
+	for _, a := range actions {
+		if action == a {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteFileAtomic writes the data to a temporary file in the same directory
+// and renames it, so readers never see a partially written file
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,121 @@
+// Copyright (C) 2019 SAP SE or an SAP affiliate company. All rights reserved.
+// This file is licensed under the Apache Software License, v. 2 except as
+// noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package seccomp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	valid := []string{
+		`{"defaultAction": "SCMP_ACT_ALLOW"}`,
+		`{"defaultAction": "SCMP_ACT_ERRNO", "architectures": ["SCMP_ARCH_X86_64"], "syscalls": [{"names": ["read"], "action": "SCMP_ACT_ALLOW"}, {"name": "write", "action": "SCMP_ACT_ALLOW"}]}`,
+	}
+	for _, profile := range valid {
+		if _, err := Parse([]byte(profile)); err != nil {
+			t.Errorf("expected profile '%s' to be valid but got: %v", profile, err)
+		}
+	}
+
+	invalid := []string{
+		`{"defaultAction": "SCMP_ACT_ALLOW"`,
+		`{}`,
+		`{"defaultAction": "SCMP_ACT_ERRNO", "syscalls": [{"action": "SCMP_ACT_ALLOW"}]}`,
+		`{"defaultAction": "SCMP_ACT_ERRNO", "syscalls": [{"names": ["read"], "action": "ALLOW"}]}`,
+	}
+	for _, profile := range invalid {
+		if _, err := Parse([]byte(profile)); err == nil {
+			t.Errorf("expected profile '%s' to be invalid", profile)
+		}
+	}
+}
+
+func TestProfileName(t *testing.T) {
+	tests := map[string]string{
+		"localhost/karydia/my-profile": "my-profile",
+		"localhost/my-profile.json":    "",
+		"localhost/karydia/":           "",
+		"localhost/karydia/a/b":        "",
+		"runtime/default":              "",
+	}
+	for profile, expected := range tests {
+		if name, ok := ProfileName(profile); name != expected || ok != (expected != "") {
+			t.Errorf("expected name '%s' for profile '%s' but got: '%s'", expected, profile, name)
+		}
+	}
+	if profile := LocalhostProfile("my-profile"); profile != "localhost/karydia/my-profile" {
+		t.Error("unexpected localhost profile:", profile)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "seccomp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "profile")
+	for _, data := range []string{"first", "second"} {
+		if err := WriteFileAtomic(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil || string(content) != data {
+			t.Errorf("expected '%s' but got '%s' (%v)", data, content, err)
+		}
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Error("expected no temporary files but got:", files)
+	}
+}
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		profile  string
+		errors   int
+		warnings int
+	}{
+		{`{"defaultAction": "SCMP_ACT_ERRNO", "architectures": ["SCMP_ARCH_X86_64"], "syscalls": [{"names": ["read", "write"], "action": "SCMP_ACT_ALLOW", "args": []}]}`, 0, 0},
+		{`{"defaultAction": "SCMP_ACT_ERRNO"`, 1, 0},
+		{`{"defaultAction": "SCMP_ACT_ERRNO", "unknown": true}`, 0, 1},
+		{`{"defaultAction": "SCMP_ACT_ERRNO", "architectures": ["SCMP_ARCH_Z80"]}`, 1, 0},
+		{`{"defaultAction": "SCMP_ACT_ERRNO", "syscalls": [{"names": ["read", "fly"], "action": "SCMP_ACT_ALLOW"}]}`, 1, 0},
+		{`{"defaultAction": "SCMP_ACT_ERRNO", "syscalls": [{"names": ["read"], "action": "SCMP_ACT_ALLOW", "args": [{"index": 0, "value": 1, "op": "SCMP_CMP_IS"}]}]}`, 1, 0},
+		{`{"defaultAction": "SCMP_ACT_ERRNO", "syscalls": [{"names": ["ptrace", "mount"], "action": "SCMP_ACT_ALLOW"}]}`, 0, 2},
+		// default action warning and dangerous syscalls allowed by default
+		{`{"defaultAction": "SCMP_ACT_ALLOW", "syscalls": [{"names": ["chmod"], "action": "SCMP_ACT_ERRNO"}]}`, 0, 2},
+	}
+	for _, test := range tests {
+		errors, warnings := 0, 0
+		findings := Lint([]byte(test.profile))
+		for _, finding := range findings {
+			if finding.Severity == SeverityError {
+				errors++
+			} else {
+				warnings++
+			}
+		}
+		if errors != test.errors || warnings != test.warnings {
+			t.Errorf("expected %d errors and %d warnings for profile '%s' but got: %v", test.errors, test.warnings, test.profile, findings)
+		}
+	}
+}
@@ -176,8 +176,8 @@ func TestAutomountServiceAccountTokenInDefaultNamespace(t *testing.T) {
 		t.Fatal("failed to create pod:", err)
 	}
 
-	if createdPod.Spec.AutomountServiceAccountToken != nil {
-		t.Fatal("expected automountServiceAccountToken to be nil but is", createdPod.Spec.AutomountServiceAccountToken)
+	if createdPod.Spec.AutomountServiceAccountToken == nil || *createdPod.Spec.AutomountServiceAccountToken != false {
+		t.Fatal("expected automountServiceAccountToken to be false but is", createdPod.Spec.AutomountServiceAccountToken)
 	}
 
 	if !(len(createdPod.Spec.Volumes) == 0) {